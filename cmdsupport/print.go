@@ -62,6 +62,9 @@ func PrintRewrite(file string, printRewrite bool, printMock bool, opts *inspect.
 		foundContent = pkgRes.Files[absFile]
 		if foundContent != nil {
 			mockContent = pkgRes.MockContent
+			if pkgRes.SetupContent != "" {
+				mockContent = pkgRes.SetupContent
+			}
 			break
 		}
 	}
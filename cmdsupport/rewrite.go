@@ -2,6 +2,7 @@ package cmdsupport
 
 import (
 	"fmt"
+	"go/token"
 	"log"
 	"os"
 	"path"
@@ -118,28 +119,11 @@ func GenRewrite(args []string, rootDir string, opts *GenRewriteOptions) (res *Ge
 	}
 
 	loadPkgTime := time.Now()
-	fset, starterPkgs, err := inspect.LoadPackages(args, &inspect.LoadOptions{
-		ProjectDir: projectDir,
-		ForTest:    opts.ForTest,
-		BuildFlags: opts.LoadArgs,
-	})
-	loadPkgEnd := time.Now()
-	if verboseCost {
-		log.Printf("COST load packages:%v", loadPkgEnd.Sub(loadPkgTime))
-	}
-	if err != nil {
-		panic(err)
-	}
+	loaded := loadRewritePackages(args, projectDir, opts)
+	fset, starterPkgs, modPkgs, extraPkgs, allPkgs := loaded.fset, loaded.starterPkgs, loaded.modPkgs, loaded.extraPkgs, loaded.allPkgs
+	modPath, modDir := loaded.modPath, loaded.modDir
+	pkgMap := inspect.MakePackageMap(allPkgs)
 
-	// ensure that starterPkgs have exactly one module
-	modPath, modDir := extractSingleMod(starterPkgs)
-	_ = modDir // maybe used later
-	if verbose {
-		log.Printf("current module: %s , dir %s", modPath, modDir)
-	}
-	if len(starterPkgs) == 0 {
-		panic(fmt.Errorf("no packages loaded."))
-	}
 	starterPkg0 := starterPkgs[0]
 	starterPkg0Dir := inspect.GetFsPathOfPkg(starterPkg0.Module, starterPkg0.PkgPath)
 
@@ -149,77 +133,14 @@ func GenRewrite(args []string, rootDir string, opts *GenRewriteOptions) (res *Ge
 
 	// return relative directory
 	stubFsRelDir := func(pkgModPath, pkgPath string) string {
-		rel := ""
-		if pkgModPath == modPath {
-			rel = inspect.GetRelativePath(pkgModPath, pkgPath)
-		} else {
-			rel = path.Join("ext", pkgPath)
-		}
-		return rel
+		return stubRelDir(modPath, pkgModPath, pkgPath)
 	}
 
-	// init rewrite opts
-	onlyPkgs := opts.OnlyPackages
-	wantsExtraPkgs := opts.Packages
-	wantsExtrPkgsByMod := opts.Modules
-	allowMissing := opts.AllowMissing
-
 	rewriteOpts := opts.RewriteOptions
 	if rewriteOpts == nil {
 		rewriteOpts = &inspect.RewriteOptions{}
 	}
 
-	// expand to all packages under the same module that depended by starter packages
-	filterPkgTime := time.Now()
-	if verboseCost {
-		log.Printf("COST load package -> filter package:%v", filterPkgTime.Sub(loadPkgEnd))
-	}
-	var modPkgs []*packages.Package
-	var extraPkgs []*packages.Package
-	if len(onlyPkgs) == 0 {
-		modPkgs, extraPkgs = inspect.GetSameModulePackagesAndPkgsGiven(starterPkgs, wantsExtraPkgs, wantsExtrPkgsByMod)
-	} else {
-		var oldModPkgs []*packages.Package
-		oldModPkgs, extraPkgs = inspect.GetSameModulePackagesAndPkgsGiven(starterPkgs, onlyPkgs, nil)
-		for _, p := range oldModPkgs {
-			if onlyPkgs[p.PkgPath] {
-				modPkgs = append(modPkgs, p)
-			}
-		}
-	}
-	filterPkgEnd := time.Now()
-	if verboseCost {
-		log.Printf("COST filter package:%v", filterPkgEnd.Sub(filterPkgTime))
-	}
-
-	allPkgs := make([]*packages.Package, 0, len(modPkgs)+len(extraPkgs))
-	allPkgs = append(allPkgs, modPkgs...)
-	for _, p := range extraPkgs {
-		if len(p.GoFiles) == 0 {
-			continue
-		}
-		allPkgs = append(allPkgs, p)
-	}
-	pkgMap := inspect.MakePackageMap(allPkgs)
-
-	if verbose {
-		log.Printf("found %d packages", len(allPkgs))
-	}
-
-	// check if wanted pkgs are all found
-	var missingExtra []string
-	for extraPkg := range wantsExtraPkgs {
-		if pkgMap[extraPkg] == nil {
-			missingExtra = append(missingExtra, extraPkg)
-		}
-	}
-	if len(missingExtra) > 0 {
-		if !allowMissing {
-			panic(fmt.Errorf("packages not found:%v", missingExtra))
-		}
-		log.Printf("WARNING: not found packages will be skipped:%v", missingExtra)
-	}
-
 	// rewrite
 	rewriteTime := time.Now()
 	contents := inspect.RewritePackages(fset, allPkgs, rewriteOpts)
@@ -320,6 +241,24 @@ func GenRewrite(args []string, rootDir string, opts *GenRewriteOptions) (res *Ge
 				bytes:   []byte(fileRes.Content),
 			}
 		}
+		// exported aliases of unexported types, referenced by the export stub
+		if pkgRes.MockContentError == nil && pkgRes.ExportContent != "" {
+			pkgDir := inspect.GetFsPathOfPkg(pkg.Module, pkgPath)
+			exportName := inspect.NextFileNameUnderDir(pkgDir, "mock_export", ".go")
+			backMap[destFsPath(path.Join(pkgDir, exportName))] = &content{
+				srcFile: pkgDir,
+				bytes:   []byte(pkgRes.ExportContent),
+			}
+		}
+		// in-package setup for packages test/mock_gen cannot import
+		if pkgRes.SetupContent != "" {
+			pkgDir := inspect.GetFsPathOfPkg(pkg.Module, pkgPath)
+			setupName := inspect.NextFileNameUnderDir(pkgDir, "mock_setup", ".go")
+			backMap[destFsPath(path.Join(pkgDir, setupName))] = &content{
+				srcFile: pkgDir,
+				bytes:   []byte(pkgRes.SetupContent),
+			}
+		}
 		// generate mock stubs
 		if needAnyMockStub && pkgRes.MockContentError == nil && pkgRes.MockContent != "" {
 			// relative to current module
@@ -341,6 +280,14 @@ func GenRewrite(args []string, rootDir string, opts *GenRewriteOptions) (res *Ge
 				}
 			}
 
+			// only the rewritten copy has the exported aliases
+			if pkgRes.MockExportContent != "" {
+				backMap[destFsPath(path.Join(genDir, "mock_export.go"))] = &content{
+					srcFile: pkgDir,
+					bytes:   []byte(pkgRes.MockExportContent),
+				}
+			}
+
 			// TODO: may skip this for 'go test'
 			if needMockRegistering {
 				genRewriteFile := destFsPath(genFile)
@@ -379,7 +326,7 @@ func GenRewrite(args []string, rootDir string, opts *GenRewriteOptions) (res *Ge
 	// to register build infos
 	buildInfoName := inspect.NextFileNameUnderDir(starterPkg0Dir, "mock_build_info", ".go")
 	backMap[destFsPath(path.Join(starterPkg0Dir, buildInfoName))] = &content{
-		bytes: []byte(fmt.Sprintf("package %s\n\nimport _mock %q\nfunc init(){\n    _mock.SetBuildInfo(&_mock.BuildInfo{MainModule: %q})\n}", starterPkg0.Name, inspect.MOCK_PKG, modPath)),
+		bytes: []byte(fmt.Sprintf("package %s\n\nimport _mock %q\nimport _mockautoload %q\nfunc init(){\n    _mock.SetBuildInfo(&_mock.BuildInfo{MainModule: %q})\n    _mockautoload.Install()\n}", starterPkg0.Name, inspect.MOCK_PKG, inspect.MOCK_AUTOLOAD_PKG, modPath)),
 	}
 
 	// in this copy config, srcPath is the same with destPath
@@ -439,6 +386,122 @@ func GenRewrite(args []string, rootDir string, opts *GenRewriteOptions) (res *Ge
 	return
 }
 
+// loadedPackages are packages to be rewritten
+type loadedPackages struct {
+	fset        *token.FileSet
+	starterPkgs []*packages.Package
+	modPkgs     []*packages.Package // packages of the main module
+	extraPkgs   []*packages.Package // packages given by opts.Packages and opts.Modules
+	allPkgs     []*packages.Package // modPkgs and extraPkgs having go files
+	modPath     string
+	modDir      string
+}
+
+// loadRewritePackages loads packages given by args, and expands
+// them to all packages to be rewritten according to opts.
+func loadRewritePackages(args []string, projectDir string, opts *GenRewriteOptions) *loadedPackages {
+	verbose := opts.Verbose
+	verboseCost := false
+
+	loadPkgTime := time.Now()
+	fset, starterPkgs, err := inspect.LoadPackages(args, &inspect.LoadOptions{
+		ProjectDir: projectDir,
+		ForTest:    opts.ForTest,
+		BuildFlags: opts.LoadArgs,
+	})
+	loadPkgEnd := time.Now()
+	if verboseCost {
+		log.Printf("COST load packages:%v", loadPkgEnd.Sub(loadPkgTime))
+	}
+	if err != nil {
+		panic(err)
+	}
+
+	// ensure that starterPkgs have exactly one module
+	modPath, modDir := extractSingleMod(starterPkgs)
+	if verbose {
+		log.Printf("current module: %s , dir %s", modPath, modDir)
+	}
+	if len(starterPkgs) == 0 {
+		panic(fmt.Errorf("no packages loaded."))
+	}
+
+	// init rewrite opts
+	onlyPkgs := opts.OnlyPackages
+	wantsExtraPkgs := opts.Packages
+	wantsExtrPkgsByMod := opts.Modules
+	allowMissing := opts.AllowMissing
+
+	// expand to all packages under the same module that depended by starter packages
+	filterPkgTime := time.Now()
+	if verboseCost {
+		log.Printf("COST load package -> filter package:%v", filterPkgTime.Sub(loadPkgEnd))
+	}
+	var modPkgs []*packages.Package
+	var extraPkgs []*packages.Package
+	if len(onlyPkgs) == 0 {
+		modPkgs, extraPkgs = inspect.GetSameModulePackagesAndPkgsGiven(starterPkgs, wantsExtraPkgs, wantsExtrPkgsByMod)
+	} else {
+		var oldModPkgs []*packages.Package
+		oldModPkgs, extraPkgs = inspect.GetSameModulePackagesAndPkgsGiven(starterPkgs, onlyPkgs, nil)
+		for _, p := range oldModPkgs {
+			if onlyPkgs[p.PkgPath] {
+				modPkgs = append(modPkgs, p)
+			}
+		}
+	}
+	filterPkgEnd := time.Now()
+	if verboseCost {
+		log.Printf("COST filter package:%v", filterPkgEnd.Sub(filterPkgTime))
+	}
+
+	allPkgs := make([]*packages.Package, 0, len(modPkgs)+len(extraPkgs))
+	allPkgs = append(allPkgs, modPkgs...)
+	for _, p := range extraPkgs {
+		if len(p.GoFiles) == 0 {
+			continue
+		}
+		allPkgs = append(allPkgs, p)
+	}
+	pkgMap := inspect.MakePackageMap(allPkgs)
+
+	if verbose {
+		log.Printf("found %d packages", len(allPkgs))
+	}
+
+	// check if wanted pkgs are all found
+	var missingExtra []string
+	for extraPkg := range wantsExtraPkgs {
+		if pkgMap[extraPkg] == nil {
+			missingExtra = append(missingExtra, extraPkg)
+		}
+	}
+	if len(missingExtra) > 0 {
+		if !allowMissing {
+			panic(fmt.Errorf("packages not found:%v", missingExtra))
+		}
+		log.Printf("WARNING: not found packages will be skipped:%v", missingExtra)
+	}
+	return &loadedPackages{
+		fset:        fset,
+		starterPkgs: starterPkgs,
+		modPkgs:     modPkgs,
+		extraPkgs:   extraPkgs,
+		allPkgs:     allPkgs,
+		modPath:     modPath,
+		modDir:      modDir,
+	}
+}
+
+// stubRelDir returns the directory of stubs of pkgPath relative
+// to the stub gen dir, packages of other modules are put under ext.
+func stubRelDir(modPath string, pkgModPath string, pkgPath string) string {
+	if pkgModPath == modPath {
+		return inspect.GetRelativePath(pkgModPath, pkgPath)
+	}
+	return path.Join("ext", pkgPath)
+}
+
 func extractSingleMod(starterPkgs []*packages.Package) (modPath string, modDir string) {
 	// debug
 	// for _, p := range starterPkgs {
@@ -0,0 +1,107 @@
+package cmdsupport
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"text/tabwriter"
+
+	"github.com/xhd2015/go-mock/inspect"
+)
+
+const (
+	STUBS_FORMAT_TABLE  = "table"
+	STUBS_FORMAT_JSON   = "json"
+	STUBS_FORMAT_SCHEMA = "schema"
+)
+
+// ListStubs loads packages like GenRewrite, and returns functions
+// that would be trapped, without writing or building anything.
+// StubFile is relative to the project dir if inside it.
+func ListStubs(args []string, opts *GenRewriteOptions) []*inspect.StubDetail {
+	if opts == nil {
+		opts = &GenRewriteOptions{}
+	}
+	projectDir, err := toAbsPath(opts.ProjectDir)
+	if err != nil {
+		panic(fmt.Errorf("get abs dir err:%v", err))
+	}
+	stubGenDir := opts.StubGenDir
+	if stubGenDir == "" {
+		stubGenDir = "test/mock_gen"
+	}
+
+	loaded := loadRewritePackages(args, projectDir, opts)
+	pkgMap := inspect.MakePackageMap(loaded.allPkgs)
+
+	stubs := inspect.CollectStubs(loaded.fset, loaded.allPkgs, opts.RewriteOptions)
+	setupNames := make(map[string]string)
+	for _, stub := range stubs {
+		pkg := pkgMap[stub.Pkg]
+		if pkg == nil {
+			panic(fmt.Errorf("pkg not found:%v", stub.Pkg))
+		}
+		if pkg.Module == nil {
+			if inspect.IsGoTestPkg(pkg) {
+				continue
+			}
+			panic(fmt.Errorf("package %s has no module", stub.Pkg))
+		}
+		genDir := path.Join(stubGenDir, stubRelDir(loaded.modPath, pkg.Module.Path, stub.Pkg))
+		switch stub.Status {
+		case inspect.STUB_USABLE, inspect.STUB_INVISIBLE:
+			stub.StubFile = path.Join(genDir, "mock.go")
+		case inspect.STUB_EXPORTED:
+			// only generated in the rewritten copy
+			stub.StubFile = path.Join(genDir, "mock_export.go")
+		case inspect.STUB_IN_PACKAGE:
+			pkgDir := inspect.GetFsPathOfPkg(pkg.Module, stub.Pkg)
+			// same name as GenRewrite picks
+			setupName, ok := setupNames[stub.Pkg]
+			if !ok {
+				setupName = inspect.NextFileNameUnderDir(pkgDir, "mock_setup", ".go")
+				setupNames[stub.Pkg] = setupName
+			}
+			if rel, ok := inspect.RelPath(projectDir, pkgDir); ok {
+				pkgDir = rel
+			}
+			stub.StubFile = path.Join(pkgDir, setupName)
+		}
+	}
+	return stubs
+}
+
+// PrintStubs writes stubs to w in format, one of table, json and schema
+func PrintStubs(w io.Writer, stubs []*inspect.StubDetail, format string) error {
+	switch format {
+	case "", STUBS_FORMAT_TABLE:
+		tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+		fmt.Fprintf(tw, "PACKAGE\tOWNER\tFUNC\tSIGNATURE\tSTATUS\tSTUB\n")
+		for _, stub := range stubs {
+			owner := stub.Owner
+			if owner != "" && stub.OwnerPtr {
+				owner = "*" + owner
+			}
+			if owner == "" {
+				owner = "-"
+			}
+			stubFile := stub.StubFile
+			if stubFile == "" {
+				stubFile = "-"
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", stub.Pkg, owner, stub.Name, stub.Signature, stub.Status, stubFile)
+		}
+		return tw.Flush()
+	case STUBS_FORMAT_JSON, STUBS_FORMAT_SCHEMA:
+		var v interface{} = stubs
+		if format == STUBS_FORMAT_SCHEMA {
+			v = inspect.GenStubsSchema(stubs)
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(v)
+	default:
+		return fmt.Errorf("unknown format:%s, expecting one of: table,json,schema", format)
+	}
+}
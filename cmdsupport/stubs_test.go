@@ -0,0 +1,45 @@
+package cmdsupport
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/xhd2015/go-mock/inspect"
+)
+
+// go test -run TestPrintStubs -v ./cmdsupport
+func TestPrintStubs(t *testing.T) {
+	stubs := []*inspect.StubDetail{
+		{Pkg: "example.com/demo", Owner: "store", OwnerPtr: true, Name: "Find", Signature: "func(ctx context.Context, name string) (*user, error)", StubFile: "test/mock_gen/mock_export.go", Status: inspect.STUB_EXPORTED},
+		{Pkg: "example.com/demo", Name: "Load", Signature: "func(ctx context.Context) error", StubFile: "test/mock_gen/mock.go", Status: inspect.STUB_USABLE},
+	}
+	var buf bytes.Buffer
+	err := PrintStubs(&buf, stubs, STUBS_FORMAT_TABLE)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("expect %s = %+v, actual:%+v", "len(lines)", 3, len(lines))
+	}
+	for i, expect := range []string{"*store  Find", "-       Load"} {
+		if !strings.Contains(lines[i+1], expect) {
+			t.Fatalf("expect %s = %+v, actual:%+v", "line", expect, lines[i+1])
+		}
+	}
+
+	buf.Reset()
+	err = PrintStubs(&buf, stubs, STUBS_FORMAT_JSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), `"status": "exported"`) {
+		t.Fatalf("expect %s = %+v, actual:%+v", "json", `"status": "exported"`, buf.String())
+	}
+
+	err = PrintStubs(&buf, stubs, "yaml")
+	if err == nil {
+		t.Fatalf("expect %s = %+v, actual:%+v", "err", "unknown format", err)
+	}
+}
@@ -0,0 +1,302 @@
+package generalmock
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// ENV_DATA_DIR loads the directory as global mock data, and reloads it on change, see LoadDir
+	ENV_DATA_DIR = "GO_MOCK_DATA_DIR"
+	// ENV_DATA_DIR_INTERVAL how often ENV_DATA_DIR is checked for change, like 500ms,
+	// default 1s, 0 disables reloading
+	ENV_DATA_DIR_INTERVAL = "GO_MOCK_DATA_DIR_INTERVAL"
+)
+
+const defaultWatchInterval = time.Second
+
+// LoadDir loads mock data from files under dir, one file per package,
+// the path relative to dir without extension is the package path.
+// Files are JSON(.json) or YAML(.yaml,.yml), other files are ignored.
+// Keys of a file are Name or Owner.Name, an object value is a RespErr
+// put into Mapping, a list value is put into MappingList.
+// For example, dir/github.com/acme/dao.yaml:
+//
+//	Dao.GetUser:
+//	  - Match: {Paths: {$.id: 1}}
+//	    Resp: {id: 1, name: alice}
+//	  - Match: {Paths: {$.id: 2}}
+//	    Error: NotFound
+//	Dao.Count:
+//	  Resp: 10
+func LoadDir(dir string) (*MockData, error) {
+	files, err := listDataFiles(dir)
+	if err != nil {
+		return nil, err
+	}
+	mockData := &MockData{}
+	for _, file := range files {
+		rel, err := filepath.Rel(dir, file)
+		if err != nil {
+			return nil, err
+		}
+		pkg := filepath.ToSlash(strings.TrimSuffix(rel, filepath.Ext(rel)))
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		err = mockData.addPackageFile(pkg, data, filepath.Ext(file))
+		if err != nil {
+			return nil, fmt.Errorf("load %s: %v", file, err)
+		}
+	}
+	err = mockData.Validate()
+	if err != nil {
+		return nil, fmt.Errorf("load %s: %v", dir, err)
+	}
+	return mockData, nil
+}
+
+func isDataFile(name string) bool {
+	switch filepath.Ext(name) {
+	case ".json", ".yaml", ".yml":
+		return true
+	}
+	return false
+}
+
+// listDataFiles returns data files under dir, sorted
+func listDataFiles(dir string) ([]string, error) {
+	var files []string
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			// skip hidden dirs like .git
+			if path != dir && strings.HasPrefix(info.Name(), ".") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if isDataFile(info.Name()) && !strings.HasPrefix(info.Name(), ".") {
+			files = append(files, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// addPackageFile adds functions of a package file, ext tells the format
+func (c *MockData) addPackageFile(pkg string, data []byte, ext string) error {
+	var err error
+	if ext != ".json" {
+		data, err = YAMLToJSON(data)
+		if err != nil {
+			return err
+		}
+	}
+	var funcs map[string]json.RawMessage
+	err = json.Unmarshal(data, &funcs)
+	if err != nil {
+		return err
+	}
+	for fn, v := range funcs {
+		v = bytes.TrimSpace(v)
+		if len(v) > 0 && v[0] == '[' {
+			var list []*RespErr
+			err = json.Unmarshal(v, &list)
+			if err != nil {
+				return fmt.Errorf("%s: %v", fn, err)
+			}
+			if c.MappingList == nil {
+				c.MappingList = make(map[string]map[string][]*RespErr)
+			}
+			if c.MappingList[pkg] == nil {
+				c.MappingList[pkg] = make(map[string][]*RespErr)
+			}
+			c.MappingList[pkg][fn] = list
+			continue
+		}
+		var respErr *RespErr
+		err = json.Unmarshal(v, &respErr)
+		if err != nil {
+			return fmt.Errorf("%s: %v", fn, err)
+		}
+		if c.Mapping == nil {
+			c.Mapping = make(map[string]map[string]*RespErr)
+		}
+		if c.Mapping[pkg] == nil {
+			c.Mapping[pkg] = make(map[string]*RespErr)
+		}
+		c.Mapping[pkg][fn] = respErr
+	}
+	return nil
+}
+
+// YAMLToJSON converts a YAML document to JSON
+func YAMLToJSON(data []byte) ([]byte, error) {
+	var v interface{}
+	err := yaml.Unmarshal(data, &v)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(toJSONValue(v))
+}
+
+// toJSONValue converts maps with non-string keys, which
+// json.Marshal does not accept, to map[string]interface{}
+func toJSONValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, e := range v {
+			v[k] = toJSONValue(e)
+		}
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, e := range v {
+			m[fmt.Sprint(k)] = toJSONValue(e)
+		}
+		return m
+	case []interface{}:
+		for i, e := range v {
+			v[i] = toJSONValue(e)
+		}
+	}
+	return v
+}
+
+// DirWatcher reloads a directory by LoadDir when any data file changes
+type DirWatcher struct {
+	dir      string
+	interval time.Duration
+	onLoad   func(mockData *MockData, err error)
+
+	stopOnce sync.Once
+	stop     chan struct{}
+	done     chan struct{}
+}
+
+// WatchDir loads dir, calls onLoad with the result, and calls it again each
+// time files of dir change, which is checked every interval.
+// The first load is done before WatchDir returns.
+func WatchDir(dir string, interval time.Duration, onLoad func(mockData *MockData, err error)) *DirWatcher {
+	if interval <= 0 {
+		interval = defaultWatchInterval
+	}
+	c := &DirWatcher{
+		dir:      dir,
+		interval: interval,
+		onLoad:   onLoad,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	stamp := c.stamp()
+	c.onLoad(LoadDir(dir))
+	go c.watch(stamp)
+	return c
+}
+
+// Stop stops watching, onLoad is not called after Stop returns
+func (c *DirWatcher) Stop() {
+	c.stopOnce.Do(func() {
+		close(c.stop)
+	})
+	<-c.done
+}
+
+func (c *DirWatcher) watch(stamp string) {
+	defer close(c.done)
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.stop:
+			return
+		case <-ticker.C:
+		}
+		newStamp := c.stamp()
+		if newStamp == stamp {
+			continue
+		}
+		stamp = newStamp
+		c.onLoad(LoadDir(c.dir))
+	}
+}
+
+// stamp summarizes names, sizes and modification times of data files
+func (c *DirWatcher) stamp() string {
+	files, err := listDataFiles(c.dir)
+	if err != nil {
+		return "error:" + err.Error()
+	}
+	var b strings.Builder
+	for _, file := range files {
+		info, err := os.Stat(file)
+		if err != nil {
+			continue
+		}
+		fmt.Fprintf(&b, "%s:%d:%d\n", file, info.Size(), info.ModTime().UnixNano())
+	}
+	return b.String()
+}
+
+// WatchDirFromEnv loads GO_MOCK_DATA_DIR as global mock data, and installs
+// GeneralMockInterceptor, see InstallInterceptor.
+// The data is swapped when files change, unless GO_MOCK_DATA_DIR_INTERVAL
+// is 0. Errors of reloading are printed, and the previous data is kept.
+func WatchDirFromEnv() (installed bool, err error) {
+	dir := os.Getenv(ENV_DATA_DIR)
+	if dir == "" {
+		return false, nil
+	}
+	interval := defaultWatchInterval
+	if s := os.Getenv(ENV_DATA_DIR_INTERVAL); s != "" {
+		interval, err = time.ParseDuration(s)
+		if err != nil {
+			return false, fmt.Errorf("%s: %v", ENV_DATA_DIR_INTERVAL, err)
+		}
+	}
+	if interval == 0 {
+		mockData, err := LoadDir(dir)
+		if err != nil {
+			return false, err
+		}
+		SetGlobalMockData(mockData)
+	} else {
+		var firstErr error
+		first := true
+		w := WatchDir(dir, interval, func(mockData *MockData, err error) {
+			defer func() { first = false }()
+			if err != nil {
+				if first {
+					firstErr = err
+				} else {
+					fmt.Fprintf(os.Stderr, "go-mock: reload %s: %v\n", dir, err)
+				}
+				return
+			}
+			SetGlobalMockData(mockData)
+		})
+		if firstErr != nil {
+			w.Stop()
+			return false, firstErr
+		}
+	}
+	InstallInterceptor()
+	return true, nil
+}
@@ -0,0 +1,113 @@
+package generalmock
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/xhd2015/go-mock/mock"
+)
+
+func writeFile(t *testing.T, file string, content string) {
+	err := os.MkdirAll(filepath.Dir(file), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ioutil.WriteFile(file, []byte(content), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// go test -run TestLoadDir -v ./generalmock
+func TestLoadDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "generalmock")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	writeFile(t, filepath.Join(dir, "test", "dao.yaml"), `
+Dao.Find:
+  - Match: {Paths: {$.id: 1}}
+    Resp: {name: user1}
+  - Match: {Subset: {id: 2}}
+    Error: NotFound
+`)
+	writeFile(t, filepath.Join(dir, "test", "rpc.json"), `{"Client.Get": {"Resp": {"name": "rpc"}}}`)
+	writeFile(t, filepath.Join(dir, "README.md"), `ignored`)
+
+	mockData, err := LoadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := len(mockData.MappingList["test/dao"]["Dao.Find"]); n != 2 {
+		t.Fatalf("expect %s = %+v, actual:%+v", `len(Dao.Find)`, 2, n)
+	}
+	if r := mockData.Mapping["test/rpc"]["Client.Get"]; r == nil || string(r.Resp) != `{"name": "rpc"}` {
+		t.Fatalf("expect %s = %+v, actual:%+v", `Client.Get`, `{"name": "rpc"}`, r)
+	}
+
+	ctx := mockData.Setup(context.Background())
+	h := mock.AddInterceptor(GeneralMockInterceptor)
+	defer h.Remove()
+	u, err := find(ctx, 1)
+	if err != nil || u.Name != "user1" {
+		t.Fatalf("expect %s = %+v, actual:%+v %v", `u.Name`, "user1", u, err)
+	}
+	_, err = find(ctx, 2)
+	if err == nil || err.Error() != "NotFound" {
+		t.Fatalf("expect %s = %+v, actual:%+v", `err`, "NotFound", err)
+	}
+
+	writeFile(t, filepath.Join(dir, "bad.yaml"), "a: [")
+	_, err = LoadDir(dir)
+	if err == nil {
+		t.Fatalf("expect %s = %+v, actual:%+v", `err`, "yaml error", err)
+	}
+	os.Remove(filepath.Join(dir, "bad.yaml"))
+
+	// malformed matchers are rejected when loaded
+	writeFile(t, filepath.Join(dir, "test", "match.json"), `{"Dao.Find": [{"Match": {"Paths": {"$.ids[x]": 1}}, "Resp": {}}]}`)
+	_, err = LoadDir(dir)
+	if err == nil || !strings.Contains(err.Error(), "test/match Dao.Find[0]") {
+		t.Fatalf("expect %s = %+v, actual:%+v", `err`, "invalid path", err)
+	}
+}
+
+// go test -run TestWatchDir -v ./generalmock
+func TestWatchDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "generalmock")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "test", "dao.json")
+	writeFile(t, file, `{"Dao.Find": {"Resp": {"name": "v1"}}}`)
+
+	loaded := make(chan *MockData, 10)
+	w := WatchDir(dir, 10*time.Millisecond, func(mockData *MockData, err error) {
+		if err != nil {
+			t.Errorf("load: %v", err)
+			return
+		}
+		loaded <- mockData
+	})
+	defer w.Stop()
+	if r := (<-loaded).Mapping["test/dao"]["Dao.Find"]; string(r.Resp) != `{"name": "v1"}` {
+		t.Fatalf("expect %s = %+v, actual:%+v", `Resp`, `{"name": "v1"}`, string(r.Resp))
+	}
+
+	writeFile(t, file, `{"Dao.Find": {"Resp": {"name": "v2"}}}`)
+	select {
+	case mockData := <-loaded:
+		if r := mockData.Mapping["test/dao"]["Dao.Find"]; string(r.Resp) != `{"name": "v2"}` {
+			t.Fatalf("expect %s = %+v, actual:%+v", `Resp`, `{"name": "v2"}`, string(r.Resp))
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("expect %s = %+v, actual:%+v", `reload`, true, false)
+	}
+}
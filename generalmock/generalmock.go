@@ -6,61 +6,79 @@ import (
 	"errors"
 	"fmt"
 	"reflect"
+	"sync"
+	"sync/atomic"
 
 	"github.com/xhd2015/go-mock/mock"
 )
 
-// PutLocal defines how to associate mockData with current goroutine
+// PutLocal defines how to associate mockData with current goroutine,
+// if nil, the ctx returned by Setup is associated by mock.SetupLocal
 var PutLocal func(mockData *MockData)
 
-// GetLocal defines how to get mockData associated with current goroutine
+// GetLocal defines how to get mockData associated with current goroutine,
+// if nil, mockData is taken from mock.GetLocalContext
 var GetLocal func() *MockData
 
 // Unmarshal defines how to unmarshal send-in data into memory structs
-var Unmarshal = func(data []byte, dst interface{}) error {
+var Unmarshal = jsonUnmarshal
+
+func jsonUnmarshal(data []byte, dst interface{}) error {
 	return json.Unmarshal(data, dst)
 }
 
+// RespErr is the result of a mocked call. Entries with Match are
+// only used by calls whose req matches, see Matcher.
 type RespErr struct {
+	Match *Matcher `json:",omitempty"`
 	Resp  json.RawMessage
 	Error string
 }
+
+// MockData is safe for concurrent use, calls are counted,
+// see Reset and Report.
 type MockData struct {
-	Mapping        map[string]map[string]*RespErr   `json:",omitempty"`
-	MappingList    map[string]map[string][]*RespErr `json:",omitempty"` // if multiple
-	requestCounter map[string]map[string]int
+	Mapping     map[string]map[string]*RespErr   `json:",omitempty"`
+	MappingList map[string]map[string][]*RespErr `json:",omitempty"` // if multiple
+
+	mutex          sync.Mutex
+	requestCounter map[string]map[string]int // calls taking unmatched entries of MappingList
+	hits           map[*RespErr]int
 }
 
 func GeneralMockInterceptor(ctx context.Context, stubInfo *mock.StubInfo, inst, req, resp interface{}, f mock.Filter, next func(ctx context.Context) error) error {
 	mockVal := GetGeneralMockData(ctx)
 	if mockVal != nil {
-		fnKey := stubInfo.Name
-		if stubInfo.Owner != "" {
-			fnKey = stubInfo.Owner + "." + stubInfo.Name
-		}
+		fnKey := funcKey(stubInfo)
+		reqMatcher := &reqMatcher{req: req}
 
 		var mockRes *RespErr
 		if respErrList, ok := mockVal.MappingList[stubInfo.PkgName][fnKey]; ok && len(respErrList) > 0 {
-			if mockVal.requestCounter == nil {
-				mockVal.requestCounter = make(map[string]map[string]int, 1)
+			var unmatched []*RespErr
+			var err error
+			mockRes, unmatched, err = matchRespErrs(respErrList, func(m *Matcher) (bool, error) {
+				return reqMatcher.match(stubInfo, m)
+			})
+			if err != nil {
+				return err
 			}
-			if mockVal.requestCounter[stubInfo.PkgName] == nil {
-				mockVal.requestCounter[stubInfo.PkgName] = make(map[string]int, 1)
+			if mockRes == nil && len(unmatched) > 0 {
+				mockRes = mockVal.takeNext(stubInfo.PkgName, fnKey, unmatched)
 			}
-			cnt := mockVal.requestCounter[stubInfo.PkgName][fnKey]
-			if cnt >= len(respErrList) {
-				if len(respErrList) > 0 {
-					// take the last
-					mockRes = respErrList[len(respErrList)-1]
-				}
-			} else {
-				mockRes = respErrList[cnt]
-			}
-			mockVal.requestCounter[stubInfo.PkgName][fnKey] = cnt + 1
 		} else {
 			mockRes = mockVal.Mapping[stubInfo.PkgName][fnKey]
+			if mockRes != nil && mockRes.Match != nil {
+				ok, err := reqMatcher.match(stubInfo, mockRes.Match)
+				if err != nil {
+					return err
+				}
+				if !ok {
+					mockRes = nil
+				}
+			}
 		}
 		if mockRes != nil {
+			mockVal.hit(mockRes)
 			if mockRes.Error != "" {
 				return errors.New(mockRes.Error)
 			}
@@ -77,6 +95,52 @@ func GeneralMockInterceptor(ctx context.Context, stubInfo *mock.StubInfo, inst,
 	return next(ctx)
 }
 
+// takeNext takes unmatched entries in turn, the last is
+// taken repeatedly once all are taken
+func (c *MockData) takeNext(pkg string, fnKey string, unmatched []*RespErr) *RespErr {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.requestCounter == nil {
+		c.requestCounter = make(map[string]map[string]int, 1)
+	}
+	if c.requestCounter[pkg] == nil {
+		c.requestCounter[pkg] = make(map[string]int, 1)
+	}
+	cnt := c.requestCounter[pkg][fnKey]
+	c.requestCounter[pkg][fnKey] = cnt + 1
+
+	if cnt >= len(unmatched) {
+		return unmatched[len(unmatched)-1]
+	}
+	return unmatched[cnt]
+}
+
+func (c *MockData) hit(respErr *RespErr) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.hits == nil {
+		c.hits = make(map[*RespErr]int, 1)
+	}
+	c.hits[respErr]++
+}
+
+// Reset clears counts of calls, so entries of MappingList
+// are taken from the first again, for reusing c in another test.
+func (c *MockData) Reset() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.requestCounter = nil
+	c.hits = nil
+}
+
+// funcKey is the key of a function in MockData
+func funcKey(stubInfo *mock.StubInfo) string {
+	if stubInfo.Owner != "" {
+		return stubInfo.Owner + "." + stubInfo.Name
+	}
+	return stubInfo.Name
+}
+
 type generalMockKeyType string
 
 const (
@@ -92,18 +156,37 @@ func (c *MockData) Setup(ctx context.Context) context.Context {
 	if c == nil {
 		return ctx
 	}
-	return context.WithValue(ctx, generalMockKey, c)
+	ctx = context.WithValue(ctx, generalMockKey, c)
+	if PutLocal == nil {
+		ctx = mock.SetupLocal(ctx)
+	}
+	return ctx
+}
+
+var globalMockData atomic.Value // *MockData
+
+// SetGlobalMockData sets mock data for all calls that
+// have no mock data in ctx or goroutine local.
+// Pass nil to clear.
+func SetGlobalMockData(mockData *MockData) {
+	globalMockData.Store(mockData)
 }
 
 func GetGeneralMockData(ctx context.Context) *MockData {
+	var mockData *MockData
 	if ctx == nil {
 		// fallback to ctx
 		if GetLocal != nil {
-			return GetLocal()
+			mockData = GetLocal()
+		} else if localCtx := mock.GetLocalContext(); localCtx != nil {
+			mockData, _ = localCtx.Value(generalMockKey).(*MockData)
 		}
-		return nil
+	} else {
+		mockData, _ = ctx.Value(generalMockKey).(*MockData)
+	}
+	if mockData == nil {
+		mockData, _ = globalMockData.Load().(*MockData)
 	}
-	mockData, _ := ctx.Value(generalMockKey).(*MockData)
 	return mockData
 }
 
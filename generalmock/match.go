@@ -0,0 +1,275 @@
+package generalmock
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/xhd2015/go-mock/inspect/serialize"
+	"github.com/xhd2015/go-mock/mock"
+)
+
+// Matcher tests the req of a call, as serialized into a JSON object
+// keyed by argument names, like Record.Req.
+// Subset, if set, must be a JSON subset of req, see mock.IsJSONSubset.
+// Paths, if set, maps simple JSONPaths to values equal to the value
+// found in req, paths are like `$.user.id` or `ids[0]`.
+// Example:
+//
+//	{
+//	  "MappingList": {
+//	    "example.com/dao": {
+//	      "Dao.GetUser": [
+//	        {"Match": {"Paths": {"$.id": 1}}, "Resp": {"id": 1, "name": "alice"}},
+//	        {"Match": {"Subset": {"id": 2}}, "Error": "NotFound"},
+//	        {"Resp": null}
+//	      ]
+//	    }
+//	  }
+//	}
+type Matcher struct {
+	Subset json.RawMessage            `json:",omitempty"`
+	Paths  map[string]json.RawMessage `json:",omitempty"`
+
+	compileOnce sync.Once
+	compiled    *compiledMatcher
+	compileErr  error
+}
+
+// compiledMatcher is Matcher with Subset and Paths parsed
+type compiledMatcher struct {
+	hasSubset bool
+	subset    interface{}
+	paths     []*compiledPath
+}
+
+type compiledPath struct {
+	path  string
+	steps []pathStep
+	value interface{}
+}
+
+// pathStep is a child name, or an array index if name is empty
+type pathStep struct {
+	name  string
+	index int
+}
+
+// Compile parses Subset and Paths once, and reports malformed ones.
+// Match compiles c on first use, MockData.Validate compiles all
+// matchers, so errors are reported when mock data is loaded.
+func (c *Matcher) Compile() error {
+	c.compileOnce.Do(func() {
+		c.compiled, c.compileErr = c.compile()
+	})
+	return c.compileErr
+}
+
+func (c *Matcher) compile() (*compiledMatcher, error) {
+	m := &compiledMatcher{}
+	if len(c.Subset) > 0 {
+		err := json.Unmarshal(c.Subset, &m.subset)
+		if err != nil {
+			return nil, fmt.Errorf("subset: %v", err)
+		}
+		m.hasSubset = true
+	}
+	paths := make([]string, 0, len(c.Paths))
+	for path := range c.Paths {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		steps, err := parseJSONPath(path)
+		if err != nil {
+			return nil, err
+		}
+		p := &compiledPath{path: path, steps: steps}
+		err = json.Unmarshal(c.Paths[path], &p.value)
+		if err != nil {
+			return nil, fmt.Errorf("path %s: %v", path, err)
+		}
+		m.paths = append(m.paths, p)
+	}
+	return m, nil
+}
+
+// Match tells whether req, a JSON value decoded into interface{}, matches c
+func (c *Matcher) Match(req interface{}) (bool, error) {
+	err := c.Compile()
+	if err != nil {
+		return false, err
+	}
+	m := c.compiled
+	if m.hasSubset && !mock.IsJSONSubset(m.subset, req) {
+		return false, nil
+	}
+	for _, p := range m.paths {
+		actual, ok := lookupSteps(req, p.steps)
+		if !ok || !reflect.DeepEqual(p.value, actual) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// LookupJSONPath finds the value at path in v, a JSON value decoded into
+// interface{}. Only child names and array indexes are supported, like
+// `$.items[0].name`, the leading `$` is optional.
+func LookupJSONPath(v interface{}, path string) (val interface{}, ok bool, err error) {
+	steps, err := parseJSONPath(path)
+	if err != nil {
+		return nil, false, err
+	}
+	val, ok = lookupSteps(v, steps)
+	return val, ok, nil
+}
+
+func parseJSONPath(path string) ([]pathStep, error) {
+	var steps []pathStep
+	p := strings.TrimPrefix(path, "$")
+	for p != "" {
+		switch p[0] {
+		case '.':
+			p = p[1:]
+			end := strings.IndexAny(p, ".[")
+			if end < 0 {
+				end = len(p)
+			}
+			name := p[:end]
+			if name == "" {
+				return nil, fmt.Errorf("invalid path %s: empty name", path)
+			}
+			p = p[end:]
+			steps = append(steps, pathStep{name: name})
+		case '[':
+			end := strings.IndexByte(p, ']')
+			if end < 0 {
+				return nil, fmt.Errorf("invalid path %s: missing ]", path)
+			}
+			idx, err := strconv.Atoi(p[1:end])
+			if err != nil {
+				return nil, fmt.Errorf("invalid path %s: %v", path, err)
+			}
+			p = p[end+1:]
+			steps = append(steps, pathStep{index: idx})
+		default:
+			// a leading name without `$.`
+			p = "." + p
+		}
+	}
+	return steps, nil
+}
+
+func lookupSteps(v interface{}, steps []pathStep) (interface{}, bool) {
+	for _, step := range steps {
+		if step.name != "" {
+			m, isMap := v.(map[string]interface{})
+			if !isMap {
+				return nil, false
+			}
+			var ok bool
+			if v, ok = m[step.name]; !ok {
+				return nil, false
+			}
+			continue
+		}
+		list, isList := v.([]interface{})
+		if !isList || step.index < 0 || step.index >= len(list) {
+			return nil, false
+		}
+		v = list[step.index]
+	}
+	return v, true
+}
+
+// Validate compiles matchers of all entries, so malformed ones are
+// reported when mock data is loaded, instead of failing calls
+func (c *MockData) Validate() error {
+	var errs []string
+	for pkg, funcs := range c.Mapping {
+		for fn, respErr := range funcs {
+			if respErr == nil || respErr.Match == nil {
+				continue
+			}
+			if err := respErr.Match.Compile(); err != nil {
+				errs = append(errs, fmt.Sprintf("%s %s: %v", pkg, fn, err))
+			}
+		}
+	}
+	for pkg, funcs := range c.MappingList {
+		for fn, list := range funcs {
+			for i, respErr := range list {
+				if respErr == nil || respErr.Match == nil {
+					continue
+				}
+				if err := respErr.Match.Compile(); err != nil {
+					errs = append(errs, fmt.Sprintf("%s %s[%d]: %v", pkg, fn, i, err))
+				}
+			}
+		}
+	}
+	if len(errs) == 0 {
+		return nil
+	}
+	sort.Strings(errs)
+	return fmt.Errorf("invalid match: %s", strings.Join(errs, "; "))
+}
+
+// matchRespErrs returns the first entry whose Match matches, if none,
+// returns entries without Match, which are taken in turn.
+func matchRespErrs(list []*RespErr, match func(m *Matcher) (bool, error)) (matched *RespErr, unmatched []*RespErr, err error) {
+	hasMatcher := false
+	for _, respErr := range list {
+		if respErr == nil || respErr.Match == nil {
+			continue
+		}
+		hasMatcher = true
+		ok, err := match(respErr.Match)
+		if err != nil {
+			return nil, nil, err
+		}
+		if ok {
+			return respErr, nil, nil
+		}
+	}
+	if !hasMatcher {
+		return nil, list, nil
+	}
+	for _, respErr := range list {
+		if respErr == nil || respErr.Match == nil {
+			unmatched = append(unmatched, respErr)
+		}
+	}
+	return nil, unmatched, nil
+}
+
+// reqMatcher serializes req on first use, and matches it against entries
+type reqMatcher struct {
+	req     interface{}
+	decoded bool
+	val     interface{}
+}
+
+func (c *reqMatcher) match(stubInfo *mock.StubInfo, m *Matcher) (bool, error) {
+	if !c.decoded {
+		data, err := serialize.Marshal(c.req)
+		if err != nil {
+			return false, fmt.Errorf("match %s: serialize req error:%v", stubInfo.String(), err)
+		}
+		err = json.Unmarshal(data, &c.val)
+		if err != nil {
+			return false, fmt.Errorf("match %s: decode req error:%v", stubInfo.String(), err)
+		}
+		c.decoded = true
+	}
+	ok, err := m.Match(c.val)
+	if err != nil {
+		return false, fmt.Errorf("match %s: %v", stubInfo.String(), err)
+	}
+	return ok, nil
+}
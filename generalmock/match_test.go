@@ -0,0 +1,135 @@
+package generalmock
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/xhd2015/go-mock/mock"
+)
+
+// go test -run TestMatchReq -v ./generalmock
+func TestMatchReq(t *testing.T) {
+	var mockData MockData
+	err := json.Unmarshal([]byte(`{
+		"MappingList": {
+			"test/dao": {
+				"Dao.Find": [
+					{"Match": {"Paths": {"$.id": 1}}, "Resp": {"name": "user1"}},
+					{"Match": {"Subset": {"id": 2}}, "Error": "NotFound"},
+					{"Resp": {"name": "other1"}},
+					{"Resp": {"name": "other2"}}
+				]
+			}
+		}
+	}`), &mockData)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := mockData.Setup(context.Background())
+	h := mock.AddInterceptor(GeneralMockInterceptor)
+	defer h.Remove()
+
+	for i := 0; i < 2; i++ {
+		u, err := find(ctx, 1)
+		if err != nil || u.Name != "user1" {
+			t.Fatalf("expect %s = %+v, actual:%+v %v", `u.Name`, "user1", u, err)
+		}
+		_, err = find(ctx, 2)
+		if err == nil || err.Error() != "NotFound" {
+			t.Fatalf("expect %s = %+v, actual:%+v", `err`, "NotFound", err)
+		}
+	}
+	// unmatched calls take unmatched entries in turn
+	for _, expect := range []string{"other1", "other2", "other2"} {
+		u, err := find(ctx, 3)
+		if err != nil || u.Name != expect {
+			t.Fatalf("expect %s = %+v, actual:%+v %v", `u.Name`, expect, u, err)
+		}
+	}
+}
+
+// go test -run TestMatchMapping -v ./generalmock
+func TestMatchMapping(t *testing.T) {
+	mockData := &MockData{Mapping: map[string]map[string]*RespErr{
+		"test/dao": {
+			"Dao.Find": {Match: &Matcher{Subset: json.RawMessage(`{"id":1}`)}, Resp: json.RawMessage(`{"name":"user1"}`)},
+		},
+	}}
+	ctx := mockData.Setup(context.Background())
+	h := mock.AddInterceptor(GeneralMockInterceptor)
+	defer h.Remove()
+
+	u, err := find(ctx, 1)
+	if err != nil || u.Name != "user1" {
+		t.Fatalf("expect %s = %+v, actual:%+v %v", `u.Name`, "user1", u, err)
+	}
+	// not matched, call the real one
+	u, err = find(ctx, 2)
+	if err != nil || u.Name != "real" {
+		t.Fatalf("expect %s = %+v, actual:%+v %v", `u.Name`, "real", u, err)
+	}
+}
+
+// go test -run TestMatchInvalid -v ./generalmock
+func TestMatchInvalid(t *testing.T) {
+	mockData := &MockData{Mapping: map[string]map[string]*RespErr{
+		"test/dao": {
+			"Dao.Find": {Match: &Matcher{Subset: json.RawMessage(`{"id":`)}, Resp: json.RawMessage(`{"name":"user1"}`)},
+		},
+	}, MappingList: map[string]map[string][]*RespErr{
+		"test/dao": {
+			"Dao.List": {{Match: &Matcher{Paths: map[string]json.RawMessage{"$.ids[0": json.RawMessage(`1`)}}}},
+		},
+	}}
+	err := mockData.Validate()
+	if err == nil || !strings.Contains(err.Error(), "test/dao Dao.Find: subset") || !strings.Contains(err.Error(), "test/dao Dao.List[0]: invalid path") {
+		t.Fatalf("expect %s = %+v, actual:%+v", `err`, "subset and path errors", err)
+	}
+
+	// not validated, the call fails instead of panicking
+	ctx := mockData.Setup(context.Background())
+	h := mock.AddInterceptor(GeneralMockInterceptor)
+	defer h.Remove()
+	_, err = find(ctx, 1)
+	if err == nil || !strings.Contains(err.Error(), "subset") {
+		t.Fatalf("expect %s = %+v, actual:%+v", `err`, "subset error", err)
+	}
+}
+
+// go test -run TestLookupJSONPath -v ./generalmock
+func TestLookupJSONPath(t *testing.T) {
+	var v interface{}
+	err := json.Unmarshal([]byte(`{"user":{"id":1,"tags":["a","b"]},"items":[{"name":"x"}]}`), &v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		path   string
+		expect interface{}
+		ok     bool
+	}{
+		{"$.user.id", float64(1), true},
+		{"user.tags[1]", "b", true},
+		{"$.items[0].name", "x", true},
+		{"$.items[1].name", nil, false},
+		{"$.user.name", nil, false},
+		{"$", v, true},
+	}
+	for _, tt := range tests {
+		val, ok, err := LookupJSONPath(v, tt.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ok != tt.ok || (ok && tt.path != "$" && val != tt.expect) {
+			t.Fatalf("expect %s = %+v, actual:%+v", tt.path, tt.expect, val)
+		}
+	}
+	for _, path := range []string{"$.items[x]", "$.items[0", "$..a"} {
+		_, _, err := LookupJSONPath(v, path)
+		if err == nil {
+			t.Fatalf("expect %s = %+v, actual:%+v", path+" err", "invalid path", err)
+		}
+	}
+}
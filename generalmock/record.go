@@ -0,0 +1,254 @@
+package generalmock
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/xhd2015/go-mock/inspect/serialize"
+	"github.com/xhd2015/go-mock/mock"
+)
+
+const (
+	// ENV_RECORD_FILE records calls into the file
+	ENV_RECORD_FILE = "GO_MOCK_RECORD_FILE"
+	// ENV_RECORD_FILTER comma separated patterns of calls to be recorded, see mock.Pattern.
+	// If not set, all calls are recorded.
+	ENV_RECORD_FILTER = "GO_MOCK_RECORD_FILTER"
+	// ENV_REPLAY_FILE replays records in the file as global mock data
+	ENV_REPLAY_FILE = "GO_MOCK_REPLAY_FILE"
+)
+
+// Record is a recorded call, a record file contains one JSON record per line.
+// Resp has the same shape as RespErr.Resp: the only result if the function
+// has one result besides error, or an object of all results otherwise.
+type Record struct {
+	Pkg   string          `json:"pkg"`
+	Func  string          `json:"func"` // Name or Owner.Name
+	Req   json.RawMessage `json:"req,omitempty"`
+	Resp  json.RawMessage `json:"resp,omitempty"`
+	Error string          `json:"error,omitempty"`
+}
+
+// CallRecorder writes calls matching its patterns to w
+type CallRecorder struct {
+	patterns []*mock.Pattern
+
+	mutex sync.Mutex
+	w     io.Writer
+}
+
+// NewCallRecorder creates a recorder, if no patterns given, all calls are recorded.
+func NewCallRecorder(w io.Writer, patterns ...string) (*CallRecorder, error) {
+	c := &CallRecorder{w: w}
+	for _, pattern := range patterns {
+		p, err := mock.ParsePattern(pattern)
+		if err != nil {
+			return nil, err
+		}
+		c.patterns = append(c.patterns, p)
+	}
+	return c, nil
+}
+
+// Install adds the interceptor of c, until remove is called
+func (c *CallRecorder) Install() (remove func()) {
+	return mock.AddInterceptor(c.Interceptor).Remove
+}
+
+// Interceptor records calls after they finish, panics are not recorded.
+func (c *CallRecorder) Interceptor(ctx context.Context, stubInfo *mock.StubInfo, inst, req, resp interface{}, f mock.Filter, next func(ctx context.Context) error) error {
+	err := next(ctx)
+	if !c.match(stubInfo) {
+		return err
+	}
+	record, merr := NewRecord(stubInfo, req, resp, err)
+	if merr != nil {
+		fmt.Fprintf(os.Stderr, "go-mock: record %s: %v\n", stubInfo.String(), merr)
+		return err
+	}
+	c.write(record)
+	return err
+}
+
+func (c *CallRecorder) match(stubInfo *mock.StubInfo) bool {
+	if len(c.patterns) == 0 {
+		return true
+	}
+	for _, p := range c.patterns {
+		if p.Match(stubInfo) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *CallRecorder) write(record *Record) {
+	data, err := json.Marshal(record)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "go-mock: record %s.%s: %v\n", record.Pkg, record.Func, err)
+		return
+	}
+	data = append(data, '\n')
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	_, err = c.w.Write(data)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "go-mock: write record: %v\n", err)
+	}
+}
+
+// NewRecord converts a finished call into a record
+func NewRecord(stubInfo *mock.StubInfo, req interface{}, resp interface{}, err error) (*Record, error) {
+	reqData, merr := serialize.Marshal(req)
+	if merr != nil {
+		return nil, merr
+	}
+	record := &Record{
+		Pkg:  stubInfo.PkgName,
+		Func: funcKey(stubInfo),
+		Req:  reqData,
+	}
+	if err != nil {
+		record.Error = err.Error()
+		return record, nil
+	}
+	v := reflect.ValueOf(resp).Elem()
+	switch v.NumField() {
+	case 0:
+		// non-empty to be distinguished from missing
+		record.Resp = json.RawMessage("null")
+	case 1:
+		record.Resp, merr = serialize.Marshal(v.Field(0).Interface())
+	default:
+		record.Resp, merr = serialize.Marshal(resp)
+	}
+	if merr != nil {
+		return nil, merr
+	}
+	return record, nil
+}
+
+// LoadRecords reads records line by line
+func LoadRecords(r io.Reader) ([]*Record, error) {
+	var records []*Record
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		data := strings.TrimSpace(scanner.Text())
+		if data == "" {
+			continue
+		}
+		var record Record
+		err := json.Unmarshal([]byte(data), &record)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", line, err)
+		}
+		records = append(records, &record)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return records, nil
+}
+
+// NewMockDataFromRecords converts records into MappingList,
+// calls of the same function are replayed in recorded order.
+func NewMockDataFromRecords(records []*Record) *MockData {
+	mockData := &MockData{MappingList: make(map[string]map[string][]*RespErr)}
+	for _, record := range records {
+		m := mockData.MappingList[record.Pkg]
+		if m == nil {
+			m = make(map[string][]*RespErr)
+			mockData.MappingList[record.Pkg] = m
+		}
+		m[record.Func] = append(m[record.Func], &RespErr{
+			Resp:  record.Resp,
+			Error: record.Error,
+		})
+	}
+	return mockData
+}
+
+func LoadRecordFile(file string) (*MockData, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	records, err := LoadRecords(f)
+	if err != nil {
+		return nil, fmt.Errorf("load %s: %v", file, err)
+	}
+	return NewMockDataFromRecords(records), nil
+}
+
+// RecordFromEnv installs a recorder configured by GO_MOCK_RECORD_FILE
+// and GO_MOCK_RECORD_FILTER, records are appended to the file.
+func RecordFromEnv() (installed bool, err error) {
+	file := os.Getenv(ENV_RECORD_FILE)
+	if file == "" {
+		return false, nil
+	}
+	var patterns []string
+	for _, p := range strings.Split(os.Getenv(ENV_RECORD_FILTER), ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			patterns = append(patterns, p)
+		}
+	}
+	f, err := os.OpenFile(file, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return false, err
+	}
+	recorder, err := NewCallRecorder(f, patterns...)
+	if err != nil {
+		f.Close()
+		return false, err
+	}
+	recorder.Install()
+	return true, nil
+}
+
+// ReplayFromEnv loads GO_MOCK_REPLAY_FILE as global mock data,
+// and installs GeneralMockInterceptor, see InstallInterceptor.
+func ReplayFromEnv() (installed bool, err error) {
+	file := os.Getenv(ENV_REPLAY_FILE)
+	if file == "" {
+		return false, nil
+	}
+	mockData, err := LoadRecordFile(file)
+	if err != nil {
+		return false, err
+	}
+	err = mockData.Validate()
+	if err != nil {
+		return false, fmt.Errorf("load %s: %v", file, err)
+	}
+	SetGlobalMockData(mockData)
+	InstallInterceptor()
+	return true, nil
+}
+
+var installOnce sync.Once
+
+// InstallInterceptor installs GeneralMockInterceptor once, for global
+// mock data loaded from files or sent by the admin server, whose values
+// are written by serialize.Marshal. So Unmarshal is set to
+// serialize.Unmarshal, unless it has been replaced by the user.
+func InstallInterceptor() {
+	installOnce.Do(func() {
+		if reflect.ValueOf(Unmarshal).Pointer() == reflect.ValueOf(jsonUnmarshal).Pointer() {
+			Unmarshal = serialize.Unmarshal
+		}
+		mock.AddInterceptor(GeneralMockInterceptor)
+	})
+}
@@ -0,0 +1,98 @@
+package generalmock
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/xhd2015/go-mock/mock"
+)
+
+type user struct {
+	Name string `json:"name"`
+}
+
+var findStub = &mock.StubInfo{PkgName: "test/dao", Owner: "Dao", Name: "Find"}
+
+var findErr error
+
+// simulate the rewritten code
+func find(ctx context.Context, id int) (u *user, err error) {
+	var _mockreq = struct {
+		ID int `json:"id"`
+	}{ID: id}
+	var _mockresp struct {
+		U *user `json:"u"`
+	}
+	err = mock.TrapFunc(ctx, findStub, nil, &_mockreq, &_mockresp, _mockfind, false, true, true)
+	u = _mockresp.U
+	return
+}
+func _mockfind(ctx context.Context, id int) (u *user, err error) {
+	if findErr != nil {
+		return nil, findErr
+	}
+	return &user{Name: "real"}, nil
+}
+
+// go test -run TestRecordReplay -v ./generalmock
+func TestRecordReplay(t *testing.T) {
+	var buf bytes.Buffer
+	recorder, err := NewCallRecorder(&buf, "test/dao::Dao::*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	remove := recorder.Install()
+	find(context.Background(), 1)
+	findErr = errors.New("not found")
+	find(context.Background(), 2)
+	findErr = nil
+	remove()
+
+	records, err := LoadRecords(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 {
+		t.Fatalf("expect %s = %+v, actual:%+v", `len(records)`, 2, len(records))
+	}
+	if s := string(records[0].Resp); s != `{"name":"real"}` {
+		t.Fatalf("expect %s = %+v, actual:%+v", `records[0].Resp`, `{"name":"real"}`, s)
+	}
+
+	records[0].Resp = []byte(`{"name":"replayed"}`)
+	ctx := NewMockDataFromRecords(records).Setup(context.Background())
+	h := mock.AddInterceptor(GeneralMockInterceptor)
+	defer h.Remove()
+
+	u, err := find(ctx, 1)
+	if err != nil || u.Name != "replayed" {
+		t.Fatalf("expect %s = %+v, actual:%+v %v", `u.Name`, "replayed", u, err)
+	}
+	_, err = find(ctx, 2)
+	if err == nil || err.Error() != "not found" {
+		t.Fatalf("expect %s = %+v, actual:%+v", `err`, "not found", err)
+	}
+}
+
+// go test -run TestInstallInterceptorKeepUnmarshal -v ./generalmock
+func TestInstallInterceptorKeepUnmarshal(t *testing.T) {
+	old := Unmarshal
+	defer func() { Unmarshal = old }()
+	var called bool
+	Unmarshal = func(data []byte, dst interface{}) error {
+		called = true
+		return jsonUnmarshal(data, dst)
+	}
+	InstallInterceptor()
+
+	var v int
+	err := Unmarshal([]byte("1"), &v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !called {
+		t.Fatalf("expect %s = %+v, actual:%+v", `called`, true, called)
+	}
+}
@@ -0,0 +1,112 @@
+package generalmock
+
+import (
+	"context"
+	"fmt"
+	"sort"
+)
+
+const (
+	// PROBLEM_UNUSED the entry was never returned
+	PROBLEM_UNUSED = "unused"
+	// PROBLEM_OVER_CONSUMED calls of a MappingList outnumbered its entries
+	// without Match, so the last was returned repeatedly
+	PROBLEM_OVER_CONSUMED = "over_consumed"
+)
+
+// ReportEntry is a problem of an entry found by Report
+type ReportEntry struct {
+	Pkg     string `json:"pkg"`
+	Func    string `json:"func"`  // Name or Owner.Name
+	Index   int    `json:"index"` // index in MappingList, -1 for Mapping
+	Problem string `json:"problem"`
+	Calls   int    `json:"calls,omitempty"` // calls beyond entries, for PROBLEM_OVER_CONSUMED
+}
+
+func (c *ReportEntry) String() string {
+	name := c.Pkg + "." + c.Func
+	if c.Index >= 0 {
+		name = fmt.Sprintf("%s[%d]", name, c.Index)
+	}
+	if c.Problem == PROBLEM_OVER_CONSUMED {
+		return fmt.Sprintf("%s: over consumed by %d calls", name, c.Calls)
+	}
+	return fmt.Sprintf("%s: %s", name, c.Problem)
+}
+
+// Report lists entries never returned since creation or last Reset,
+// and MappingList over consumed, ordered by package and function.
+func (c *MockData) Report() []*ReportEntry {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	var entries []*ReportEntry
+	for pkg, m := range c.Mapping {
+		for fn, respErr := range m {
+			if respErr != nil && c.hits[respErr] == 0 {
+				entries = append(entries, &ReportEntry{Pkg: pkg, Func: fn, Index: -1, Problem: PROBLEM_UNUSED})
+			}
+		}
+	}
+	for pkg, m := range c.MappingList {
+		for fn := range m {
+			lastUnmatched := -1
+			numUnmatched := 0
+			for i, respErr := range m[fn] {
+				if respErr == nil || respErr.Match == nil {
+					lastUnmatched = i
+					numUnmatched++
+				}
+				if respErr != nil && c.hits[respErr] == 0 {
+					entries = append(entries, &ReportEntry{Pkg: pkg, Func: fn, Index: i, Problem: PROBLEM_UNUSED})
+				}
+			}
+			if calls := c.requestCounter[pkg][fn]; numUnmatched > 0 && calls > numUnmatched {
+				entries = append(entries, &ReportEntry{Pkg: pkg, Func: fn, Index: lastUnmatched, Problem: PROBLEM_OVER_CONSUMED, Calls: calls - numUnmatched})
+			}
+		}
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		a, b := entries[i], entries[j]
+		if a.Pkg != b.Pkg {
+			return a.Pkg < b.Pkg
+		}
+		if a.Func != b.Func {
+			return a.Func < b.Func
+		}
+		return a.Index < b.Index
+	})
+	return entries
+}
+
+// TestingT is the subset of *testing.T used by Check
+type TestingT interface {
+	Helper()
+	Errorf(format string, args ...interface{})
+}
+
+// Check fails t with each problem of Report, returns true if none.
+// Usage:
+//
+//	ctx := mockData.Setup(context.Background())
+//	defer mockData.Check(t)
+func (c *MockData) Check(t TestingT) bool {
+	t.Helper()
+	entries := c.Report()
+	for _, e := range entries {
+		t.Errorf("mock data %s", e.String())
+	}
+	return len(entries) == 0
+}
+
+// SetupT is like Setup, and checks c when the test finishes
+// if t supports Cleanup(go1.14+), otherwise Check should be
+// deferred explicitly.
+func (c *MockData) SetupT(t TestingT, ctx context.Context) context.Context {
+	if cleanup, ok := t.(interface{ Cleanup(func()) }); ok {
+		cleanup.Cleanup(func() {
+			c.Check(t)
+		})
+	}
+	return c.Setup(ctx)
+}
@@ -0,0 +1,116 @@
+package generalmock
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/xhd2015/go-mock/mock"
+)
+
+type fakeT struct {
+	errors []string
+}
+
+func (c *fakeT) Helper() {}
+func (c *fakeT) Errorf(format string, args ...interface{}) {
+	c.errors = append(c.errors, fmt.Sprintf(format, args...))
+}
+
+func newReportMockData(t *testing.T) *MockData {
+	var mockData MockData
+	err := json.Unmarshal([]byte(`{
+		"Mapping": {
+			"test/dao": {"Dao.Count": {"Resp": 1}}
+		},
+		"MappingList": {
+			"test/dao": {
+				"Dao.Find": [
+					{"Match": {"Paths": {"id": 1}}, "Resp": {"name": "user1"}},
+					{"Resp": {"name": "first"}},
+					{"Resp": {"name": "second"}}
+				]
+			}
+		}
+	}`), &mockData)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &mockData
+}
+
+// go test -run TestReport -v ./generalmock
+func TestReport(t *testing.T) {
+	mockData := newReportMockData(t)
+	ctx := mockData.Setup(context.Background())
+	h := mock.AddInterceptor(GeneralMockInterceptor)
+	defer h.Remove()
+
+	report := func() string {
+		var s []string
+		for _, e := range mockData.Report() {
+			s = append(s, e.String())
+		}
+		return fmt.Sprint(s)
+	}
+	expect := "[test/dao.Dao.Count: unused test/dao.Dao.Find[0]: unused test/dao.Dao.Find[1]: unused test/dao.Dao.Find[2]: unused]"
+	if r := report(); r != expect {
+		t.Fatalf("expect %s = %+v, actual:%+v", "report", expect, r)
+	}
+
+	find(ctx, 1)
+	find(ctx, 2)
+	expect = "[test/dao.Dao.Count: unused test/dao.Dao.Find[2]: unused]"
+	if r := report(); r != expect {
+		t.Fatalf("expect %s = %+v, actual:%+v", "report", expect, r)
+	}
+
+	for i := 0; i < 3; i++ {
+		find(ctx, 2)
+	}
+	expect = "[test/dao.Dao.Count: unused test/dao.Dao.Find[2]: over consumed by 2 calls]"
+	if r := report(); r != expect {
+		t.Fatalf("expect %s = %+v, actual:%+v", "report", expect, r)
+	}
+
+	var ft fakeT
+	if mockData.Check(&ft) || len(ft.errors) != 2 {
+		t.Fatalf("expect %s = %+v, actual:%+v", "Check errors", 2, ft.errors)
+	}
+
+	// taken from the first again
+	mockData.Reset()
+	u, _ := find(ctx, 2)
+	if u.Name != "first" {
+		t.Fatalf("expect %s = %+v, actual:%+v", "u.Name", "first", u.Name)
+	}
+}
+
+// go test -run TestConcurrentCalls -race -v ./generalmock
+func TestConcurrentCalls(t *testing.T) {
+	mockData := newReportMockData(t)
+	SetGlobalMockData(mockData)
+	defer SetGlobalMockData(nil)
+	h := mock.AddInterceptor(GeneralMockInterceptor)
+	defer h.Remove()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(id int) {
+			defer wg.Done()
+			find(context.Background(), id%3)
+		}(i)
+	}
+	wg.Wait()
+
+	mockData.mutex.Lock()
+	calls := mockData.requestCounter["test/dao"]["Dao.Find"]
+	mockData.mutex.Unlock()
+	// ids 0 and 2 take unmatched entries
+	if calls != 13 {
+		t.Fatalf("expect %s = %+v, actual:%+v", "calls", 13, calls)
+	}
+}
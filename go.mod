@@ -4,4 +4,5 @@ go 1.13
 
 require (
 	golang.org/x/tools v0.1.11
+	gopkg.in/yaml.v3 v3.0.1
 )
@@ -0,0 +1,53 @@
+package inspect
+
+import (
+	"go/ast"
+	"go/token"
+	"go/types"
+
+	"github.com/xhd2015/go-mock/code/edit"
+	"golang.org/x/tools/go/packages"
+)
+
+// MOCK_CLOCK_PKG provides the virtual clock that time functions
+// are redirected to, see RewriteOptions.VirtualClock
+const MOCK_CLOCK_PKG = "github.com/xhd2015/go-mock/mock/clock"
+
+// clockFuncs are functions of the time package with a
+// replacement of the same signature in MOCK_CLOCK_PKG
+var clockFuncs = map[string]bool{
+	"Now":      true,
+	"Since":    true,
+	"Sleep":    true,
+	"After":    true,
+	"NewTimer": true,
+}
+
+// clockTimerMethods maps methods of *time.Timer to their replacement,
+// which takes the timer as the first argument
+var clockTimerMethods = map[string]string{
+	"Stop":  "StopTimer",
+	"Reset": "ResetTimer",
+}
+
+// rewriteClockRef redirects a reference to time functions in clockFuncs:
+//     time.Now()
+// becomes
+//     _mockclock.Now()
+// Returns the name of the time package referenced, or "" if sel
+// is not such a reference.
+func rewriteClockRef(pkg *packages.Package, fset *token.FileSet, sel *ast.SelectorExpr, buf *edit.Buffer, getClockRef func() string) string {
+	if !clockFuncs[sel.Sel.Name] {
+		return ""
+	}
+	idt, ok := sel.X.(*ast.Ident)
+	if !ok {
+		return ""
+	}
+	pkgName, ok := pkg.TypesInfo.Uses[idt].(*types.PkgName)
+	if !ok || pkgName.Imported().Path() != "time" {
+		return ""
+	}
+	buf.Replace(OffsetOf(fset, idt.Pos()), OffsetOf(fset, idt.End()), getClockRef())
+	return idt.Name
+}
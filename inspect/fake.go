@@ -0,0 +1,272 @@
+package inspect
+
+import (
+	"fmt"
+	"go/types"
+	"strconv"
+	"strings"
+
+	"github.com/xhd2015/go-mock/code/gen"
+	"golang.org/x/tools/go/packages"
+)
+
+// fakeVar is a param or result of an interface method
+type fakeVar struct {
+	Name         string
+	ExportedName string
+	Type         string // as in signature, with ... if variadic
+	StructType   string // as in struct, [] if variadic
+	TypeRef      string // the type used in reflect.TypeOf((*T)(nil))
+}
+
+type fakeMethod struct {
+	Name       string
+	Params     []*fakeVar
+	Results    []*fakeVar
+	Variadic   bool
+	FirstIsCtx bool
+	LastIsErr  bool
+}
+
+// genInterfaceFakes generates FakeX for each exported interface X of p,
+// FakeX has a func field XFunc for each method X, when the field is nil
+// the method acts by the Fallback field.
+// Methods are trapped like rewritten functions, with owner X.
+// Template variables __MOCKP__ and __REFLECTP__ are left in the result.
+func genInterfaceFakes(p *packages.Package, qualifier types.Qualifier) (fakes gen.Statements, regs gen.Statements, n int) {
+	scope := p.Types.Scope()
+	for _, name := range scope.Names() {
+		tn, ok := scope.Lookup(name).(*types.TypeName)
+		if !ok || tn.IsAlias() || !tn.Exported() {
+			continue
+		}
+		named, ok := tn.Type().(*types.Named)
+		if !ok || named.TypeParams().Len() > 0 {
+			continue
+		}
+		iface, ok := named.Underlying().(*types.Interface)
+		if !ok || !iface.IsMethodSet() || iface.NumMethods() == 0 || !canFake(iface, moduleOf(p)) {
+			continue
+		}
+		methods := make([]*fakeMethod, 0, iface.NumMethods())
+		for i := 0; i < iface.NumMethods(); i++ {
+			m := iface.Method(i)
+			methods = append(methods, newFakeMethod(m.Name(), m.Type().(*types.Signature), qualifier))
+		}
+		ifaceRef := qualifier(p.Types) + "." + name
+		fakes.Append(genFake(name, ifaceRef, methods), "")
+		regs.Append(genFakeReg(name, ifaceRef, methods))
+		n++
+	}
+	return
+}
+
+// canFake tells whether a fake can be defined outside the package
+func canFake(iface *types.Interface, importer string) bool {
+	names := make(map[string]bool, iface.NumMethods())
+	for i := 0; i < iface.NumMethods(); i++ {
+		names[iface.Method(i).Name()] = true
+	}
+	if names["Fallback"] {
+		return false
+	}
+	for i := 0; i < iface.NumMethods(); i++ {
+		m := iface.Method(i)
+		// func fields must not conflict with methods
+		if !m.Exported() || names[m.Name()+"Func"] || !isTypeVisible(m.Type(), importer) {
+			return false
+		}
+	}
+	return true
+}
+
+func newFakeMethod(name string, sig *types.Signature, qualifier types.Qualifier) *fakeMethod {
+	// names of packages referenced by types cannot be used as var names,
+	// because the struct types in body refer to them
+	used := map[string]bool{
+		"c":         true,
+		"_mockreq":  true,
+		"_mockresp": true,
+	}
+	recordQualifier := func(pkg *types.Package) string {
+		name := qualifier(pkg)
+		used[name] = true
+		return name
+	}
+	m := &fakeMethod{Name: name, Variadic: sig.Variadic()}
+	newVars := func(tuple *types.Tuple, variadic bool) []*fakeVar {
+		vars := make([]*fakeVar, 0, tuple.Len())
+		for i := 0; i < tuple.Len(); i++ {
+			t := tuple.At(i).Type()
+			typeRef := types.TypeString(t, recordQualifier)
+			v := &fakeVar{Name: tuple.At(i).Name(), Type: typeRef, StructType: typeRef, TypeRef: typeRef}
+			if variadic && i == tuple.Len()-1 {
+				v.Type = "..." + types.TypeString(t.(*types.Slice).Elem(), recordQualifier)
+			}
+			vars = append(vars, v)
+		}
+		return vars
+	}
+	m.Params = newVars(sig.Params(), sig.Variadic())
+	m.Results = newVars(sig.Results(), false)
+	m.FirstIsCtx = sig.Params().Len() > 0 && HasQualifiedName(sig.Params().At(0).Type(), "context", "Context")
+	m.LastIsErr = sig.Results().Len() > 0 && HasQualifiedName(sig.Results().At(sig.Results().Len()-1).Type(), "", "error")
+
+	assignName := func(v *fakeVar, defaultName string) {
+		name := v.Name
+		if name == "" || name == "_" || used[name] {
+			name = NextName(func(k string) bool {
+				return !used[k]
+			}, defaultName)
+		}
+		used[name] = true
+		v.Name = name
+		v.ExportedName = ToExported(name)
+	}
+	for i, v := range m.Params {
+		if i == 0 && m.FirstIsCtx {
+			assignName(v, "ctx")
+			continue
+		}
+		assignName(v, fmt.Sprintf("unused_%d", i))
+	}
+	for i, v := range m.Results {
+		if i == len(m.Results)-1 && m.LastIsErr {
+			assignName(v, "err")
+			continue
+		}
+		assignName(v, fmt.Sprintf("Resp_%d", i))
+	}
+	return m
+}
+
+// args excluding ctx
+func (c *fakeMethod) args() []*fakeVar {
+	if c.FirstIsCtx {
+		return c.Params[1:]
+	}
+	return c.Params
+}
+
+// results excluding error
+func (c *fakeMethod) results() []*fakeVar {
+	if c.LastIsErr {
+		return c.Results[:len(c.Results)-1]
+	}
+	return c.Results
+}
+
+func (c *fakeMethod) signature(named bool) string {
+	join := func(vars []*fakeVar) string {
+		list := make([]string, 0, len(vars))
+		for _, v := range vars {
+			if named {
+				list = append(list, v.Name+" "+v.Type)
+			} else {
+				list = append(list, v.Type)
+			}
+		}
+		return strings.Join(list, ", ")
+	}
+	return fmt.Sprintf("(%s) (%s)", join(c.Params), join(c.Results))
+}
+
+func genFake(name string, ifaceRef string, methods []*fakeMethod) gen.Statements {
+	fakeName := "Fake" + name
+	var fields []string
+	for _, m := range methods {
+		fields = append(fields, fmt.Sprintf("    %sFunc func%s", m.Name, m.signature(false)))
+	}
+	var st gen.Statements
+	st.Append(
+		fmt.Sprintf("// %s implements %s by func fields, methods", fakeName, ifaceRef),
+		"// whose func field is nil act by Fallback.",
+		fmt.Sprintf("type %s struct {", fakeName),
+		fields,
+		"    Fallback __MOCKP__.FakeFallback",
+		"}",
+		"",
+		fmt.Sprintf("var _ %s = (*%s)(nil)", ifaceRef, fakeName),
+	)
+	for _, m := range methods {
+		st.Append("", genFakeMethod(name, fakeName, m))
+	}
+	return st
+}
+
+func genFakeMethod(name string, fakeName string, m *fakeMethod) gen.Statements {
+	structDefs := func(vars []*fakeVar) []string {
+		list := make([]string, 0, len(vars))
+		for _, v := range vars {
+			list = append(list, fmt.Sprintf("        %s %s `json:%s`", v.ExportedName, v.StructType, strconv.Quote(v.Name)))
+		}
+		return list
+	}
+	var assigns []string
+	var callArgs []string
+	for _, v := range m.args() {
+		assigns = append(assigns, fmt.Sprintf("%s: %s", v.ExportedName, v.Name))
+	}
+	for i, v := range m.Params {
+		arg := v.Name
+		if m.Variadic && i == len(m.Params)-1 {
+			arg += "..."
+		}
+		callArgs = append(callArgs, arg)
+	}
+	ctx := "nil"
+	if m.FirstIsCtx {
+		ctx = m.Params[0].Name
+	}
+	errAssign := ""
+	if m.LastIsErr {
+		errAssign = m.Results[len(m.Results)-1].Name + " = "
+	}
+	var resAssigns []string
+	var resPtrs []string
+	for _, v := range m.results() {
+		resAssigns = append(resAssigns, fmt.Sprintf("    %s = _mockresp.%s", v.Name, v.ExportedName))
+		resPtrs = append(resPtrs, ", &"+v.Name)
+	}
+	stub := fmt.Sprintf("&__MOCKP__.StubInfo{PkgName: FULL_PKG_NAME, Owner: %q, Name: %q}", name, m.Name)
+
+	var st gen.Statements
+	st.Append(
+		fmt.Sprintf("func (c *%s) %s%s {", fakeName, m.Name, m.signature(true)),
+		"    _mockreq := struct {",
+		structDefs(m.args()),
+		fmt.Sprintf("    }{%s}", strings.Join(assigns, ", ")),
+		"    var _mockresp struct {",
+		structDefs(m.results()),
+		"    }",
+		fmt.Sprintf("    %s__MOCKP__.TrapFunc(%s, %s, c, &_mockreq, &_mockresp, c.fake%s, false, %v, %v)", errAssign, ctx, stub, m.Name, m.FirstIsCtx, m.LastIsErr),
+		resAssigns,
+		"    return",
+		"}",
+		"",
+		fmt.Sprintf("func (c *%s) fake%s%s {", fakeName, m.Name, m.signature(true)),
+		fmt.Sprintf("    if c.%sFunc != nil {", m.Name),
+		fmt.Sprintf("        return c.%sFunc(%s)", m.Name, strings.Join(callArgs, ", ")),
+		"    }",
+		fmt.Sprintf("    __MOCKP__.FakeResults(c.Fallback, %s%s)", stub, strings.Join(resPtrs, "")),
+		"    return",
+		"}",
+	)
+	return st
+}
+
+func genFakeReg(name string, ifaceRef string, methods []*fakeMethod) gen.Statements {
+	typeInfos := func(vars []*fakeVar) string {
+		list := make([]string, 0, len(vars))
+		for _, v := range vars {
+			list = append(list, fmt.Sprintf("__MOCKP__.NewTypeInfo(%q, __REFLECTP__.TypeOf((*%s)(nil)).Elem())", v.Name, v.TypeRef))
+		}
+		return strings.Join(list, ", ")
+	}
+	var st gen.Statements
+	for _, m := range methods {
+		st.Append(fmt.Sprintf("    __MOCKP__.RegisterMockStub(FULL_PKG_NAME, %q, __REFLECTP__.TypeOf((*%s)(nil)).Elem(), %q, []__MOCKP__.TypeInfo{%s}, []__MOCKP__.TypeInfo{%s}, %v, %v)",
+			name, ifaceRef, m.Name, typeInfos(m.args()), typeInfos(m.results()), m.FirstIsCtx, m.LastIsErr))
+	}
+	return st
+}
@@ -0,0 +1,110 @@
+package inspect
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"go/types"
+	"strings"
+
+	"github.com/xhd2015/go-mock/code/edit"
+	"golang.org/x/tools/go/packages"
+)
+
+// rewriteGoStmt makes the child goroutine of a go statement inherit
+// the goroutine local context of its parent:
+//     go f(a, b)
+// becomes
+//     {_mockgoctx := _mock.GetLocalContext(); _mockfn, _mockarg0, _mockarg1 := f, a, b; go func() { _mock.SetLocalContext(_mockgoctx); defer _mock.ClearLocalContext(); _mockfn(_mockarg0, _mockarg1) }()}
+// f and args are still evaluated in the parent, untyped constant args
+// are moved into the call as is.
+// Only separators of the call are replaced, so go statements inside
+// f or args can be rewritten as well.
+// Returns false if the statement is not supported and left unchanged.
+func rewriteGoStmt(pkg *packages.Package, fset *token.FileSet, content []byte, stmt *ast.GoStmt, buf *edit.Buffer, mockRef string) bool {
+	call := stmt.Call
+	if !canRewriteGoCall(pkg, call) {
+		return false
+	}
+	vars := []string{"_mockfn"}
+	var callArgs []string
+	type argEdit struct {
+		start, end token.Pos
+		new        string
+	}
+	edits := make([]argEdit, 0, len(call.Args)+1)
+	prevEnd := call.Fun.End()
+	for i, arg := range call.Args {
+		if tv := pkg.TypesInfo.Types[arg]; tv.Value != nil || tv.IsNil() {
+			// constants and nil have the same value anywhere, move them into the call,
+			// because they may be untyped. they contain no go statements
+			edits = append(edits, argEdit{prevEnd, arg.End(), ""})
+			callArgs = append(callArgs, string(getContent(fset, content, arg.Pos(), arg.End())))
+		} else {
+			name := fmt.Sprintf("_mockarg%d", i)
+			vars = append(vars, name)
+			callArgs = append(callArgs, name)
+			edits = append(edits, argEdit{prevEnd, arg.Pos(), ", "})
+		}
+		prevEnd = arg.End()
+	}
+	if call.Ellipsis != token.NoPos {
+		callArgs[len(callArgs)-1] += "..."
+	}
+
+	buf.Replace(OffsetOf(fset, stmt.Go), OffsetOf(fset, call.Fun.Pos()),
+		fmt.Sprintf("{_mockgoctx := %s.GetLocalContext(); %s := ", mockRef, strings.Join(vars, ", ")))
+	for _, e := range edits {
+		buf.Replace(OffsetOf(fset, e.start), OffsetOf(fset, e.end), e.new)
+	}
+	buf.Replace(OffsetOf(fset, prevEnd), OffsetOf(fset, call.Rparen)+1,
+		fmt.Sprintf("; go func() { %s.SetLocalContext(_mockgoctx); defer %s.ClearLocalContext(); _mockfn(%s) }()}", mockRef, mockRef, strings.Join(callArgs, ", ")))
+	return true
+}
+
+// canRewriteGoCall excludes calls whose function cannot be a value:
+// builtins, conversions, and generic functions with inferred type arguments,
+// and calls with a multi-value argument, or a non-constant comparison
+// argument like `a == b`, whose default type may not match the param.
+func canRewriteGoCall(pkg *packages.Package, call *ast.CallExpr) bool {
+	fun := call.Fun
+	for {
+		paren, ok := fun.(*ast.ParenExpr)
+		if !ok {
+			break
+		}
+		fun = paren.X
+	}
+	tv, ok := pkg.TypesInfo.Types[fun]
+	if !ok || tv.IsType() || tv.IsBuiltin() {
+		return false
+	}
+	var id *ast.Ident
+	switch fun := fun.(type) {
+	case *ast.Ident:
+		id = fun
+	case *ast.SelectorExpr:
+		id = fun.Sel
+	}
+	if id != nil {
+		if _, ok := pkg.TypesInfo.Instances[id]; ok {
+			return false
+		}
+	}
+	if len(call.Args) == 1 {
+		if _, ok := pkg.TypesInfo.TypeOf(call.Args[0]).(*types.Tuple); ok {
+			return false
+		}
+	}
+	for _, arg := range call.Args {
+		bin, ok := arg.(*ast.BinaryExpr)
+		if !ok || pkg.TypesInfo.Types[arg].Value != nil {
+			continue
+		}
+		switch bin.Op {
+		case token.EQL, token.NEQ, token.LSS, token.LEQ, token.GTR, token.GEQ:
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,25 @@
+package inspect
+
+// GRPC_PKG when listed via -mock-module, only functions in
+// grpcTrapFuncs are rewritten: RPC clients are mocked by method name
+// through github.com/xhd2015/go-mock/mock/grpcmock, rewriting
+// the rest of grpc is neither needed nor cheap.
+const GRPC_PKG = "google.golang.org/grpc"
+
+// grpcTrapFuncs owner.name of functions to be rewritten in GRPC_PKG
+var grpcTrapFuncs = map[string]bool{
+	"ClientConn.Invoke": true,
+}
+
+// isPresetSkipped tells whether the function is not rewritten
+// because its package only rewrites preset functions.
+func isPresetSkipped(pkgPath string, ownerType string, funcName string) bool {
+	if pkgPath != GRPC_PKG {
+		return false
+	}
+	key := funcName
+	if ownerType != "" {
+		key = ownerType + "." + funcName
+	}
+	return !grpcTrapFuncs[key]
+}
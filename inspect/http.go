@@ -0,0 +1,14 @@
+package inspect
+
+// MOCK_HTTP_PKG provides replacements of *http.Client methods
+// sending requests through its trapped Transport, see RewriteOptions.MockHTTP
+const MOCK_HTTP_PKG = "github.com/xhd2015/go-mock/mock/httpmock"
+
+// httpClientMethods maps methods of *http.Client to their replacement
+var httpClientMethods = map[string]string{
+	"Do":       "ClientDo",
+	"Get":      "ClientGet",
+	"Post":     "ClientPost",
+	"PostForm": "ClientPostForm",
+	"Head":     "ClientHead",
+}
@@ -14,8 +14,22 @@ type StubInfo = mock.StubInfo
 
 var TrapFunc = mock.TrapFunc
 var WithMockSetup = mock.WithMockSetup
+var WithGenericMock = mock.WithGenericMock
+var WithPatternMock = mock.WithPatternMock
+
+type PatternHandler = mock.PatternHandler
+
+type FakeFallback = mock.FakeFallback
+
+var FakeResults = mock.FakeResults
 
 var RegisterMockStub = mock.RegisterMockStub
+var RegisterOrigFunc = mock.RegisterOrigFunc
+var SetupOrig = mock.SetupOrig
+
+var GetLocalContext = mock.GetLocalContext
+var SetLocalContext = mock.SetLocalContext
+var ClearLocalContext = mock.ClearLocalContext
 
 type TypeInfo = typeinfo.TypeInfo
 
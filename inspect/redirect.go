@@ -0,0 +1,109 @@
+package inspect
+
+import (
+	"go/ast"
+	"go/token"
+	"go/types"
+
+	"github.com/xhd2015/go-mock/code/edit"
+	"golang.org/x/tools/go/packages"
+)
+
+// rewriteMethodCall redirects calls to methods of *pkgPath.typeName in
+// methods, which maps a method to a function of the package referenced by
+// getRef, taking the receiver as the first argument:
+//     t.Reset(d)
+// becomes
+//     _mockclock.ResetTimer(t, d)
+// Only separators are replaced, so the receiver and args can be rewritten as well.
+// Returns false if call is not such a call.
+func rewriteMethodCall(pkg *packages.Package, fset *token.FileSet, call *ast.CallExpr, buf *edit.Buffer, pkgPath string, typeName string, methods map[string]string, getRef func() string) bool {
+	sel, ok := call.Fun.(*ast.SelectorExpr)
+	if !ok {
+		return false
+	}
+	replace := methods[sel.Sel.Name]
+	if replace == "" {
+		return false
+	}
+	s, ok := pkg.TypesInfo.Selections[sel]
+	if !ok || s.Kind() != types.MethodVal || s.Obj().Pkg() == nil || s.Obj().Pkg().Path() != pkgPath {
+		return false
+	}
+	// addressable values are not supported, they are rarely used
+	ptr, ok := pkg.TypesInfo.TypeOf(sel.X).(*types.Pointer)
+	if !ok || !HasQualifiedName(ptr.Elem(), pkgPath, typeName) {
+		return false
+	}
+	redirectCall(fset, call, sel, buf, getRef()+"."+replace)
+	return true
+}
+
+// rewriteInterfaceMethodCall redirects calls to methods in methods of
+// interfaces, whose dynamic type may be *pkgPath.typeName, that is, the
+// method has the same signature as the method of *pkgPath.typeName:
+//     q.QueryContext(ctx, query)
+// becomes
+//     _mocksql.QueryContext(q, ctx, query)
+// The replacement checks the dynamic type of the receiver.
+// Returns false if call is not such a call.
+func rewriteInterfaceMethodCall(pkg *packages.Package, fset *token.FileSet, call *ast.CallExpr, buf *edit.Buffer, pkgPath string, typeName string, methods map[string]string, getRef func() string) bool {
+	sel, ok := call.Fun.(*ast.SelectorExpr)
+	if !ok {
+		return false
+	}
+	replace := methods[sel.Sel.Name]
+	if replace == "" {
+		return false
+	}
+	s, ok := pkg.TypesInfo.Selections[sel]
+	if !ok || s.Kind() != types.MethodVal || !types.IsInterface(pkg.TypesInfo.TypeOf(sel.X)) {
+		return false
+	}
+	sig, ok := s.Type().(*types.Signature)
+	if !ok {
+		return false
+	}
+	m := lookupMethodOfResults(sig, pkgPath, typeName, sel.Sel.Name)
+	if m == nil || !types.Identical(sig, m.Type()) {
+		return false
+	}
+	redirectCall(fset, call, sel, buf, getRef()+"."+replace)
+	return true
+}
+
+// lookupMethodOfResults looks up the method of *pkgPath.typeName, where
+// pkgPath is found from named types in results of sig, because the
+// package may not be imported by the file.
+func lookupMethodOfResults(sig *types.Signature, pkgPath string, typeName string, name string) *types.Func {
+	for i := 0; i < sig.Results().Len(); i++ {
+		t := sig.Results().At(i).Type()
+		if ptr, ok := t.(*types.Pointer); ok {
+			t = ptr.Elem()
+		}
+		named, ok := t.(*types.Named)
+		if !ok || named.Obj().Pkg() == nil || named.Obj().Pkg().Path() != pkgPath {
+			continue
+		}
+		p := named.Obj().Pkg()
+		obj, ok := p.Scope().Lookup(typeName).(*types.TypeName)
+		if !ok {
+			return nil
+		}
+		m, _, _ := types.LookupFieldOrMethod(types.NewPointer(obj.Type()), false, p, name)
+		fn, _ := m.(*types.Func)
+		return fn
+	}
+	return nil
+}
+
+// redirectCall replaces the call of method sel with a call
+// of function fn, taking the receiver as the first argument
+func redirectCall(fset *token.FileSet, call *ast.CallExpr, sel *ast.SelectorExpr, buf *edit.Buffer, fn string) {
+	buf.Insert(OffsetOf(fset, sel.X.Pos()), fn+"(")
+	if len(call.Args) == 0 {
+		buf.Delete(OffsetOf(fset, sel.X.End()), OffsetOf(fset, call.Rparen))
+	} else {
+		buf.Replace(OffsetOf(fset, sel.X.End()), OffsetOf(fset, call.Args[0].Pos()), ", ")
+	}
+}
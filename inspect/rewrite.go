@@ -6,6 +6,7 @@ import (
 	"go/token"
 	"go/types"
 	"io/ioutil"
+	"sort"
 	"strconv"
 	"strings"
 
@@ -25,12 +26,38 @@ import (
 // an exported name will be made available to external packages.
 
 const MOCK_PKG = "github.com/xhd2015/go-mock/inspect/mock"
+
+// MOCK_AUTOLOAD_PKG installs env-configured features into the built binary
+const MOCK_AUTOLOAD_PKG = "github.com/xhd2015/go-mock/mock/autoload"
 const SKIP_MOCK_PKG = "_SKIP_MOCK"
 const SKIP_MOCK_FILE = "_SKIP_MOCK_THIS_FILE"
 
 type RewriteOptions struct {
 	// Filter tests whether the specific function should be rewritten
 	Filter func(pkgPath string, fileName string, ownerName string, ownerIsPtr bool, funcName string) bool
+	// PropagateGo rewrites go statements, so that child goroutines
+	// inherit the goroutine local mock context of their parent.
+	PropagateGo bool
+	// VirtualClock redirects time.Now, time.Since, time.Sleep, time.After,
+	// time.NewTimer and methods Stop and Reset of *time.Timer to the
+	// virtual clock in MOCK_CLOCK_PKG. Only call sites in rewritten
+	// packages are redirected, time.AfterFunc, time.Tick, time.NewTicker
+	// and context deadlines are not.
+	VirtualClock bool
+	// MockSQL redirects QueryContext, QueryRowContext and ExecContext
+	// of *sql.DB and *sql.Tx to MOCK_SQL_PKG, which traps them. Calls
+	// of the same methods through interfaces, like DBTX of sqlc, are
+	// redirected as well, and trapped if the dynamic type is *sql.DB or
+	// *sql.Tx. Only call sites in rewritten packages are redirected,
+	// calls in dependencies like sqlx or gorm, calls of method values,
+	// and of other types wrapping *sql.DB, are not.
+	MockSQL bool
+	// MockHTTP redirects Do, Get, Post, PostForm and Head of *http.Client
+	// to MOCK_HTTP_PKG, which sends requests through its trapped Transport
+	// even if the client has its own Transport. Only call sites in rewritten
+	// packages are redirected, calls through interfaces or method values,
+	// and RoundTrip of transports called directly, are not.
+	MockHTTP bool
 }
 
 type RewriteResult struct {
@@ -41,11 +68,20 @@ type RewriteResult struct {
 type ContentError struct {
 	PkgPath string // a repeat of the map result
 	Files   map[string]*FileContentError
+	// ExportContent declares exported aliases of unexported types,
+	// as a new file of the rewritten package. empty if not needed.
+	ExportContent string
+	// SetupContent replaces MockContent for packages that test/mock_gen
+	// cannot import, as a new file of the rewritten package, see NeedInPackageSetup.
+	SetupContent string
 
 	// exported types
 	// function prototypes are based on
-	MockContent      string
-	MockContentError error // error if any
+	MockContent string
+	// MockExportContent is placed aside MockContent only in the rewritten
+	// copy, because it references aliases declared by ExportContent.
+	MockExportContent string
+	MockContentError  error // error if any
 	// MockInfoCode type for mockable functions
 	MockInfoCode  string
 	MockInfoError error
@@ -86,9 +122,85 @@ func rewritePackage(p *packages.Package, fset *token.FileSet, opts *RewriteOptio
 	}
 
 	pkgPath := p.PkgPath
-	m := make(map[string]*FileContentError, len(p.Syntax))
+	m, fileDetails := rewritePackageFiles(p, fset, opts)
+	if len(m) == 0 {
+		// if no file
+		return nil
+	}
+
+	if NeedInPackageSetup(p) {
+		return &ContentError{
+			PkgPath:      pkgPath,
+			Files:        m,
+			SetupContent: genInPackageSetup(p, fileDetails),
+		}
+	}
+	mockStub, mockExportStub, exportNames, mockStubErr := genMockStub(p, fileDetails)
+	exportContent := ""
+	if len(exportNames) > 0 {
+		exportContent = genExportAliases(p.Name, exportNames)
+	}
+
+	// gen from details
+	return &ContentError{
+		PkgPath:           pkgPath,
+		Files:             m,
+		ExportContent:     exportContent,
+		MockContent:       mockStub,
+		MockExportContent: mockExportStub,
+		MockContentError:  mockStubErr,
+	}
+}
+
+type AstNodeRewritter = func(node ast.Node, getNodeText func(start token.Pos, end token.Pos) []byte) ([]byte, bool)
+
+type rewriteFuncDetail struct {
+	File          string
+	Decl          *ast.FuncDecl
+	RewriteConfig *RewriteConfig
+
+	// original no re-packaged
+	// Args    string // including receiver
+	// Results string
+
+	// type params of the function, or of the receiver type, nil if not generic.
+	TypeParams *types.TypeParamList
+
+	ArgsRewritter    func(r AstNodeRewritter, hook func(node ast.Node, c []byte) []byte) string // re-packaged
+	ResultsRewritter func(r AstNodeRewritter, hook func(node ast.Node, c []byte) []byte) string // re-packaged
+}
 
-	var fileDetails []*RewriteFileDetail
+// recvArgsRenameHook names the unnamed if only one of recv and args has name,
+// because they are combined into one list.
+func recvArgsRenameHook(rc *RewriteConfig) func(node ast.Node, c []byte) []byte {
+	if rc.Recv == nil || len(rc.FullArgs) == 0 ||
+		!(rc.Recv.OrigName == "" && rc.FullArgs[0].OrigName != "" || rc.Recv.OrigName != "" && rc.FullArgs[0].OrigName == "") {
+		return nil
+	}
+	prefixMap := make(map[ast.Node][]byte, 1)
+	// args has no name, but recv has name
+	for _, arg := range rc.FullArgs {
+		if arg.OrigName == "" {
+			prefixMap[arg.TypeExpr] = []byte("_ ")
+		}
+	}
+	if rc.Recv.OrigName == "" {
+		prefixMap[rc.Recv.TypeExpr] = []byte("_ ")
+	}
+	return func(node ast.Node, c []byte) []byte {
+		prefix, ok := prefixMap[node]
+		if !ok {
+			return c
+		}
+		x := append([]byte(nil), prefix...)
+		return append(x, c...)
+	}
+}
+
+// rewritePackageFiles rewrites non-test go files of p, files
+// having nothing to mock are omitted.
+func rewritePackageFiles(p *packages.Package, fset *token.FileSet, opts *RewriteOptions) (m map[string]*FileContentError, fileDetails []*RewriteFileDetail) {
+	m = make(map[string]*FileContentError, len(p.Syntax))
 	for _, f := range p.Syntax {
 		if f.Scope.Lookup(SKIP_MOCK_FILE) != nil {
 			continue
@@ -109,41 +221,47 @@ func rewritePackage(p *packages.Package, fset *token.FileSet, opts *RewriteOptio
 			continue
 		}
 
-		content, details, noMockInserted, err := rewriteFile(p, pkgPath, fset, f, fname, opts)
+		content, details, noMockInserted, err := rewriteFile(p, p.PkgPath, fset, f, fname, opts)
 		if noMockInserted {
 			continue
 		}
 		m[fname] = &FileContentError{OrigFile: fname, Content: content, Error: err}
 		fileDetails = append(fileDetails, details)
 	}
-	if len(m) == 0 {
-		// if no file
-		return nil
-	}
-
-	mockStub, mockStubErr := genMockStub(p, fileDetails)
+	return
+}
 
-	// gen from details
-	return &ContentError{
-		PkgPath:          pkgPath,
-		Files:            m,
-		MockContent:      mockStub,
-		MockContentError: mockStubErr,
+// formatTypeParams formats type params with constraints, like `[K comparable, V any]`
+func formatTypeParams(list *types.TypeParamList, qualifier types.Qualifier) string {
+	params := make([]string, 0, list.Len())
+	for i := 0; i < list.Len(); i++ {
+		tp := list.At(i)
+		params = append(params, tp.Obj().Name()+" "+types.TypeString(tp.Constraint(), qualifier))
 	}
+	return "[" + strings.Join(params, ", ") + "]"
 }
 
-type AstNodeRewritter = func(node ast.Node, getNodeText func(start token.Pos, end token.Pos) []byte) ([]byte, bool)
-
-type rewriteFuncDetail struct {
-	File          string
-	RewriteConfig *RewriteConfig
-
-	// original no re-packaged
-	// Args    string // including receiver
-	// Results string
+func typeParamsVisible(list *types.TypeParamList, importer string) bool {
+	for i := 0; i < list.Len(); i++ {
+		if !isTypeVisible(list.At(i).Constraint(), importer) {
+			return false
+		}
+	}
+	return true
+}
 
-	ArgsRewritter    func(r AstNodeRewritter, hook func(node ast.Node, c []byte) []byte) string // re-packaged
-	ResultsRewritter func(r AstNodeRewritter, hook func(node ast.Node, c []byte) []byte) string // re-packaged
+// getTypeParams returns type params of a generic function, or of the receiver
+// type of a method, the names are those declared in the receiver.
+func getTypeParams(pkg *packages.Package, decl *ast.FuncDecl) *types.TypeParamList {
+	fn, ok := pkg.TypesInfo.Defs[decl.Name].(*types.Func)
+	if !ok {
+		return nil
+	}
+	sig := fn.Type().(*types.Signature)
+	if decl.Recv != nil {
+		return sig.RecvTypeParams()
+	}
+	return sig.TypeParams()
 }
 
 type RewriteFileDetail struct {
@@ -186,6 +304,38 @@ func rewriteFile(pkg *packages.Package, pkgPath string, fset *token.FileSet, f *
 		return mockPkgImp
 	}
 
+	var clockPkgImp string
+	getClockPkgImp := func() string {
+		if clockPkgImp == "" {
+			clockPkgImp, _ = ensureImports(fset, f, buf, "_mockclock", "clock", MOCK_CLOCK_PKG)
+		}
+		return clockPkgImp
+	}
+
+	var sqlPkgImp string
+	getSQLPkgImp := func() string {
+		if sqlPkgImp == "" {
+			sqlPkgImp, _ = ensureImports(fset, f, buf, "_mocksql", "sqlmock", MOCK_SQL_PKG)
+		}
+		return sqlPkgImp
+	}
+
+	var httpPkgImp string
+	getHTTPPkgImp := func() string {
+		if httpPkgImp == "" {
+			httpPkgImp, _ = ensureImports(fset, f, buf, "_mockhttp", "httpmock", MOCK_HTTP_PKG)
+		}
+		return httpPkgImp
+	}
+
+	var reflectPkgImp string
+	getReflectPkgImp := func() string {
+		if reflectPkgImp == "" {
+			reflectPkgImp, _ = ensureImports(fset, f, buf, "", "reflect", "reflect")
+		}
+		return reflectPkgImp
+	}
+
 	starterTypesMapping := make(map[types.Type]bool)
 	starterTypes := make([]types.Type, 0)
 	addType := func(t types.Type) {
@@ -199,6 +349,11 @@ func rewriteFile(pkg *packages.Package, pkgPath string, fset *token.FileSet, f *
 	getContentByPos := func(start, end token.Pos) []byte {
 		return getContent(fset, content, start, end)
 	}
+	numGoStmts := 0
+	goCalls := make(map[*ast.CallExpr]bool)
+	// names of the time package in redirected references
+	clockTimeNames := make(map[string]bool)
+	numRedirects := 0
 	ast.Inspect(f, func(n ast.Node) bool {
 		switch n := n.(type) {
 		case *ast.FuncDecl:
@@ -213,10 +368,13 @@ func rewriteFile(pkg *packages.Package, pkgPath string, fset *token.FileSet, f *
 			}
 			funcName := n.Name.Name
 
-			// cannot mock functions with type params now
-			// TODO add support for generic functions
-			if n.Type.TypeParams != nil {
-				return true
+			// type params of the function, or of the receiver type
+			typeParams := getTypeParams(pkg, n)
+			for i := 0; i < typeParams.Len(); i++ {
+				// blank type params cannot be referenced by the trap
+				if typeParams.At(i).Obj().Name() == "_" {
+					return true
+				}
 			}
 
 			// package level init function cannot be mocked
@@ -228,6 +386,9 @@ func rewriteFile(pkg *packages.Package, pkgPath string, fset *token.FileSet, f *
 			if opts != nil && opts.Filter != nil && !opts.Filter(pkgPath, fileName, ownerType, ownerIsPtr, funcName) {
 				return true
 			}
+			if isPresetSkipped(pkgPath, ownerType, funcName) {
+				return true
+			}
 			// special case, if the function returns ctx,
 			// we do not mock it as such function violatiles
 			// ctx-function pair relation.
@@ -246,6 +407,12 @@ func rewriteFile(pkg *packages.Package, pkgPath string, fset *token.FileSet, f *
 			}
 
 			rc.SupportPkgRef = getMockPkgImp()
+			for i := 0; i < typeParams.Len(); i++ {
+				rc.TypeParams = append(rc.TypeParams, typeParams.At(i).Obj().Name())
+			}
+			if len(rc.TypeParams) > 0 {
+				rc.ReflectPkgRef = getReflectPkgImp()
+			}
 
 			rc.AllFields.FillFieldTypeExpr(fset, content)
 			rc.Init()
@@ -302,14 +469,31 @@ func rewriteFile(pkg *packages.Package, pkgPath string, fset *token.FileSet, f *
 			}
 
 			// generate patch content and insert
+			var newFuncDecl string
+			if n.Recv != nil && len(rc.TypeParams) > 0 {
+				// type params of the receiver are only in scope of methods,
+				// so keep the original body as a method, and reference it
+				// by method expression, which takes receiver as the first argument.
+				rc.NewFuncRef = fmt.Sprintf("(%s).%s", rc.Recv.TypeExprString, rc.NewFuncName)
+				params := string(getContent(fset, content, n.Type.Params.Pos(), n.Type.Params.End()))
+				newFuncDecl = fmt.Sprintf("%s %s%s", recvCode, rc.NewFuncName, params)
+			} else if len(rc.TypeParams) > 0 {
+				rc.NewFuncRef = fmt.Sprintf("%s[%s]", rc.NewFuncName, strings.Join(rc.TypeParams, ","))
+				typeParamsCode := string(getContent(fset, content, n.Type.TypeParams.Pos(), n.Type.TypeParams.End()))
+				newFuncDecl = fmt.Sprintf("%s%s%s", rc.NewFuncName, typeParamsCode, args)
+			} else {
+				newFuncDecl = rc.NewFuncName + args
+			}
 			newCode := rc.Gen(false /*pretty*/)
-			patchContent := fmt.Sprintf(`%s}; func %s%s%s{`, newCode, rc.NewFuncName, StripNewline(args), StripNewline(originalResults))
+			patchContent := fmt.Sprintf(`%s}; func %s%s{`, newCode, StripNewline(newFuncDecl), StripNewline(originalResults))
 			buf.Insert(OffsetOf(fset, n.Body.Lbrace)+1, patchContent)
 
 			// make rewriteDetails
 			funcDetails = append(funcDetails, &rewriteFuncDetail{
 				File:          fileName,
+				Decl:          n,
 				RewriteConfig: rc,
+				TypeParams:    typeParams,
 
 				ArgsRewritter: func(r AstNodeRewritter, hook func(node ast.Node, c []byte) []byte) (argsRepkg string) {
 					argsRepkg = string(RewriteAstNodeTextHooked(n.Type.Params, getContentByPos, r, hook))
@@ -335,16 +519,48 @@ func rewriteFile(pkg *packages.Package, pkgPath string, fset *token.FileSet, f *
 			for _, arg := range rc.AllFields {
 				addType(arg.Type.ResolvedType)
 			}
+		case *ast.GoStmt:
+			if opts != nil && opts.PropagateGo && rewriteGoStmt(pkg, fset, content, n, buf, getMockPkgImp()) {
+				numGoStmts++
+				// the call is restructured, its method cannot be redirected
+				goCalls[n.Call] = true
+			}
+		case *ast.SelectorExpr:
+			if opts != nil && opts.VirtualClock {
+				if name := rewriteClockRef(pkg, fset, n, buf, getClockPkgImp); name != "" {
+					clockTimeNames[name] = true
+					numRedirects++
+				}
+			}
+		case *ast.CallExpr:
+			if opts == nil || goCalls[n] {
+				break
+			}
+			// stop and reset timers created by the virtual clock
+			if opts.VirtualClock && rewriteMethodCall(pkg, fset, n, buf, "time", "Timer", clockTimerMethods, getClockPkgImp) {
+				numRedirects++
+			}
+			if opts.MockSQL && (rewriteMethodCall(pkg, fset, n, buf, "database/sql", "DB", sqlDBMethods, getSQLPkgImp) ||
+				rewriteMethodCall(pkg, fset, n, buf, "database/sql", "Tx", sqlTxMethods, getSQLPkgImp) ||
+				rewriteInterfaceMethodCall(pkg, fset, n, buf, "database/sql", "DB", sqlInterfaceMethods, getSQLPkgImp)) {
+				numRedirects++
+			}
+			if opts.MockHTTP && rewriteMethodCall(pkg, fset, n, buf, "net/http", "Client", httpClientMethods, getHTTPPkgImp) {
+				numRedirects++
+			}
 		}
 		return true
 	})
-	noMockInserted = len(funcDetails) == 0
+	// keep the time import used
+	for name := range clockTimeNames {
+		buf.Insert(len(content), fmt.Sprintf("\nvar _ %s.Duration\n", name))
+	}
+	noMockInserted = len(funcDetails) == 0 && numGoStmts == 0 && numRedirects == 0
 	if noMockInserted {
 		return
 	}
 
 	// name -> EXPORTED name
-	needExportNames := make(map[string]string)
 	allExportNames := make(map[string]string)
 	importPkgByTypes := make(map[string]*NameAlias)
 	TraverseTypes(starterTypes, func(t types.Type) bool {
@@ -360,7 +576,6 @@ func rewriteFile(pkg *packages.Package, pkgPath string, fset *token.FileSet, f *
 				expName := name
 				if !IsExportedName(name) {
 					expName = EXPORT_PREFIX + name
-					needExportNames[name] = expName
 				}
 				allExportNames[name] = expName
 			} else {
@@ -382,19 +597,17 @@ func rewriteFile(pkg *packages.Package, pkgPath string, fset *token.FileSet, f *
 		}
 		return false
 	})
-	var reflectPkgImp string
-	getReflectPkgImp := func() string {
-		if reflectPkgImp == "" {
-			reflectPkgImp, _ = ensureImports(fset, f, buf, "", "reflect", "reflect")
+	// generic functions register each instantiation on its first call,
+	// because their types are not known at package level
+	var regFuncDetails []*rewriteFuncDetail
+	for _, fd := range funcDetails {
+		if len(fd.RewriteConfig.TypeParams) == 0 {
+			regFuncDetails = append(regFuncDetails, fd)
 		}
-		return reflectPkgImp
 	}
-
-	regCode := genRegCode(funcDetails, pkgPath, getMockPkgImp, getReflectPkgImp)
-
-	// collect need exported names
-	if false /*make unexported*/ {
-		exportUnexported(f, fset, needExportNames, buf)
+	var regCode string
+	if len(regFuncDetails) > 0 {
+		regCode = genRegCode(regFuncDetails, pkgPath, getMockPkgImp, getReflectPkgImp)
 	}
 
 	detail = &RewriteFileDetail{
@@ -435,6 +648,7 @@ func genRegCode(funcDetails []*rewriteFuncDetail, pkgPath string, getMockImpName
 		fdT := gen.NewTemplateBuilder()
 		fdT.Block(
 			"__MOCKP__.RegisterMockStub(pkgPath, __OWNER_TYPE_NAMEQ__,__OWNER_TYPE__,__FUNC_NAMEQ__, []__MOCKP__.TypeInfo{__ARGS__},[]__MOCKP__.TypeInfo{__RESULTS__},__ARGCTX__,__RESERR__)",
+			"__MOCKP__.RegisterOrigFunc(pkgPath, __OWNER_TYPE_NAMEQ__,__FUNC_NAMEQ__,__ORIG_FUNC__)",
 		)
 
 		ownerType := "nil"
@@ -447,13 +661,14 @@ func genRegCode(funcDetails []*rewriteFuncDetail, pkgPath string, getMockImpName
 			"__OWNER_TYPE_NAMEQ__": strconv.Quote(fd.RewriteConfig.Owner),
 			"__OWNER_TYPE__":       ownerType,
 			"__FUNC_NAMEQ__":       strconv.Quote(fd.RewriteConfig.FuncName),
+			"__ORIG_FUNC__":        fd.RewriteConfig.NewFuncName,
 			"__ARGS__":             getFields(fd.RewriteConfig.Args),
 			"__RESULTS__":          getFields(fd.RewriteConfig.Results),
 			"__ARGCTX__":           strconv.FormatBool(fd.RewriteConfig.FirstArgIsCtx),
 			"__RESERR__":           strconv.FormatBool(fd.RewriteConfig.LastResIsError),
 		})
 
-		regT.Block(gen.Indent("    ", fdRegCode))
+		regT.Block(gen.Indent("    ", strings.Split(fdRegCode, "\n")))
 	}
 	regT.Block(
 		"    return true",
@@ -565,22 +780,6 @@ func joinRecvArgs(recvCode string, args string, recvOrigName string, needEmptyNa
 	return "(" + recvCode + comma + strings.TrimPrefix(args, "(")
 }
 
-// name -> EXPORTED name
-func exportUnexported(f *ast.File, fset *token.FileSet, needExportNames map[string]string, buf *edit.Buffer) {
-	for _, decl := range f.Decls {
-		if gdecl, ok := decl.(*ast.GenDecl); ok && gdecl.Tok == token.TYPE {
-			for _, spec := range gdecl.Specs {
-				if tspec, ok := spec.(*ast.TypeSpec); ok {
-					exportedName := needExportNames[tspec.Name.Name]
-					if exportedName != "" {
-						buf.Insert(OffsetOf(fset, gdecl.End()), fmt.Sprintf(";type %s = %s", exportedName, tspec.Name.Name))
-					}
-				}
-			}
-		}
-	}
-}
-
 type NamedType struct {
 	t *types.Named
 }
@@ -780,33 +979,15 @@ func parseTypes(list []*ast.Field, pkg *packages.Package, genPrefix string, type
 			if !exported {
 				exportedName = EXPORT_PREFIX + tName
 			}
-			foundInvisible := false
-			TraverseType(rtype, func(t types.Type) bool {
-				if foundInvisible {
-					return false
-				}
-				n, ok := t.(*types.Named)
-				if !ok {
-					return true
-				}
-				// error has no package
-				if n.Obj().Pkg() != nil && (!IsExportedName(n.Obj().Name()) || IsInternalPkg(n.Obj().Pkg().Path())) {
-					// TODO: get aliased name, may can use that alias is that is exported
-					// if n.Obj().IsAlias()
-					foundInvisible = true
-				}
-
-				// since it is named, so a name stop's traversing its underlying.
-				return false
-			})
 			typeInfoCache = &Type{
 				Ptr:          tIsPtr,
 				Name:         tName,
 				Exported:     exported,
 				ExportedName: exportedName, // TODO: fix for error, MExport_error is not correct
 				ResolvedType: rtype,
-				Visible:      !foundInvisible,
+				Visible:      isTypeVisible(rtype, moduleOf(pkg)),
 			}
+			typeInfoCache.Exportable = typeInfoCache.Visible || isTypeExportable(rtype, pkg.Types, moduleOf(pkg))
 			typeInfo[rtype] = typeInfoCache
 		}
 
@@ -822,6 +1003,70 @@ func parseTypes(list []*ast.Field, pkg *packages.Package, genPrefix string, type
 	return fields
 }
 
+// isTypeVisible tells whether t can be referenced outside its package,
+// by importer which decides visibility of internal packages.
+func isTypeVisible(t types.Type, importer string) bool {
+	foundInvisible := false
+	TraverseType(t, func(t types.Type) bool {
+		if foundInvisible {
+			return false
+		}
+		n, ok := t.(*types.Named)
+		if !ok {
+			return true
+		}
+		// error has no package
+		if n.Obj().Pkg() != nil && (!IsExportedName(n.Obj().Name()) || !CanImportInternal(importer, n.Obj().Pkg().Path())) {
+			// TODO: get aliased name, may can use that alias is that is exported
+			// if n.Obj().IsAlias()
+			foundInvisible = true
+		}
+
+		// since it is named, so a name stop's traversing its underlying.
+		// type args are not part of the name
+		targs := n.TypeArgs()
+		for i := 0; i < targs.Len() && !foundInvisible; i++ {
+			foundInvisible = !isTypeVisible(targs.At(i), importer)
+		}
+		return false
+	})
+	return !foundInvisible
+}
+
+// isTypeExportable tells whether t can be referenced outside pkg once
+// unexported types of pkg are exported by aliases named with EXPORT_PREFIX.
+// Generic types and types already having such a name are not aliased.
+func isTypeExportable(t types.Type, pkg *types.Package, importer string) bool {
+	exportable := true
+	TraverseType(t, func(t types.Type) bool {
+		if !exportable {
+			return false
+		}
+		n, ok := t.(*types.Named)
+		if !ok {
+			return true
+		}
+		obj := n.Obj()
+		if obj.Pkg() != nil && !IsExportedName(obj.Name()) {
+			exportable = obj.Pkg() == pkg && obj.Parent() == pkg.Scope() && n.TypeParams().Len() == 0 &&
+				pkg.Scope().Lookup(EXPORT_PREFIX+obj.Name()) == nil
+		} else if obj.Pkg() != nil && !CanImportInternal(importer, obj.Pkg().Path()) {
+			exportable = false
+		}
+		targs := n.TypeArgs()
+		for i := 0; i < targs.Len() && exportable; i++ {
+			exportable = isTypeExportable(targs.At(i), pkg, importer)
+		}
+		return false
+	})
+	return exportable
+}
+
+func isTypeParam(t *types.TypeName) bool {
+	_, ok := t.Type().(*types.TypeParam)
+	return ok
+}
+
 // NOTE: a replacement of implements. No successful try made yet.
 // TODO: test types.AssignableTo() for types from the same Load.
 func HasQualifiedName(t types.Type, pkg, name string) bool {
@@ -879,6 +1124,9 @@ type RewriteConfig struct {
 	Exported      bool   // is name exported?
 	FuncName      string
 	NewFuncName   string
+	NewFuncRef    string   // how the trap references NewFuncName, if different, e.g. _mockMap[T,R]
+	TypeParams    []string // type param names of generic function, or of the receiver type
+	ReflectPkgRef string   // reflect, needed if TypeParams is not empty
 	// HasCtx always be true
 	CtxName        string // if "", has no ctx. if "_", should adjust outside this config
 	ErrName        string // if "", has no error.
@@ -933,6 +1181,18 @@ func (c FieldList) AllTypesVisible() bool {
 	}
 	return true
 }
+
+// AllTypesExportable is like AllTypesVisible, but also accepts
+// unexported types of current package, which are aliased in
+// the rewritten package.
+func (c FieldList) AllTypesExportable() bool {
+	for _, f := range c {
+		if !f.Type.Exportable {
+			return false
+		}
+	}
+	return true
+}
 func (c FieldList) RenameFields(fset *token.FileSet, buf *edit.Buffer) {
 	for _, f := range c {
 		f.Rename(fset, buf)
@@ -989,7 +1249,8 @@ type Type struct {
 	ExportedName string // if !Exported, the generated name
 
 	ResolvedType types.Type
-	Visible      bool // visible to outside? either is an exported name, or name from another non-internal package, or contains names of such. TODO: add internal detection.
+	Visible      bool // visible to outside? either is an exported name, or name from another package importable by stubs, or contains names of such.
+	Exportable   bool // visible to outside after unexported types of current package are aliased with EXPORT_PREFIX
 }
 
 func (c *RewriteConfig) Init() {
@@ -1071,6 +1332,18 @@ func (c *RewriteConfig) Gen(pretty bool) string {
 	if c.Recv != nil {
 		recvVar = c.Recv.Name
 	}
+	newFuncRef := c.NewFuncName
+	if c.NewFuncRef != "" {
+		newFuncRef = c.NewFuncRef
+	}
+	typeArgs := ""
+	if len(c.TypeParams) > 0 {
+		list := make([]string, 0, len(c.TypeParams))
+		for _, name := range c.TypeParams {
+			list = append(list, fmt.Sprintf("%s.TypeOf((*%s)(nil)).Elem()", c.ReflectPkgRef, name))
+		}
+		typeArgs = fmt.Sprintf(",TypeArgs:[]%s.Type{%s}", c.ReflectPkgRef, strings.Join(list, ","))
+	}
 
 	varMap := gen.VarMap{
 		"__V__":               c.VarPrefix,
@@ -1080,7 +1353,8 @@ func (c *RewriteConfig) Gen(pretty bool) string {
 		"__OWNER_NAME_Q__":    strconv.Quote(c.Owner),
 		"__OWNER_IS_PTR__":    strconv.FormatBool(c.OwnerPtr),
 		"__FUNC_NAME_Q__":     strconv.Quote(c.FuncName),
-		"__NEW_FUNC__":        c.NewFuncName,
+		"__NEW_FUNC__":        newFuncRef,
+		"__TYPE_ARGS__":       typeArgs,
 		"__ERR_NAME__":        c.ErrName,
 		"__REQ_DEFS__":        makeStructDefs(c.Args),
 		"__RESP_DEFS__":       makeStructDefs(c.Results),
@@ -1101,7 +1375,7 @@ func (c *RewriteConfig) Gen(pretty bool) string {
 			gen.Group(
 				"__P__.TrapFunc(",
 				gen.If(c.CtxName != "").Then(c.CtxName).Else("nil"), ",",
-				"&__P__.StubInfo{PkgName:__PKG_NAME_Q__,Owner:__OWNER_NAME_Q__,OwnerPtr:__OWNER_IS_PTR__,Name:__FUNC_NAME_Q__}, __RECV_VAR__, &__V__req, &__V__resp,__NEW_FUNC__,__HAS_RECV__,__FIRST_IS_CTX__,__LAST_IS_ERR__)",
+				"&__P__.StubInfo{PkgName:__PKG_NAME_Q__,Owner:__OWNER_NAME_Q__,OwnerPtr:__OWNER_IS_PTR__,Name:__FUNC_NAME_Q____TYPE_ARGS__}, __RECV_VAR__, &__V__req, &__V__resp,__NEW_FUNC__,__HAS_RECV__,__FIRST_IS_CTX__,__LAST_IS_ERR__)",
 			),
 		),
 		gen.If(len(c.Results) > 0).Then(
@@ -1119,19 +1393,33 @@ func (c *RewriteConfig) Gen(pretty bool) string {
 	return t.Format(varMap)
 }
 
-func genMockStub(p *packages.Package, fileDetails []*RewriteFileDetail) (content string, err error) {
+// genMockStub generates content of test/mock_gen for package p.
+// Functions referencing unexported types of p are generated into exportContent,
+// which references exportNames by their EXPORT_PREFIX aliases, so it only compiles
+// in the rewritten copy where these aliases are declared.
+func genMockStub(p *packages.Package, fileDetails []*RewriteFileDetail) (content string, exportContent string, exportNames []string, err error) {
 	imps := NewImportList()
 
 	preMap := map[string]bool{
-		"Setup":         true,
-		"M":             true,
-		SKIP_MOCK_FILE:  true,
-		SKIP_MOCK_PKG:   true,
-		"FULL_PKG_NAME": true, // TODO: may add go keywords.
+		"Setup":          true,
+		"M":              true,
+		"SetupExport":    true,
+		"MExport":        true,
+		"Orig":           true,
+		"OrigExport":     true,
+		"origM":          true,
+		"origOnce":       true,
+		"origExportM":    true,
+		"origExportOnce": true,
+		SKIP_MOCK_FILE:   true,
+		SKIP_MOCK_PKG:    true,
+		"FULL_PKG_NAME":  true, // TODO: may add go keywords.
 	}
 	imps.CanUseName = func(name string) bool {
 		return !preMap[name]
 	}
+	expImps := NewImportList()
+	expImps.CanUseName = imps.CanUseName
 
 	var links gen.Statements
 	var defs gen.Statements
@@ -1144,6 +1432,9 @@ func genMockStub(p *packages.Package, fileDetails []*RewriteFileDetail) (content
 
 	// var rePkg AstNodeRewritter
 	codeWillBeCommented := false
+	exporting := false
+	curImps := imps
+	exportAliased := make(map[string]bool)
 	var interfacedIdent map[ast.Node]bool
 	// rePkg, and also given a name
 	rePkg := func(node ast.Node, getNodeText func(start token.Pos, end token.Pos) []byte) ([]byte, bool) {
@@ -1154,14 +1445,20 @@ func genMockStub(p *packages.Package, fileDetails []*RewriteFileDetail) (content
 		if idt, ok := node.(*ast.Ident); ok {
 			ref := p.TypesInfo.Uses[idt]
 			// is it a Type declared in current package?
-			if t, ok := ref.(*types.TypeName); ok {
+			// type params are declared by the function itself.
+			if t, ok := ref.(*types.TypeName); ok && !isTypeParam(t) {
 				realPkg := t.Pkg()  // may be dot import
 				if realPkg != nil { // string will have no pkg
 					refPkgName := realPkg.Name()
 					if !codeWillBeCommented {
-						refPkgName = imps.ImportOrUseNext(realPkg.Path(), "", realPkg.Name())
+						refPkgName = curImps.ImportOrUseNext(realPkg.Path(), "", realPkg.Name())
+					}
+					name := idt.Name
+					if exporting && realPkg == p.Types && !t.Exported() {
+						exportAliased[name] = true
+						name = EXPORT_PREFIX + name
 					}
-					return []byte(fmt.Sprintf("%s.%s", refPkgName, idt.Name)), true
+					return []byte(fmt.Sprintf("%s.%s", refPkgName, name)), true
 				}
 			}
 		} else if sel, ok := node.(*ast.SelectorExpr); ok {
@@ -1172,7 +1469,7 @@ func genMockStub(p *packages.Package, fileDetails []*RewriteFileDetail) (content
 				if pkgName, ok := ref.(*types.PkgName); ok {
 					extPkgName := pkgName.Name()
 					if !codeWillBeCommented {
-						extPkgName = imps.ImportOrUseNext(pkgName.Imported().Path(), pkgName.Name(), pkgName.Imported().Name())
+						extPkgName = curImps.ImportOrUseNext(pkgName.Imported().Path(), pkgName.Name(), pkgName.Imported().Name())
 					}
 					return []byte(fmt.Sprintf("%s.%s", extPkgName, sel.Sel.Name)), true
 				}
@@ -1186,9 +1483,35 @@ func genMockStub(p *packages.Package, fileDetails []*RewriteFileDetail) (content
 	links.Append(noOwnerDef.link)
 	defByOwner[""] = noOwnerDef
 	hasRefX := false
+	var generics []*rewriteFuncDetail
+
+	var expDefs gen.Statements
+	expDefByOwner := make(map[string]*gen.Statements)
+	expDefOf := func(owner string, oname string) *gen.Statements {
+		st, ok := expDefByOwner[owner]
+		if !ok {
+			st = &gen.Statements{}
+			if owner != "" {
+				expDefs.Append(
+					fmt.Sprintf("    %s struct{", oname),
+					gen.Indent("        ", st),
+					"    }",
+				)
+			} else {
+				expDefs.Append(st)
+			}
+			expDefByOwner[owner] = st
+		}
+		return st
+	}
 	for _, fd := range fileDetails {
 		for _, d := range fd.Funcs {
 			rc := d.RewriteConfig
+			// generic functions cannot be fields of M
+			if len(rc.TypeParams) > 0 {
+				generics = append(generics, d)
+				continue
+			}
 
 			oname := ""
 			if rc.Owner != "" {
@@ -1232,27 +1555,17 @@ func genMockStub(p *packages.Package, fileDetails []*RewriteFileDetail) (content
 			codeWillBeCommented = !rc.FullArgs.AllTypesVisible() || !rc.FullResults.AllTypesVisible()
 			interfacedIdent = map[ast.Node]bool(nil)
 
-			var renameHook func(node ast.Node, c []byte) []byte
-			if rc.Recv != nil && len(rc.FullArgs) > 0 &&
-				(rc.Recv.OrigName == "" && rc.FullArgs[0].OrigName != "" || rc.Recv.OrigName != "" && rc.FullArgs[0].OrigName == "") {
-				prefixMap := make(map[ast.Node][]byte, 1)
-				// args has no name, but recv has name
-				for _, arg := range rc.FullArgs {
-					if arg.OrigName == "" {
-						prefixMap[arg.TypeExpr] = []byte("_ ")
-					}
-				}
-				if rc.Recv.OrigName == "" {
-					prefixMap[rc.Recv.TypeExpr] = []byte("_ ")
-				}
-				renameHook = func(node ast.Node, c []byte) []byte {
-					prefix, ok := prefixMap[node]
-					if !ok {
-						return c
-					}
-					x := append([]byte(nil), prefix...)
-					return append(x, c...)
-				}
+			renameHook := recvArgsRenameHook(rc)
+			if codeWillBeCommented && rc.FullArgs.AllTypesExportable() && rc.FullResults.AllTypesExportable() && (rc.Recv == nil || rc.Recv.Type.Exportable) {
+				// typed stub in MExport, receiver is also typed
+				codeWillBeCommented, exporting, curImps = false, true, expImps
+				args := d.ArgsRewritter(rePkg, CombineHooks(renameHook))
+				results := d.ResultsRewritter(rePkg, nil)
+				exporting, curImps = false, imps
+
+				expDefOf(rc.Owner, oname).Append(fmt.Sprintf("    %s func%s%s", refFuncName, args, results))
+				defSt.decl.Append(fmt.Sprintf("//     %s: see MExport, it contains unexported types", refFuncName))
+				continue
 			}
 			if rc.Recv != nil && !rc.Recv.Type.Exported {
 				if interfacedIdent == nil {
@@ -1297,6 +1610,72 @@ func genMockStub(p *packages.Package, fileDetails []*RewriteFileDetail) (content
 		}
 	}
 
+	// generic functions are mocked per instantiation by Mock_X[T](ctx,fn),
+	// or for all instantiations by Mock_XAll(ctx,handler)
+	var genericDefs gen.Statements
+	for _, d := range generics {
+		rc := d.RewriteConfig
+		fullName := rc.GetFullName()
+		displayName := rc.FuncName
+		if rc.Owner != "" {
+			displayName = rc.Owner + "." + rc.FuncName
+		}
+
+		codeWillBeCommented = !rc.FullArgs.AllTypesVisible() || !rc.FullResults.AllTypesVisible() || !typeParamsVisible(d.TypeParams, moduleOf(p))
+		interfacedIdent = map[ast.Node]bool(nil)
+		if rc.Recv != nil && !rc.Recv.Type.Exported {
+			interfacedIdent = map[ast.Node]bool{rc.Recv.TypeExpr: true}
+		}
+		args := d.ArgsRewritter(rePkg, CombineHooks(recvArgsRenameHook(rc)))
+		results := d.ResultsRewritter(rePkg, nil)
+		typeParams := formatTypeParams(d.TypeParams, func(pkg *types.Package) string {
+			if codeWillBeCommented {
+				return pkg.Name()
+			}
+			return imps.ImportOrUseNext(pkg.Path(), "", pkg.Name())
+		})
+		typeArgs := make([]string, 0, len(rc.TypeParams))
+		for _, name := range rc.TypeParams {
+			typeArgs = append(typeArgs, fmt.Sprintf("__REFLECTP__.TypeOf((*%s)(nil)).Elem()", name))
+		}
+		mockFn := []interface{}{
+			fmt.Sprintf("// Mock_%s mocks %s of the instantiation given by type arguments", fullName, displayName),
+			fmt.Sprintf("func Mock_%s%s(ctx __CTXP__.Context, fn func%s%s) __CTXP__.Context {", fullName, typeParams, args, results),
+			fmt.Sprintf("    return __MOCKP__.WithGenericMock(ctx, FULL_PKG_NAME, %q, %q, []__REFLECTP__.Type{%s}, fn)", rc.Owner, rc.FuncName, strings.Join(typeArgs, ", ")),
+			"}",
+		}
+		if codeWillBeCommented {
+			mockFn = []interface{}{
+				fmt.Sprintf("// NOTE: Mock_%s contains invisible types", fullName),
+				gen.Indent("// ", mockFn),
+			}
+		}
+		genericDefs.Append(
+			mockFn,
+			"",
+			fmt.Sprintf("// Mock_%sAll mocks %s of all instantiations", fullName, displayName),
+			fmt.Sprintf("func Mock_%sAll(ctx __CTXP__.Context, handler __MOCKP__.PatternHandler) __CTXP__.Context {", fullName),
+			fmt.Sprintf("    return __MOCKP__.WithPatternMock(ctx, FULL_PKG_NAME+%q, handler)", "::"+rc.Owner+"::"+rc.FuncName),
+			"}",
+			"",
+		)
+	}
+
+	fakes, fakeRegs, numFakes := genInterfaceFakes(p, func(pkg *types.Package) string {
+		return imps.ImportOrUseNext(pkg.Path(), "", pkg.Name())
+	})
+	var fakeRegDefs gen.Statements
+	if numFakes > 0 {
+		fakeRegDefs.Append(
+			"/* register interface fakes */",
+			"var _ = func() bool {",
+			fakeRegs,
+			"    return true",
+			"}()",
+			"",
+		)
+	}
+
 	// should traverse all types from args and results, finding referenced types:
 	// - types in the same package
 	//   -- exported: just delcare a name reference
@@ -1305,32 +1684,26 @@ func genMockStub(p *packages.Package, fileDetails []*RewriteFileDetail) (content
 	//   -- must be exported: just import the package and name
 	// - types from internal package
 	// name conflictions may be processed later.
-	var typeAlias []string
-	if false /*need alias type*/ {
-		typeAliased := make(map[string]bool)
-		for _, fd := range fileDetails {
-			for name, exportName := range fd.AllExportNames {
-				if !typeAliased[name] {
-					typeAliased[name] = true
-					imps.ImportOrUseNext(p.PkgPath, "", p.Name)
-					typeAlias = append(typeAlias, fmt.Sprintf("type %s = %s.%s", name, p.Name, exportName))
-				}
-			}
-		}
-	}
+	//   -- unexported: referenced by an exported alias in MExport, see above
 
 	// import predefined packages in the end
 	// we try to not rename packages.
 	ctxName := imps.ImportOrUseNext("context", "", "context")
-	// reflectName := imps.ImportOrUseNext("reflect", "", "reflect")
+	reflectName := ""
+	if len(generics) > 0 || numFakes > 0 {
+		reflectName = imps.ImportOrUseNext("reflect", "", "reflect")
+	}
+	syncName := imps.ImportOrUseNext("sync", "", "sync")
 	mockName := imps.ImportOrUseNext(MOCK_PKG, "_mock", "mock")
+	importList := imps.SortedList()
 
 	varMap := gen.VarMap{
 		"__PKG_NAME__": p.Name,
 		"__FULL_PKG__": p.PkgPath,
 		"__CTXP__":     ctxName,
-		// "__REFLECTP__": reflectName,
-		"__MOCKP__": mockName,
+		"__REFLECTP__": reflectName,
+		"__SYNCP__":    syncName,
+		"__MOCKP__":    mockName,
 	}
 	// example
 	// type M interface {
@@ -1350,7 +1723,7 @@ func genMockStub(p *packages.Package, fileDetails []*RewriteFileDetail) (content
 		"package __PKG_NAME__",
 		"",
 		"import (",
-		gen.Indent("    ", imps.SortedList()),
+		gen.Indent("    ", importList),
 		")",
 		"",
 		fmt.Sprintf(`const %s = true`, SKIP_MOCK_PKG),
@@ -1367,7 +1740,19 @@ func genMockStub(p *packages.Package, fileDetails []*RewriteFileDetail) (content
 		`    return __MOCKP__.WithMockSetup(ctx,FULL_PKG_NAME,m)`,
 		"}",
 		"",
-		typeAlias,
+		"var origOnce __SYNCP__.Once",
+		"var origM M",
+		"",
+		"// Orig returns original functions, calling them skips mocks,",
+		"// they are nil if not built by go-mock.",
+		"// They are looked up on first call, after init of the package",
+		"// registered them, so the stub need not import the package.",
+		"func Orig() M {",
+		"    origOnce.Do(func() {",
+		"        __MOCKP__.SetupOrig(FULL_PKG_NAME,&origM)",
+		"    })",
+		"    return origM",
+		"}",
 		"",
 		"type M struct {",
 		defs,
@@ -1383,8 +1768,78 @@ func genMockStub(p *packages.Package, fileDetails []*RewriteFileDetail) (content
 		links,
 		"}}",
 		"",
+		genericDefs,
+		fakes,
+		fakeRegDefs,
 	)
 	content = t.Format(varMap)
 
+	if len(exportAliased) == 0 {
+		return
+	}
+	for name := range exportAliased {
+		exportNames = append(exportNames, name)
+	}
+	sort.Strings(exportNames)
+	expVarMap := gen.VarMap{
+		"__PKG_NAME__": p.Name,
+		"__CTXP__":     expImps.ImportOrUseNext("context", "", "context"),
+		"__SYNCP__":    expImps.ImportOrUseNext("sync", "", "sync"),
+		"__MOCKP__":    expImps.ImportOrUseNext(MOCK_PKG, "_mock", "mock"),
+	}
+	expT := gen.NewTemplateBuilder()
+	expT.Block(
+		`// Code generated by go-mock; DO NOT EDIT.`,
+		"",
+		"// This file only exists in the rewritten copy, because",
+		"// it references unexported types by their exported aliases.",
+		"",
+		"package __PKG_NAME__",
+		"",
+		"import (",
+		gen.Indent("    ", expImps.SortedList()),
+		")",
+		"",
+		"// SetupExport is like Setup, for functions referencing unexported types.",
+		"func SetupExport(ctx __CTXP__.Context,setup func(m *MExport)) __CTXP__.Context {",
+		"    m:=MExport{}",
+		"    setup(&m)",
+		`    return __MOCKP__.WithMockSetup(ctx,FULL_PKG_NAME,m)`,
+		"}",
+		"",
+		"var origExportOnce __SYNCP__.Once",
+		"var origExportM MExport",
+		"",
+		"// OrigExport is like Orig, for functions in MExport.",
+		"func OrigExport() MExport {",
+		"    origExportOnce.Do(func() {",
+		"        __MOCKP__.SetupOrig(FULL_PKG_NAME,&origExportM)",
+		"    })",
+		"    return origExportM",
+		"}",
+		"",
+		"type MExport struct {",
+		expDefs,
+		"}",
+	)
+	exportContent = expT.Format(expVarMap)
 	return
 }
+
+// genExportAliases declares exported aliases of unexported types,
+// as a new file of the rewritten package.
+func genExportAliases(pkgName string, names []string) string {
+	var aliases []string
+	for _, name := range names {
+		aliases = append(aliases, fmt.Sprintf("type %s%s = %s", EXPORT_PREFIX, name, name))
+	}
+	t := gen.NewTemplateBuilder()
+	t.Block(
+		`// Code generated by go-mock; DO NOT EDIT.`,
+		"",
+		"package "+pkgName,
+		"",
+		aliases,
+	)
+	return t.Format(gen.VarMap{})
+}
@@ -1,10 +1,434 @@
 package inspect
 
-import "testing"
+import (
+	"go/ast"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"golang.org/x/tools/go/packages"
+)
 
 // go test -run TestHasPrefixSplit -v ./support/xgo/inspect
-func TestHasPrefixSplit(t *testing.T){
-	v := HasPrefixSplit("test/aka", "test",'/')
+func TestHasPrefixSplit(t *testing.T) {
+	v := HasPrefixSplit("test/aka", "test", '/')
+
+	t.Logf("%v", v)
+}
+
+// loadTestPackage type checks a single file package without go/packages
+func loadTestPackage(t *testing.T, file string, pkgPath string) (*packages.Package, *ast.File, string) {
+	file, err := filepath.Abs(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, file, nil, parser.ParseComments)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info := &types.Info{
+		Types: make(map[ast.Expr]types.TypeAndValue),
+		Defs:  make(map[*ast.Ident]types.Object),
+		Uses:  make(map[*ast.Ident]types.Object),
+		// as loaded by packages.Load
+		Selections: make(map[*ast.SelectorExpr]*types.Selection),
+	}
+	conf := types.Config{Importer: importer.ForCompiler(fset, "source", nil)}
+	tpkg, err := conf.Check(pkgPath, fset, []*ast.File{f}, info)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &packages.Package{PkgPath: pkgPath, Name: tpkg.Name(), Types: tpkg, TypesInfo: info, Syntax: []*ast.File{f}, Fset: fset}, f, file
+}
+
+// go test -run TestRewriteGeneric -v ./inspect
+func TestRewriteGeneric(t *testing.T) {
+	pkgPath := "example.com/generic"
+	p, f, file := loadTestPackage(t, "testdata/generic/generic.go", pkgPath)
+
+	content, detail, _, err := rewriteFile(p, pkgPath, p.Fset, f, file, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stub, _, _, err := genMockStub(p, []*RewriteFileDetail{detail})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expects := []string{
+		"TypeArgs:[]reflect.Type{reflect.TypeOf((*K)(nil)).Elem(),reflect.TypeOf((*V)(nil)).Elem()}",
+		"(*Cache[K, V])._mockCache_Get,true,true,true)",
+		"func (c *Cache[K, V]) _mockCache_Get(ctx context.Context, k K)(V, error){",
+		"(Cache[A, B])._mockCache_Len,true,true,false)",
+		"_mockSum[T],false,true,false)",
+		"func _mockSum[T Number](ctx context.Context, xs ...T)(s T){",
+		`_mock.RegisterOrigFunc(pkgPath, "","Plain",_mockPlain)`,
+	}
+	for _, expect := range expects {
+		if !strings.Contains(content, expect) {
+			t.Fatalf("expect content contains %s, actual:%s", expect, content)
+		}
+	}
+	// generic functions register on first call
+	if strings.Contains(content, `"Sum", []_mock.TypeInfo`) {
+		t.Fatalf("expect generic Sum not registered at package level, actual:%s", content)
+	}
+	stubExpects := []string{
+		"func Mock_Cache_Get[K comparable, V any](ctx context.Context, fn func(c *generic.Cache[K, V],ctx context.Context, k K)(V, error)) context.Context {",
+		"func Mock_Cache_GetAll(ctx context.Context, handler _mock.PatternHandler) context.Context {",
+		"func Mock_Sum[T generic.Number](ctx context.Context, fn func(ctx context.Context, xs ...T)(s T)) context.Context {",
+		`_mock.WithPatternMock(ctx, FULL_PKG_NAME+"::::Sum", handler)`,
+		"        _mock.SetupOrig(FULL_PKG_NAME,&origM)",
+	}
+	for _, expect := range stubExpects {
+		if !strings.Contains(stub, expect) {
+			t.Fatalf("expect stub contains %s, actual:%s", expect, stub)
+		}
+	}
+}
+
+// go test -run TestGenInterfaceFakes -v ./inspect
+func TestGenInterfaceFakes(t *testing.T) {
+	pkgPath := "example.com/fake"
+	p, f, file := loadTestPackage(t, "testdata/fake/fake.go", pkgPath)
+
+	_, detail, _, err := rewriteFile(p, pkgPath, p.Fset, f, file, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stub, _, _, err := genMockStub(p, []*RewriteFileDetail{detail})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expects := []string{
+		"type FakeStore struct {",
+		"    GetFunc func(context.Context, int64) (*fake.User, error)",
+		"    CloseFunc func() (error)",
+		"var _ fake.Store = (*FakeStore)(nil)",
+		"func (c *FakeStore) Put(ctx context.Context, unused_1 *fake.User) (err error) {",
+		"        return c.ListFunc(ctx, names...)",
+		`    _mock.FakeResults(c.Fallback, &_mock.StubInfo{PkgName: FULL_PKG_NAME, Owner: "Store", Name: "List"}, &Resp_0, &Resp_1)`,
+		`    _mock.RegisterMockStub(FULL_PKG_NAME, "Store", reflect.TypeOf((*fake.Store)(nil)).Elem(), "Get", []_mock.TypeInfo{_mock.NewTypeInfo("id", reflect.TypeOf((*int64)(nil)).Elem())}`,
+	}
+	for _, expect := range expects {
+		if !strings.Contains(stub, expect) {
+			t.Fatalf("expect stub contains %s, actual:%s", expect, stub)
+		}
+	}
+	if strings.Contains(stub, "FakeInternal") {
+		t.Fatalf("expect no FakeInternal for invisible types, actual:%s", stub)
+	}
+}
+
+// go test -run TestGenMockStubExport -v ./inspect
+func TestGenMockStubExport(t *testing.T) {
+	pkgPath := "example.com/export"
+	p, f, file := loadTestPackage(t, "testdata/export/export.go", pkgPath)
+
+	_, detail, _, err := rewriteFile(p, pkgPath, p.Fset, f, file, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stub, exportStub, exportNames, err := genMockStub(p, []*RewriteFileDetail{detail})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(exportNames, ",") != "store,user" {
+		t.Fatalf("expect %s = %+v, actual:%+v", `exportNames`, "store,user", exportNames)
+	}
+	stubExpects := []string{
+		"    Load func(ctx context.Context, c *export.Config)error",
+		"//     M_findUser: see MExport, it contains unexported types",
+	}
+	for _, expect := range stubExpects {
+		if !strings.Contains(stub, expect) {
+			t.Fatalf("expect stub contains %s, actual:%s", expect, stub)
+		}
+	}
+	// the original package has no aliases
+	if strings.Contains(stub, "MExport_") {
+		t.Fatalf("expect stub not reference aliases, actual:%s", stub)
+	}
+	exportExpects := []string{
+		"func SetupExport(ctx context.Context,setup func(m *MExport)) context.Context {",
+		"    M_findUser func(ctx context.Context, name string)(*export.MExport_user, error)",
+		"    M_store struct{",
+		"        Find func(c *export.MExport_store,ctx context.Context, name string)(*export.MExport_user, error)",
+	}
+	for _, expect := range exportExpects {
+		if !strings.Contains(exportStub, expect) {
+			t.Fatalf("expect export stub contains %s, actual:%s", expect, exportStub)
+		}
+	}
+	aliases := genExportAliases(p.Name, exportNames)
+	if !strings.Contains(aliases, "type MExport_user = user") {
+		t.Fatalf("expect aliases contains %s, actual:%s", "type MExport_user = user", aliases)
+	}
+}
+
+// go test -run TestGenMockStubExportTypeCheck -v ./inspect
+func TestGenMockStubExportTypeCheck(t *testing.T) {
+	pkgPath := "example.com/export"
+	p, f, file := loadTestPackage(t, "testdata/export/export.go", pkgPath)
+
+	content, detail, _, err := rewriteFile(p, pkgPath, p.Fset, f, file, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stub, exportStub, exportNames, err := genMockStub(p, []*RewriteFileDetail{detail})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the rewritten copy of the package, then test/mock_gen importing it
+	fset := token.NewFileSet()
+	srcImporter := importer.ForCompiler(fset, "source", nil)
+	rewritten := typeCheckSources(t, fset, pkgPath, srcImporter, map[string]string{
+		"export.go":      content,
+		"mock_export.go": genExportAliases(p.Name, exportNames),
+	})
+	imp := importerFunc(func(path string) (*types.Package, error) {
+		if path == pkgPath {
+			return rewritten, nil
+		}
+		return srcImporter.Import(path)
+	})
+	typeCheckSources(t, fset, pkgPath+"/test/mock_gen", imp, map[string]string{
+		"mock.go":        stub,
+		"mock_export.go": exportStub,
+	})
+}
+
+type importerFunc func(path string) (*types.Package, error)
+
+func (c importerFunc) Import(path string) (*types.Package, error) {
+	return c(path)
+}
+
+// typeCheckSources type checks generated files as a package
+func typeCheckSources(t *testing.T, fset *token.FileSet, pkgPath string, imp types.Importer, sources map[string]string) *types.Package {
+	names := make([]string, 0, len(sources))
+	for name := range sources {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	files := make([]*ast.File, 0, len(names))
+	for _, name := range names {
+		f, err := parser.ParseFile(fset, name, sources[name], 0)
+		if err != nil {
+			t.Fatalf("parse %s: %v, content:%s", name, err, sources[name])
+		}
+		files = append(files, f)
+	}
+	conf := types.Config{Importer: imp}
+	tpkg, err := conf.Check(pkgPath, fset, files, nil)
+	if err != nil {
+		t.Fatalf("type check %s: %v", pkgPath, err)
+	}
+	return tpkg
+}
+
+// go test -run TestCanImportInternal -v ./inspect
+func TestCanImportInternal(t *testing.T) {
+	cases := []struct {
+		importer string
+		pkgPath  string
+		expect   bool
+	}{
+		{"example.com/m", "example.com/m/internal/a", true},
+		{"example.com/m", "example.com/m/internal", true},
+		{"example.com/m", "example.com/m/b/internal/a", false},
+		{"example.com/m/b/c", "example.com/m/b/internal/a", true},
+		{"example.com/m/bc", "example.com/m/b/internal/a", false},
+		{"example.com/m/b", "example.com/m/internal/x/internal/y", false},
+		{"example.com/m", "internal/poll", false},
+		{"example.com/m", "example.com/m/internals", true},
+	}
+	for _, c := range cases {
+		if v := CanImportInternal(c.importer, c.pkgPath); v != c.expect {
+			t.Fatalf("expect CanImportInternal(%q,%q) = %+v, actual:%+v", c.importer, c.pkgPath, c.expect, v)
+		}
+	}
+}
+
+// go test -run TestGenInPackageSetup -v ./inspect
+func TestGenInPackageSetup(t *testing.T) {
+	pkgPath := "example.com/setup"
+	p, f, file := loadTestPackage(t, "testdata/setup/main.go", pkgPath)
+	if !NeedInPackageSetup(p) {
+		t.Fatalf("expect %s = %+v, actual:%+v", `NeedInPackageSetup(p)`, true, false)
+	}
+	_, detail, _, err := rewriteFile(p, pkgPath, p.Fset, f, file, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	setup := genInPackageSetup(p, []*RewriteFileDetail{detail})
+	expects := []string{
+		"package main",
+		"func MockSetup(ctx context.Context,setup func(m *MockM)) context.Context {",
+		`    return _mock.WithMockSetup(ctx,"example.com/setup",m)`,
+		"func MockOrig() MockM {",
+		`        _mock.SetupOrig("example.com/setup",&mockOrigM)`,
+		"    M_loadJob func(ctx context.Context, name string)(*job, error)",
+		"        Run func(c *job,ctx context.Context, timeout time.Duration)error",
+	}
+	for _, expect := range expects {
+		if !strings.Contains(setup, expect) {
+			t.Fatalf("expect setup contains %s, actual:%s", expect, setup)
+		}
+	}
+}
+
+// go test -run TestRewriteGoStmt -v ./inspect
+func TestRewriteGoStmt(t *testing.T) {
+	pkgPath := "example.com/gostmt"
+	p, f, file := loadTestPackage(t, "testdata/gostmt/gostmt.go", pkgPath)
+
+	content, _, _, err := rewriteFile(p, pkgPath, p.Fset, f, file, &RewriteOptions{PropagateGo: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expects := []string{
+		"{_mockgoctx := _mock.GetLocalContext(); _mockfn, _mockarg0 := func(id int64) {",
+		"{_mockgoctx := _mock.GetLocalContext(); _mockfn, _mockarg1, _mockarg3 := Notify, id, done; go func() { _mock.SetLocalContext(_mockgoctx); defer _mock.ClearLocalContext(); _mockfn(nil, _mockarg1, 1, _mockarg3) }()}",
+		"}, id; go func() { _mock.SetLocalContext(_mockgoctx); defer _mock.ClearLocalContext(); _mockfn(_mockarg0) }()}",
+		"_mockfn, _mockarg1 := add, len(ids); go func() { _mock.SetLocalContext(_mockgoctx); defer _mock.ClearLocalContext(); _mockfn(1, _mockarg1) }()}",
+		// not supported
+		`go println("started")`,
+		"go add(pair())",
+		"go flag(len(ids) > 0)",
+	}
+	for _, expect := range expects {
+		if !strings.Contains(content, expect) {
+			t.Fatalf("expect content contains %s, actual:%s", expect, content)
+		}
+	}
+}
+
+// go test -run TestRewriteClock -v ./inspect
+func TestRewriteClock(t *testing.T) {
+	pkgPath := "example.com/clock"
+	p, f, file := loadTestPackage(t, "testdata/clock/clock.go", pkgPath)
+
+	content, _, _, err := rewriteFile(p, pkgPath, p.Fset, f, file, &RewriteOptions{PropagateGo: true, VirtualClock: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expects := []string{
+		`import _mockclock "github.com/xhd2015/go-mock/mock/clock"`,
+		"return _mockclock.Now().After(deadline)",
+		"_mockclock.Sleep(interval)",
+		"println(_mockclock.Since(start).String())",
+		"t := _mockclock.NewTimer(d)",
+		"defer _mockclock.StopTimer(t)",
+		"_mockclock.ResetTimer(t, d * 2)",
+		"case <-_mockclock.After(d * 3):",
+		// restructured by go statement, the method is not redirected
+		"_mockfn := _mockclock.NewTimer(d).Stop;",
+		// the time import is kept used
+		"var _ stdtime.Duration",
+		// types are not redirected
+		"deadline stdtime.Time",
+	}
+	for _, expect := range expects {
+		if !strings.Contains(content, expect) {
+			t.Fatalf("expect content contains %s, actual:%s", expect, content)
+		}
+	}
+}
+
+// go test -run TestRewriteSQL -v ./inspect
+func TestRewriteSQL(t *testing.T) {
+	pkgPath := "example.com/sqldao"
+	p, f, file := loadTestPackage(t, "testdata/sqldao/sqldao.go", pkgPath)
+
+	content, _, _, err := rewriteFile(p, pkgPath, p.Fset, f, file, &RewriteOptions{MockSQL: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expects := []string{
+		`import _mocksql "github.com/xhd2015/go-mock/mock/sqlmock"`,
+		`err := _mocksql.DBQueryRowContext(c.db, ctx, "SELECT id, name FROM users WHERE id = ?", id).Scan(&u.ID, &u.Name)`,
+		`_mocksql.TxExecContext(tx, ctx, "UPDATE users SET name = ? WHERE id = ?", args...)`,
+		// through interfaces with the same methods
+		`err := _mocksql.QueryRowContext(q.db, ctx, "SELECT count(*) FROM users").Scan(&n)`,
+		// other methods are not redirected
+		`return e.ExecContext(ctx, "TRUNCATE users")`,
+		"c.db.BeginTx(ctx, nil)",
+		"defer tx.Rollback()",
+	}
+	for _, expect := range expects {
+		if !strings.Contains(content, expect) {
+			t.Fatalf("expect content contains %s, actual:%s", expect, content)
+		}
+	}
+}
+
+// go test -run TestRewriteHTTP -v ./inspect
+func TestRewriteHTTP(t *testing.T) {
+	pkgPath := "example.com/httpclient"
+	p, f, file := loadTestPackage(t, "testdata/httpclient/httpclient.go", pkgPath)
+
+	content, _, _, err := rewriteFile(p, pkgPath, p.Fset, f, file, &RewriteOptions{MockHTTP: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expects := []string{
+		`import _mockhttp "github.com/xhd2015/go-mock/mock/httpmock"`,
+		`return _mockhttp.ClientDo(c.client, req)`,
+		`resp, err := _mockhttp.ClientHead(c.client, url)`,
+		// other methods are not redirected
+		"c.client.CloseIdleConnections()",
+	}
+	for _, expect := range expects {
+		if !strings.Contains(content, expect) {
+			t.Fatalf("expect content contains %s, actual:%s", expect, content)
+		}
+	}
+}
+
+// go test -run TestRewriteGRPC -v ./inspect
+func TestRewriteGRPC(t *testing.T) {
+	pkgPath := GRPC_PKG
+	p, f, file := loadTestPackage(t, "testdata/grpc/call.go", pkgPath)
+
+	content, _, _, err := rewriteFile(p, pkgPath, p.Fset, f, file, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := `&_mock.StubInfo{PkgName:"google.golang.org/grpc",Owner:"ClientConn",OwnerPtr:true,Name:"Invoke"}`
+	if !strings.Contains(content, expect) {
+		t.Fatalf("expect content contains %s, actual:%s", expect, content)
+	}
+	// other functions of grpc are not rewritten
+	if n := strings.Count(content, "_mock.TrapFunc"); n != 1 {
+		t.Fatalf("expect %s = %+v, actual:%+v", "TrapFunc count", 1, n)
+	}
+}
+
+// go test -run TestGenMockStubOrig -v ./inspect
+func TestGenMockStubOrig(t *testing.T) {
+	pkgPath := "example.com/print"
+	p, f, file := loadTestPackage(t, "testdata/print/print.go", pkgPath)
 
-	t.Logf("%v",v)
-}
\ No newline at end of file
+	_, detail, _, err := rewriteFile(p, pkgPath, p.Fset, f, file, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stub, _, _, err := genMockStub(p, []*RewriteFileDetail{detail})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(stub, "func Orig() M {") {
+		t.Fatalf("expect stub contains Orig(), actual:%s", stub)
+	}
+	// a blank import of the package causes import cycle in its in-package tests
+	if strings.Contains(stub, `_ "`+pkgPath+`"`) {
+		t.Fatalf("expect stub not import %s for Orig, actual:%s", pkgPath, stub)
+	}
+}
@@ -0,0 +1,189 @@
+package inspect
+
+import (
+	"fmt"
+	"go/types"
+	"reflect"
+
+	"github.com/xhd2015/go-mock/inspect/typeinfo"
+)
+
+// StubSchema is the JSON Schema of req and resp of a trapped function,
+// as serialized for interceptors and mock data
+type StubSchema struct {
+	*StubDetail
+	Req  *typeinfo.Type `json:"req"`
+	Resp *typeinfo.Type `json:"resp"`
+}
+
+// StubsSchema is the JSON Schema of stubs, sharing definitions
+type StubsSchema struct {
+	Version     string               `json:"$schema"`
+	Stubs       []*StubSchema        `json:"stubs"`
+	Definitions typeinfo.Definitions `json:"definitions,omitempty"`
+}
+
+// GenStubsSchema generates schema of stubs statically, like
+// typeinfo.GenSchema does for reflect.Type.
+func GenStubsSchema(stubs []*StubDetail) *StubsSchema {
+	g := NewSchemaGenerator()
+	list := make([]*StubSchema, 0, len(stubs))
+	for _, stub := range stubs {
+		list = append(list, &StubSchema{
+			StubDetail: stub,
+			Req:        g.GenFields(stub.Args),
+			Resp:       g.GenFields(stub.Results),
+		})
+	}
+	return &StubsSchema{
+		Version:     typeinfo.Version,
+		Stubs:       list,
+		Definitions: g.Definitions(),
+	}
+}
+
+// SchemaGenerator generates JSON Schema from go/types by TypeExpr,
+// named types and composite types are put into definitions.
+type SchemaGenerator struct {
+	exprs map[types.Type]*TypeExpr
+	defs  map[*TypeExpr]*typeinfo.Type
+}
+
+func NewSchemaGenerator() *SchemaGenerator {
+	return &SchemaGenerator{
+		exprs: make(map[types.Type]*TypeExpr),
+		defs:  make(map[*TypeExpr]*typeinfo.Type),
+	}
+}
+
+// Gen returns schema of t, which may be referenced by typeinfo.RefOrUse
+func (c *SchemaGenerator) Gen(t types.Type) *typeinfo.Type {
+	return c.gen(buildTypeExpr(t, c.exprs))
+}
+
+// GenFields returns schema of an object whose properties are fields, by their names
+func (c *SchemaGenerator) GenFields(fields FieldList) *typeinfo.Type {
+	s := &typeinfo.Type{
+		Type:       "object",
+		Properties: typeinfo.NewSortedMap(len(fields)),
+	}
+	for _, f := range fields {
+		s.Properties.Set(f.Name, typeinfo.RefOrUse(c.Gen(f.Type.ResolvedType)))
+	}
+	return s
+}
+
+// Definitions returns all definitions generated so far
+func (c *SchemaGenerator) Definitions() typeinfo.Definitions {
+	schemaDefs := make(typeinfo.Definitions, len(c.defs))
+	for _, v := range c.defs {
+		if v.URI == "" {
+			continue
+		}
+		schemaDefs[v.URI] = v
+	}
+	return schemaDefs
+}
+
+const schemaURIPrefix = "go:///"
+
+func (c *SchemaGenerator) gen(e *TypeExpr) *typeinfo.Type {
+	switch e.Kind {
+	case Basic:
+		return basicSchema(e.Name)
+	case Ptr:
+		return c.gen(e.Elem)
+	case Named:
+		if e.PkgPath == "time" && e.Name == "Time" {
+			// date-time RFC section 7.3.1
+			return &typeinfo.Type{Type: "string", Format: "date-time"}
+		}
+		switch e.Underlying.Kind {
+		case Basic, Interface, Func, Chan:
+			// named basic types are inlined
+			return c.gen(e.Underlying)
+		}
+	case Struct, Slice, Array, Map:
+	default:
+		// interface, func, chan and type params are unknown
+		return &typeinfo.Type{}
+	}
+
+	s := c.defs[e]
+	if s != nil {
+		return s
+	}
+	s = &typeinfo.Type{}
+	if e.Kind == Named {
+		s.URI = schemaURIPrefix + e.Expr
+	} else {
+		s.URI = fmt.Sprintf("%s%d", schemaURIPrefix, len(c.defs))
+	}
+	c.defs[e] = s
+
+	u := e
+	if e.Kind == Named {
+		u = e.Underlying
+	}
+	switch u.Kind {
+	case Struct:
+		s.Type = "object"
+		s.Properties = typeinfo.NewSortedMap(len(u.Fields))
+		for _, field := range u.Fields {
+			if field.Anonymous {
+				subType := c.gen(field.Type)
+				if subType.Type == "object" && subType.Properties != nil {
+					// merge sorted map
+					subType.Properties.Range(func(key string, val interface{}) bool {
+						s.Properties.Set(key, val)
+						return true
+					})
+				}
+				continue
+			}
+			jsonName, _ := typeinfo.GetExportedJSONName(&reflect.StructField{Name: field.Name, Tag: reflect.StructTag(field.Tag)})
+			if jsonName == "" {
+				continue
+			}
+			s.Properties.Set(jsonName, typeinfo.RefOrUse(c.gen(field.Type)))
+		}
+	case Array, Slice:
+		s.Type = "array"
+		if u.Kind == Array {
+			s.MinItems = u.Len
+			s.MaxItems = u.Len
+		}
+		s.Items = typeinfo.RefOrUse(c.gen(u.Elem))
+	case Map:
+		s.Type = "object"
+		patternKey := ".*"
+		if isIntegerSchema(c.gen(u.Key)) {
+			patternKey = "^[0-9]+$"
+			s.AdditionalProperties = []byte("false")
+		}
+		s.PatternProperties = map[string]*typeinfo.Type{
+			patternKey: typeinfo.RefOrUse(c.gen(u.Elem)),
+		}
+	}
+	return s
+}
+
+func basicSchema(name string) *typeinfo.Type {
+	switch name {
+	case "int", "int8", "int16", "int32", "int64",
+		"uint", "uint8", "uint16", "uint32", "uint64", "byte", "rune":
+		return &typeinfo.Type{Type: "integer"}
+	case "float32", "float64":
+		return &typeinfo.Type{Type: "number"}
+	case "bool":
+		return &typeinfo.Type{Type: "boolean"}
+	case "string":
+		return &typeinfo.Type{Type: "string"}
+	}
+	// uintptr, unsafe.Pointer and complex numbers, don't know how to handle
+	return &typeinfo.Type{}
+}
+
+func isIntegerSchema(s *typeinfo.Type) bool {
+	return s.URI == "" && s.Type == "integer"
+}
@@ -90,6 +90,32 @@ func TestUnmarshalOmitEmpty(t *testing.T) {
 	}
 }
 
+// go test -run TestUnmarshalOmitEmptyZeroDest -v ./support/mock
+func TestUnmarshalOmitEmptyZeroDest(t *testing.T) {
+	// omitempty fields with a zero destination are populated, like
+	// encoding/json does, they used to be skipped
+	type reply struct {
+		Name  string            `json:"name,omitempty"`
+		Count int               `json:"count,omitempty"`
+		Next  *string           `json:"next,omitempty"`
+		Tags  map[string]string `json:"tags,omitempty"`
+	}
+	data := []byte(`{"name":"a","count":2,"next":"b","tags":{"k":"v"}}`)
+	var v reply
+	err := Unmarshal(data, &v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var expect reply
+	err = json.Unmarshal(data, &expect)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v.Name != "a" || v.Count != 2 || v.Next == nil || *v.Next != "b" || v.Tags["k"] != "v" {
+		t.Fatalf("expect %s = %+v, actual:%+v", `v`, expect, v)
+	}
+}
+
 // go test -run TestJSONSerializeGuessBytes -v ./support/mock
 func TestJSONSerializeGuessBytes(t *testing.T) {
 	var v = struct {
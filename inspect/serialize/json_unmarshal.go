@@ -273,13 +273,11 @@ func doUnmarshal(v reflect.Value, m interface{}, path []string, rootCause *strin
 			if fieldType.Anonymous {
 				continue
 			}
-			jsonName, omitEmpty := typeinfo.GetExportedJSONName(&fieldType)
+			// omitempty only applies to marshal
+			jsonName, _ := typeinfo.GetExportedJSONName(&fieldType)
 			if jsonName == "" {
 				continue
 			}
-			if omitEmpty && typeinfo.IsZero(field) {
-				continue
-			}
 			mpVal, ok := mp[jsonName]
 			if !ok {
 				continue
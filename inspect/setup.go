@@ -0,0 +1,203 @@
+package inspect
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"go/types"
+	"strings"
+
+	"github.com/xhd2015/go-mock/code/gen"
+	"golang.org/x/tools/go/packages"
+)
+
+// stubs in test/mock_gen import the package they mock, which is impossible
+// for package main, and for packages under an internal directory not
+// rooted at or above the module root.
+// Such packages get an in-package setup file instead, which only exists
+// in the rewritten copy, so it can be used by tests of the package itself.
+
+const (
+	IN_PKG_SETUP = "MockSetup"
+	IN_PKG_M     = "MockM"
+	IN_PKG_ORIG  = "MockOrig"
+)
+
+// package level names declared by the in-package setup
+var inPkgSetupNames = []string{IN_PKG_SETUP, IN_PKG_M, IN_PKG_ORIG, "mockOrigOnce", "mockOrigM"}
+
+// NeedInPackageSetup tells whether stubs of p cannot be generated into
+// test/mock_gen.
+func NeedInPackageSetup(p *packages.Package) bool {
+	if p.Name == "main" {
+		return true
+	}
+	return IsInternalPkg(p.PkgPath) && !CanImportInternal(moduleOf(p), p.PkgPath)
+}
+
+// CanImportInternal tells whether importer can import pkgPath by the
+// internal rule: a path containing an internal element can only be imported
+// by paths rooted at the parent of the last internal element.
+func CanImportInternal(importer string, pkgPath string) bool {
+	var i int
+	switch {
+	case HasSuffixSplit(pkgPath, "internal", '/'):
+		i = len(pkgPath) - len("internal")
+	case strings.Contains(pkgPath, "/internal/"):
+		i = strings.LastIndex(pkgPath, "/internal/") + 1
+	case strings.HasPrefix(pkgPath, "internal/"):
+		i = 0
+	default:
+		return true
+	}
+	parent := strings.TrimSuffix(pkgPath[:i], "/")
+	if parent == "" {
+		// internal of std
+		return false
+	}
+	return HasPrefixSplit(importer, parent, '/')
+}
+
+// HasSuffixSplit is the suffix version of HasPrefixSplit
+func HasSuffixSplit(s string, e string, split byte) bool {
+	ns, ne := len(s), len(e)
+	if ns < ne || s[ns-ne:] != e {
+		return false
+	}
+	return ns == ne || s[ns-ne-1] == split
+}
+
+// moduleOf returns the module path of p, used as the importer
+// of stubs, which are all placed under the module root.
+func moduleOf(p *packages.Package) string {
+	if p.Module == nil {
+		return ""
+	}
+	return p.Module.Path
+}
+
+// genInPackageSetup generates MockSetup, MockM and MockOrig of package p,
+// which are like Setup, M and Orig in test/mock_gen, but declared in p
+// itself, so all types are visible.
+// Generic functions are skipped, they are mocked by mock.WithGenericMock.
+// Returns "" if nothing to setup.
+func genInPackageSetup(p *packages.Package, fileDetails []*RewriteFileDetail) string {
+	scope := p.Types.Scope()
+	for _, name := range inPkgSetupNames {
+		if scope.Lookup(name) != nil {
+			return ""
+		}
+	}
+	imps := NewImportList()
+	imps.CanUseName = func(name string) bool {
+		// file imports must not conflict with package level names
+		return scope.Lookup(name) == nil
+	}
+	// qualify types from other packages, types of p are kept as is
+	rePkg := func(node ast.Node, getNodeText func(start token.Pos, end token.Pos) []byte) ([]byte, bool) {
+		if idt, ok := node.(*ast.Ident); ok {
+			// dot import
+			if t, ok := p.TypesInfo.Uses[idt].(*types.TypeName); ok && t.Pkg() != nil && t.Pkg() != p.Types {
+				name := imps.ImportOrUseNext(t.Pkg().Path(), "", t.Pkg().Name())
+				return []byte(fmt.Sprintf("%s.%s", name, idt.Name)), true
+			}
+		} else if sel, ok := node.(*ast.SelectorExpr); ok {
+			if idt, ok := sel.X.(*ast.Ident); ok {
+				if pkgName, ok := p.TypesInfo.Uses[idt].(*types.PkgName); ok {
+					name := imps.ImportOrUseNext(pkgName.Imported().Path(), pkgName.Name(), pkgName.Imported().Name())
+					return []byte(fmt.Sprintf("%s.%s", name, sel.Sel.Name)), true
+				}
+			}
+		}
+		return nil, false
+	}
+
+	var defs gen.Statements
+	defByOwner := make(map[string]*gen.Statements)
+	n := 0
+	for _, fd := range fileDetails {
+		for _, d := range fd.Funcs {
+			rc := d.RewriteConfig
+			if len(rc.TypeParams) > 0 {
+				continue
+			}
+			def, ok := defByOwner[rc.Owner]
+			if !ok {
+				def = &gen.Statements{}
+				if rc.Owner != "" {
+					oname := rc.Owner
+					if !rc.Recv.Type.Exported {
+						oname = "M_" + oname
+					}
+					defs.Append(
+						fmt.Sprintf("    %s struct{", oname),
+						gen.Indent("        ", def),
+						"    }",
+					)
+				} else {
+					defs.Append(def)
+				}
+				defByOwner[rc.Owner] = def
+			}
+			refFuncName := rc.FuncName
+			if !rc.Exported {
+				refFuncName = "M_" + refFuncName
+			}
+			args := d.ArgsRewritter(rePkg, CombineHooks(recvArgsRenameHook(rc)))
+			results := d.ResultsRewritter(rePkg, nil)
+			def.Append(fmt.Sprintf("    %s func%s%s", refFuncName, args, results))
+			n++
+		}
+	}
+	if n == 0 {
+		return ""
+	}
+
+	varMap := gen.VarMap{
+		"__PKG_NAME__": p.Name,
+		"__FULL_PKG__": p.PkgPath,
+		"__SETUP__":    IN_PKG_SETUP,
+		"__M__":        IN_PKG_M,
+		"__ORIG__":     IN_PKG_ORIG,
+		"__CTXP__":     imps.ImportOrUseNext("context", "", "context"),
+		"__MOCKP__":    imps.ImportOrUseNext(MOCK_PKG, "_mock", "mock"),
+		"__SYNCP__":    imps.ImportOrUseNext("sync", "", "sync"),
+	}
+	t := gen.NewTemplateBuilder()
+	t.Block(
+		`// Code generated by go-mock; DO NOT EDIT.`,
+		"",
+		"// This file only exists in the rewritten copy, because",
+		"// test/mock_gen cannot import this package.",
+		"",
+		"package __PKG_NAME__",
+		"",
+		"import (",
+		gen.Indent("    ", imps.SortedList()),
+		")",
+		"",
+		"// __SETUP__ is like Setup of test/mock_gen, for tests in this package.",
+		"func __SETUP__(ctx __CTXP__.Context,setup func(m *__M__)) __CTXP__.Context {",
+		"    m:=__M__{}",
+		"    setup(&m)",
+		`    return __MOCKP__.WithMockSetup(ctx,"__FULL_PKG__",m)`,
+		"}",
+		"",
+		"var mockOrigOnce __SYNCP__.Once",
+		"var mockOrigM __M__",
+		"",
+		"// __ORIG__ is like Orig of test/mock_gen, it returns original",
+		"// functions, calling them skips mocks.",
+		"func __ORIG__() __M__ {",
+		"    mockOrigOnce.Do(func() {",
+		`        __MOCKP__.SetupOrig("__FULL_PKG__",&mockOrigM)`,
+		"    })",
+		"    return mockOrigM",
+		"}",
+		"",
+		"type __M__ struct {",
+		defs,
+		"}",
+	)
+	return t.Format(varMap)
+}
@@ -0,0 +1,27 @@
+package inspect
+
+// MOCK_SQL_PKG provides trapped replacements of database/sql
+// methods, see RewriteOptions.MockSQL
+const MOCK_SQL_PKG = "github.com/xhd2015/go-mock/mock/sqlmock"
+
+// sqlDBMethods maps methods of *sql.DB to their replacement
+var sqlDBMethods = map[string]string{
+	"QueryContext":    "DBQueryContext",
+	"QueryRowContext": "DBQueryRowContext",
+	"ExecContext":     "DBExecContext",
+}
+
+// sqlTxMethods maps methods of *sql.Tx to their replacement
+var sqlTxMethods = map[string]string{
+	"QueryContext":    "TxQueryContext",
+	"QueryRowContext": "TxQueryRowContext",
+	"ExecContext":     "TxExecContext",
+}
+
+// sqlInterfaceMethods maps methods of interfaces, with the same signature
+// as the method of *sql.DB, to their replacement, which checks the dynamic type
+var sqlInterfaceMethods = map[string]string{
+	"QueryContext":    "QueryContext",
+	"QueryRowContext": "QueryRowContext",
+	"ExecContext":     "ExecContext",
+}
@@ -0,0 +1,117 @@
+package inspect
+
+import (
+	"go/token"
+	"go/types"
+	"sort"
+
+	"golang.org/x/tools/go/packages"
+)
+
+// StubStatus tells whether the stub of a trapped function can be used
+type StubStatus string
+
+const (
+	// STUB_USABLE the stub is typed in Setup of test/mock_gen
+	STUB_USABLE StubStatus = "usable"
+	// STUB_EXPORTED the stub is typed in SetupExport, which references
+	// aliases of unexported types, so it is only usable by the rewritten copy
+	STUB_EXPORTED StubStatus = "exported"
+	// STUB_INVISIBLE the stub is commented out, because it contains types
+	// invisible to test/mock_gen
+	STUB_INVISIBLE StubStatus = "invisible"
+	// STUB_IN_PACKAGE the stub is typed in MockSetup of the package itself,
+	// see NeedInPackageSetup
+	STUB_IN_PACKAGE StubStatus = "in_package"
+	// STUB_NONE the function has no stub, but can still be mocked by
+	// mock.WithGenericMock, or by interceptors.
+	STUB_NONE StubStatus = "none"
+)
+
+// StubDetail describes a function trapped by the rewrite
+type StubDetail struct {
+	Pkg       string     `json:"pkg"`
+	Owner     string     `json:"owner,omitempty"`
+	OwnerPtr  bool       `json:"owner_ptr,omitempty"`
+	Name      string     `json:"name"`
+	Signature string     `json:"signature"`
+	File      string     `json:"file"`                // the source file
+	StubFile  string     `json:"stub_file,omitempty"` // filled by the caller, who knows where stubs are generated
+	Status    StubStatus `json:"status"`
+
+	// Args and Results are fields of req and resp seen
+	// by interceptors, ctx and error are excluded.
+	Args    FieldList `json:"-"`
+	Results FieldList `json:"-"`
+}
+
+// CollectStubs runs the rewrite on pkgs like RewritePackages, but only
+// returns functions trapped, ordered by package.
+func CollectStubs(fset *token.FileSet, pkgs []*packages.Package, opts *RewriteOptions) []*StubDetail {
+	var stubs []*StubDetail
+	for _, p := range pkgs {
+		if p.Types.Scope().Lookup(SKIP_MOCK_PKG) != nil {
+			continue
+		}
+		qualifier := func(pkg *types.Package) string {
+			if pkg == p.Types {
+				return ""
+			}
+			return pkg.Name()
+		}
+		files, fileDetails := rewritePackageFiles(p, fset, opts)
+		for _, fd := range fileDetails {
+			if fd == nil || files[fd.FilePath] == nil || files[fd.FilePath].Error != nil {
+				continue
+			}
+			for _, d := range fd.Funcs {
+				rc := d.RewriteConfig
+				signature := ""
+				if fn, ok := p.TypesInfo.Defs[d.Decl.Name].(*types.Func); ok {
+					signature = types.TypeString(fn.Type(), qualifier)
+				}
+				stubs = append(stubs, &StubDetail{
+					Pkg:       p.PkgPath,
+					Owner:     rc.Owner,
+					OwnerPtr:  rc.OwnerPtr,
+					Name:      rc.FuncName,
+					Signature: signature,
+					File:      d.File,
+					Status:    stubStatusOf(p, d),
+					Args:      rc.Args,
+					Results:   rc.Results,
+				})
+			}
+		}
+	}
+	sort.SliceStable(stubs, func(i, j int) bool {
+		return stubs[i].Pkg < stubs[j].Pkg
+	})
+	return stubs
+}
+
+// stubStatusOf mirrors how genMockStub and genInPackageSetup generate the stub of d
+func stubStatusOf(p *packages.Package, d *rewriteFuncDetail) StubStatus {
+	rc := d.RewriteConfig
+	generic := len(rc.TypeParams) > 0
+	if NeedInPackageSetup(p) {
+		if generic {
+			return STUB_NONE
+		}
+		return STUB_IN_PACKAGE
+	}
+	visible := rc.FullArgs.AllTypesVisible() && rc.FullResults.AllTypesVisible()
+	if generic {
+		if !visible || !typeParamsVisible(d.TypeParams, moduleOf(p)) {
+			return STUB_INVISIBLE
+		}
+		return STUB_USABLE
+	}
+	if visible {
+		return STUB_USABLE
+	}
+	if rc.FullArgs.AllTypesExportable() && rc.FullResults.AllTypesExportable() && (rc.Recv == nil || rc.Recv.Type.Exportable) {
+		return STUB_EXPORTED
+	}
+	return STUB_INVISIBLE
+}
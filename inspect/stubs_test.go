@@ -0,0 +1,64 @@
+package inspect
+
+import (
+	"encoding/json"
+	"testing"
+
+	"golang.org/x/tools/go/packages"
+)
+
+// go test -run TestCollectStubs -v ./inspect
+func TestCollectStubs(t *testing.T) {
+	pkgPath := "example.com/export"
+	p, _, _ := loadTestPackage(t, "testdata/export/export.go", pkgPath)
+
+	stubs := CollectStubs(p.Fset, []*packages.Package{p}, nil)
+	if len(stubs) != 3 {
+		t.Fatalf("expect %s = %+v, actual:%+v", "len(stubs)", 3, len(stubs))
+	}
+	expects := []struct {
+		owner     string
+		name      string
+		signature string
+		status    StubStatus
+	}{
+		{"", "findUser", "func(ctx context.Context, name string) (*user, error)", STUB_EXPORTED},
+		{"store", "Find", "func(ctx context.Context, name string) (*user, error)", STUB_EXPORTED},
+		{"", "Load", "func(ctx context.Context, c *Config) error", STUB_USABLE},
+	}
+	for i, expect := range expects {
+		stub := stubs[i]
+		if stub.Pkg != pkgPath || stub.Owner != expect.owner || stub.Name != expect.name {
+			t.Fatalf("expect %s = %+v, actual:%+v", "stub", expect, stub)
+		}
+		if stub.Signature != expect.signature {
+			t.Fatalf("expect %s = %+v, actual:%+v", stub.Name+".Signature", expect.signature, stub.Signature)
+		}
+		if stub.Status != expect.status {
+			t.Fatalf("expect %s = %+v, actual:%+v", stub.Name+".Status", expect.status, stub.Status)
+		}
+	}
+	if !stubs[1].OwnerPtr {
+		t.Fatalf("expect %s = %+v, actual:%+v", "Find.OwnerPtr", true, false)
+	}
+}
+
+// go test -run TestGenStubsSchema -v ./inspect
+func TestGenStubsSchema(t *testing.T) {
+	pkgPath := "example.com/export"
+	p, _, _ := loadTestPackage(t, "testdata/export/export.go", pkgPath)
+
+	schema := GenStubsSchema(CollectStubs(p.Fset, []*packages.Package{p}, nil))
+	data, err := json.Marshal(schema.Stubs[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := `{"pkg":"example.com/export","name":"findUser","signature":"func(ctx context.Context, name string) (*user, error)","file":"` + schema.Stubs[0].File + `","status":"exported","req":{"properties":{"name":{"type":"string"}},"type":"object"},"resp":{"properties":{"Resp_0":{"$ref":"go:///example.com/export.user"}},"type":"object"}}`
+	if string(data) != expect {
+		t.Fatalf("expect %s = %+v, actual:%+v", "findUser schema", expect, string(data))
+	}
+	user := schema.Definitions["go:///example.com/export.user"]
+	if user == nil || user.Type != "object" || user.Properties.Get("Name") == nil {
+		t.Fatalf("expect %s = %+v, actual:%+v", "user definition", "object with Name", user)
+	}
+}
@@ -0,0 +1,40 @@
+package clock
+
+import (
+	"context"
+	stdtime "time"
+)
+
+func Expired(ctx context.Context, deadline stdtime.Time) bool {
+	return stdtime.Now().After(deadline)
+}
+
+func Retry(ctx context.Context, n int, interval stdtime.Duration, fn func() error) (err error) {
+	start := stdtime.Now()
+	for i := 0; i < n; i++ {
+		if err = fn(); err == nil {
+			return nil
+		}
+		stdtime.Sleep(interval)
+	}
+	println(stdtime.Since(start).String())
+	return err
+}
+
+func Wait(ctx context.Context, d stdtime.Duration, done <-chan struct{}) bool {
+	t := stdtime.NewTimer(d)
+	defer t.Stop()
+	t.Reset(d * 2)
+	select {
+	case <-t.C:
+		return false
+	case <-done:
+		return true
+	case <-stdtime.After(d * 3):
+		return false
+	}
+}
+
+func Timeout(d stdtime.Duration) {
+	go stdtime.NewTimer(d).Stop()
+}
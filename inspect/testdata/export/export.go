@@ -0,0 +1,28 @@
+package export
+
+import "context"
+
+type user struct {
+	Name string
+}
+
+type store struct {
+	users map[string]*user
+}
+
+type Config struct{}
+
+// findUser references unexported user
+func findUser(ctx context.Context, name string) (*user, error) {
+	return &user{Name: name}, nil
+}
+
+// Find has an unexported receiver
+func (c *store) Find(ctx context.Context, name string) (*user, error) {
+	return c.users[name], nil
+}
+
+// Load only has visible types
+func Load(ctx context.Context, c *Config) error {
+	return nil
+}
@@ -0,0 +1,30 @@
+package fake
+
+import (
+	"context"
+	"io"
+)
+
+type User struct {
+	Name string
+}
+
+type Store interface {
+	Get(ctx context.Context, id int64) (*User, error)
+	Put(context.Context, *User) error
+	List(ctx context.Context, names ...string) ([]*User, int, error)
+	io.Closer
+}
+
+// unexported method, cannot be faked outside
+type private interface {
+	get() int
+}
+
+type Internal interface {
+	Get() private
+}
+
+func Find(ctx context.Context, s Store, id int64) (*User, error) {
+	return s.Get(ctx, id)
+}
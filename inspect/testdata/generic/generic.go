@@ -0,0 +1,30 @@
+package generic
+
+import "context"
+
+type Number interface {
+	~int | ~int64 | ~float64
+}
+
+type Cache[K comparable, V any] struct {
+	m map[K]V
+}
+
+func (c *Cache[K, V]) Get(ctx context.Context, k K) (V, error) {
+	return c.m[k], nil
+}
+
+func (c Cache[A, B]) Len(ctx context.Context) int {
+	return len(c.m)
+}
+
+func Sum[T Number](ctx context.Context, xs ...T) (s T) {
+	for _, x := range xs {
+		s += x
+	}
+	return
+}
+
+func Plain(ctx context.Context, a int) error {
+	return nil
+}
@@ -0,0 +1,37 @@
+package gostmt
+
+import (
+	"context"
+	"sync"
+)
+
+type Flag bool
+
+func Notify(ctx context.Context, id int64, ratio float64, done chan<- string) error {
+	done <- "notified"
+	return nil
+}
+
+func pair() (int, int) {
+	return 1, 2
+}
+
+func add(a int, b int) {}
+
+func flag(f Flag) {}
+
+func Start(ctx context.Context, ids []int64, done chan string) {
+	var wg sync.WaitGroup
+	for _, id := range ids {
+		wg.Add(1)
+		go func(id int64) {
+			defer wg.Done()
+			go Notify(nil, id, 1, done)
+		}(id)
+	}
+	go println("started")
+	go add(pair())
+	go flag(len(ids) > 0)
+	go add(1, len(ids))
+	wg.Wait()
+}
@@ -0,0 +1,23 @@
+package grpc
+
+import "context"
+
+type CallOption interface{}
+
+type ClientStream interface{}
+
+type ClientConn struct {
+	target string
+}
+
+func (cc *ClientConn) Invoke(ctx context.Context, method string, args, reply interface{}, opts ...CallOption) error {
+	return nil
+}
+
+func (cc *ClientConn) NewStream(ctx context.Context, method string, opts ...CallOption) (ClientStream, error) {
+	return nil, nil
+}
+
+func Invoke(ctx context.Context, method string, args, reply interface{}, cc *ClientConn, opts ...CallOption) error {
+	return cc.Invoke(ctx, method, args, reply, opts...)
+}
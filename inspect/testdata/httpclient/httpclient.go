@@ -0,0 +1,33 @@
+package httpclient
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+type API struct {
+	client *http.Client
+}
+
+func NewAPI() *API {
+	return &API{client: &http.Client{Transport: &http.Transport{}, Timeout: 10 * time.Second}}
+}
+
+func (c *API) GetUser(ctx context.Context, url string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	return c.client.Do(req)
+}
+
+func (c *API) Ping(ctx context.Context, url string) error {
+	resp, err := c.client.Head(url)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	c.client.CloseIdleConnections()
+	return nil
+}
@@ -0,0 +1,23 @@
+package main
+
+import (
+	"context"
+	. "time"
+)
+
+type job struct {
+	Name string
+}
+
+func (c *job) Run(ctx context.Context, timeout Duration) error {
+	return nil
+}
+
+func loadJob(ctx context.Context, name string) (*job, error) {
+	return &job{Name: name}, nil
+}
+
+func main() {
+	j, _ := loadJob(context.Background(), "daily")
+	j.Run(context.Background(), Second)
+}
@@ -0,0 +1,62 @@
+package sqldao
+
+import (
+	"context"
+	"database/sql"
+)
+
+type User struct {
+	ID   int64
+	Name string
+}
+
+type DAO struct {
+	db *sql.DB
+}
+
+func (c *DAO) GetUser(ctx context.Context, id int64) (*User, error) {
+	u := &User{}
+	err := c.db.QueryRowContext(ctx, "SELECT id, name FROM users WHERE id = ?", id).Scan(&u.ID, &u.Name)
+	if err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
+func (c *DAO) Rename(ctx context.Context, id int64, name string) error {
+	tx, err := c.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	args := []interface{}{name, id}
+	if _, err := tx.ExecContext(ctx, "UPDATE users SET name = ? WHERE id = ?", args...); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// DBTX is implemented by both *sql.DB and *sql.Tx, like DBTX of sqlc
+type DBTX interface {
+	ExecContext(context.Context, string, ...interface{}) (sql.Result, error)
+	QueryRowContext(context.Context, string, ...interface{}) *sql.Row
+}
+
+// Execer has ExecContext of a different signature
+type Execer interface {
+	ExecContext(ctx context.Context, query string) error
+}
+
+type Queries struct {
+	db DBTX
+}
+
+func (q *Queries) CountUsers(ctx context.Context) (int64, error) {
+	var n int64
+	err := q.db.QueryRowContext(ctx, "SELECT count(*) FROM users").Scan(&n)
+	return n, err
+}
+
+func Truncate(ctx context.Context, e Execer) error {
+	return e.ExecContext(ctx, "TRUNCATE users")
+}
@@ -20,6 +20,7 @@ const (
 	Array     Kind = 8
 	Map       Kind = 9
 	Chan      Kind = 10
+	TypeParam Kind = 11
 )
 
 // TypeExpr represents Type appeared inside a package.
@@ -41,10 +42,11 @@ type TypeExpr struct {
 	Results []*Arg
 
 	// named type
-	PkgPath      string // valid when named type
+	PkgPath      string // valid when named type, empty for error
 	ShortPkgPath string
 	Name         string
 	Expr         string
+	Underlying   *TypeExpr // underlying type of named type, or constraint of type param
 }
 
 type StructFieldExpr struct {
@@ -69,6 +71,8 @@ func buildTypeExpr(t types.Type, m map[types.Type]*TypeExpr) *TypeExpr {
 	}
 
 	exp := &TypeExpr{}
+	// set before building elements, types may be recursive
+	m[t] = exp
 	var kind Kind
 	switch t := t.(type) {
 	case *types.Basic:
@@ -76,11 +80,19 @@ func buildTypeExpr(t types.Type, m map[types.Type]*TypeExpr) *TypeExpr {
 		exp.Name = t.Name()
 	case *types.Named:
 		kind = Named
-		exp.PkgPath = t.Obj().Pkg().Path()
+		if pkg := t.Obj().Pkg(); pkg != nil {
+			exp.PkgPath = pkg.Path()
+			exp.ShortPkgPath = pkg.Name()
+		}
 		exp.Name = t.Obj().Name()
-		exp.ShortPkgPath = t.Obj().Pkg().Name()
 		exp.Expr = t.String()
+		exp.Underlying = buildTypeExpr(t.Underlying(), m)
+	case *types.TypeParam:
+		kind = TypeParam
+		exp.Name = t.Obj().Name()
+		exp.Underlying = buildTypeExpr(t.Constraint(), m)
 	case *types.Struct:
+		kind = Struct
 		fields := make([]*StructFieldExpr, 0, t.NumFields())
 		for i := 0; i < t.NumFields(); i++ {
 			f := t.Field(i)
@@ -129,6 +141,11 @@ func buildTypeExpr(t types.Type, m map[types.Type]*TypeExpr) *TypeExpr {
 		kind = Chan
 		exp.Elem = buildTypeExpr(t.Elem(), m)
 	default:
+		// aliases(like any) are materialized since go1.22
+		if u := t.Underlying(); u != nil && u != t {
+			delete(m, t)
+			return buildTypeExpr(u, m)
+		}
 		panic(fmt.Errorf("unrecognized type:%T", t))
 	}
 	exp.Kind = kind
@@ -158,7 +175,9 @@ func (c *TypeExpr) traverseNoRepeat(fn func(subType *TypeExpr), seen map[*TypeEx
 	seen[c] = true
 	fn(c)
 	switch c.Kind {
-	case Slice, Array, Ptr:
+	case Named, TypeParam:
+		c.Underlying.traverseNoRepeat(fn, seen)
+	case Slice, Array, Ptr, Chan:
 		c.Elem.traverseNoRepeat(fn, seen)
 	case Map:
 		c.Key.traverseNoRepeat(fn, seen)
@@ -280,12 +299,24 @@ func traverseType(t types.Type, fn func(t types.Type) bool, m map[types.Type]boo
 	case *types.Named:
 		// underlying?
 		traverseType(t.Underlying(), fn, m)
+		targs := t.TypeArgs()
+		for i := 0; i < targs.Len(); i++ {
+			traverseType(targs.At(i), fn, m)
+		}
+	case *types.TypeParam:
+		traverseType(t.Constraint(), fn, m)
+	case *types.Union:
+		for i := 0; i < t.Len(); i++ {
+			traverseType(t.Term(i).Type(), fn, m)
+		}
 	case *types.Struct:
 		for i := 0; i < t.NumFields(); i++ {
 			traverseType(t.Field(i).Type(), fn, m)
 		}
 	case *types.Interface:
-		// TODO: embedded types
+		for i := 0; i < t.NumEmbeddeds(); i++ {
+			traverseType(t.EmbeddedType(i), fn, m)
+		}
 		for i := 0; i < t.NumMethods(); i++ {
 			traverseType(t.Method(i).Type(), fn, m)
 		}
@@ -311,6 +342,11 @@ func traverseType(t types.Type, fn func(t types.Type) bool, m map[types.Type]boo
 	case *types.Chan:
 		traverseType(t.Elem(), fn, m)
 	default:
+		// aliases(like any) are materialized since go1.22
+		if u := t.Underlying(); u != nil && u != t {
+			traverseType(u, fn, m)
+			return
+		}
 		panic(fmt.Errorf("unrecognized type:%T", t))
 	}
 }
@@ -0,0 +1,295 @@
+// Package admin serves an HTTP API to inspect and change mocks of
+// a running binary built by go-mock, without rebuilding it:
+//
+//	GET    /stubs      trappable functions, with JSON schemas of their types
+//	                   and default responses
+//	GET    /mock-data  the process-wide generalmock.MockData
+//	PUT    /mock-data  installs the generalmock.MockData in body process-wide
+//	DELETE /mock-data  clears the process-wide generalmock.MockData
+//	GET    /calls      recent trapped calls, then new calls as they finish,
+//	                   one generalmock.Record per line, with ?follow=false
+//	                   only recent calls are sent
+//
+// The server listens only on loopback or a unix socket, and is started
+// by GO_MOCK_ADMIN_ADDR, for example `127.0.0.1:7070` or `unix:/tmp/app.sock`.
+// Over TCP, requests whose Host is not a loopback IP or localhost are
+// rejected, so web pages cannot reach the server by DNS rebinding, and
+// PUT requires Content-Type application/json, which pages cannot send
+// cross-origin without a preflight.
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/xhd2015/go-mock/generalmock"
+	"github.com/xhd2015/go-mock/inspect/typeinfo"
+	"github.com/xhd2015/go-mock/mock"
+)
+
+const _SKIP_MOCK = true
+
+// ENV_ADDR address to serve the admin API on
+const ENV_ADDR = "GO_MOCK_ADMIN_ADDR"
+
+// MAX_RECENT_CALLS number of recent calls kept for GET /calls
+const MAX_RECENT_CALLS = 1000
+
+// StubsResp is the response of GET /stubs. Results of each function
+// carry their default response, types are referenced from Types.
+type StubsResp struct {
+	Stubs *mock.MockStubRegistry `json:"stubs"`
+	Types typeinfo.Definitions   `json:"types"`
+}
+
+// Call is a trapped call sent by GET /calls
+type Call struct {
+	Start    time.Time     `json:"start"`
+	Duration time.Duration `json:"duration"`
+	*generalmock.Record
+}
+
+// Server serves the admin API, calls are collected after Install
+type Server struct {
+	calls *callLog
+	mux   *http.ServeMux
+}
+
+func NewServer() *Server {
+	c := &Server{
+		calls: newCallLog(MAX_RECENT_CALLS),
+		mux:   http.NewServeMux(),
+	}
+	c.mux.HandleFunc("/stubs", c.handleStubs)
+	c.mux.HandleFunc("/mock-data", c.handleMockData)
+	c.mux.HandleFunc("/calls", c.handleCalls)
+	return c
+}
+
+// Handler returns the handler of the admin API, rejecting
+// requests over TCP whose Host is not loopback
+func (c *Server) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !isUnixConn(r) && !isLoopbackHost(r.Host) {
+			http.Error(w, fmt.Sprintf("requires loopback host, actual:%s", r.Host), http.StatusForbidden)
+			return
+		}
+		c.mux.ServeHTTP(w, r)
+	})
+}
+
+// isUnixConn checks whether r is received over a unix socket,
+// where Host is chosen by clients freely, like curl --unix-socket
+func isUnixConn(r *http.Request) bool {
+	_, ok := r.Context().Value(http.LocalAddrContextKey).(*net.UnixAddr)
+	return ok
+}
+
+// isLoopbackHost checks the Host header, with an optional port
+func isLoopbackHost(host string) bool {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	} else {
+		host = strings.TrimSuffix(strings.TrimPrefix(host, "["), "]")
+	}
+	return isLoopback(host)
+}
+
+// INTERCEPTOR_PRIORITY collects calls outside of other interceptors,
+// so calls responded by them, like mocks of MockData, are collected too.
+const INTERCEPTOR_PRIORITY = 1000
+
+// Install adds the interceptor collecting calls, until remove is called
+func (c *Server) Install() (remove func()) {
+	return mock.AddInterceptorWithPriority(c.Interceptor, INTERCEPTOR_PRIORITY).Remove
+}
+
+// Interceptor collects calls after they finish, panics are not collected.
+func (c *Server) Interceptor(ctx context.Context, stubInfo *mock.StubInfo, inst, req, resp interface{}, f mock.Filter, next func(ctx context.Context) error) error {
+	start := time.Now()
+	err := next(ctx)
+	record, merr := generalmock.NewRecord(stubInfo, req, resp, err)
+	if merr != nil {
+		fmt.Fprintf(os.Stderr, "go-mock: admin record %s: %v\n", stubInfo.String(), merr)
+		return err
+	}
+	c.calls.add(&Call{Start: start, Duration: time.Since(start), Record: record})
+	return err
+}
+
+func (c *Server) handleStubs(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	writeJSON(w, &StubsResp{
+		Stubs: mock.CopyMockStubs(),
+		Types: mock.GetMockTypes(),
+	})
+}
+
+func (c *Server) handleMockData(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		// a non-nil ctx without mock data falls back to the global one
+		writeJSON(w, generalmock.GetGeneralMockData(context.Background()))
+	case http.MethodPut:
+		mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		if mediaType != "application/json" {
+			http.Error(w, "requires Content-Type application/json", http.StatusUnsupportedMediaType)
+			return
+		}
+		var mockData generalmock.MockData
+		err := json.NewDecoder(r.Body).Decode(&mockData)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("parse mock data: %v", err), http.StatusBadRequest)
+			return
+		}
+		err = mockData.Validate()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		generalmock.InstallInterceptor()
+		generalmock.SetGlobalMockData(&mockData)
+		w.WriteHeader(http.StatusNoContent)
+	case http.MethodDelete:
+		generalmock.SetGlobalMockData(nil)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (c *Server) handleCalls(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	follow := r.URL.Query().Get("follow") != "false"
+	recent, ch, cancel := c.calls.subscribe(follow)
+	defer cancel()
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	flusher, _ := w.(http.Flusher)
+	enc := json.NewEncoder(w)
+	write := func(call *Call) bool {
+		if err := enc.Encode(call); err != nil {
+			return false
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+		return true
+	}
+	for _, call := range recent {
+		if !write(call) {
+			return
+		}
+	}
+	if !follow {
+		return
+	}
+	if flusher != nil {
+		flusher.Flush()
+	}
+	for {
+		select {
+		case call := <-ch:
+			if !write(call) {
+				return
+			}
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
+}
+
+// Listen listens on addr, which is `unix:PATH`, or `HOST:PORT`
+// with a loopback host, an empty host means 127.0.0.1.
+func Listen(addr string) (net.Listener, error) {
+	if strings.HasPrefix(addr, "unix:") {
+		path := strings.TrimPrefix(addr, "unix:")
+		// remove the socket left by a previous run
+		if stat, err := os.Stat(path); err == nil && stat.Mode()&os.ModeSocket != 0 {
+			os.Remove(path)
+		}
+		return net.Listen("unix", path)
+	}
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	if host == "" {
+		host = "127.0.0.1"
+	} else if !isLoopback(host) {
+		return nil, fmt.Errorf("requires loopback host or unix socket, actual:%s", addr)
+	}
+	return net.Listen("tcp", net.JoinHostPort(host, port))
+}
+
+func isLoopback(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// Start serves the admin API on addr in background, until stop is called
+func Start(addr string) (stop func(), err error) {
+	ln, err := Listen(addr)
+	if err != nil {
+		return nil, err
+	}
+	s := NewServer()
+	remove := s.Install()
+	server := &http.Server{Handler: s.Handler()}
+	go func() {
+		err := server.Serve(ln)
+		if err != nil && err != http.ErrServerClosed {
+			fmt.Fprintf(os.Stderr, "go-mock: admin server: %v\n", err)
+		}
+	}()
+	fmt.Fprintf(os.Stderr, "go-mock: admin server listening on %s\n", ln.Addr())
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			remove()
+			server.Close()
+		})
+	}, nil
+}
+
+// InstallFromEnv starts the admin server on GO_MOCK_ADMIN_ADDR,
+// it does nothing if not set.
+func InstallFromEnv() (installed bool, err error) {
+	addr := strings.TrimSpace(os.Getenv(ENV_ADDR))
+	if addr == "" {
+		return false, nil
+	}
+	_, err = Start(addr)
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
@@ -0,0 +1,244 @@
+package admin
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/xhd2015/go-mock/generalmock"
+	"github.com/xhd2015/go-mock/inspect/typeinfo"
+	"github.com/xhd2015/go-mock/mock"
+)
+
+type user struct {
+	Name string `json:"name"`
+}
+
+var findStub = &mock.StubInfo{PkgName: "test/admin/dao", Owner: "Dao", Name: "Find"}
+
+func init() {
+	mock.RegisterMockStub(findStub.PkgName, findStub.Owner, nil, findStub.Name,
+		[]typeinfo.TypeInfo{typeinfo.NewTypeInfo("id", reflect.TypeOf(int(0)))},
+		[]typeinfo.TypeInfo{typeinfo.NewTypeInfo("u", reflect.TypeOf((*user)(nil)))},
+		true, true)
+}
+
+// simulate the rewritten code
+func find(ctx context.Context, id int) (u *user, err error) {
+	var _mockreq = struct {
+		ID int `json:"id"`
+	}{ID: id}
+	var _mockresp struct {
+		U *user `json:"u"`
+	}
+	err = mock.TrapFunc(ctx, findStub, nil, &_mockreq, &_mockresp, _mockfind, false, true, true)
+	u = _mockresp.U
+	return
+}
+func _mockfind(ctx context.Context, id int) (u *user, err error) {
+	return &user{Name: "real"}, nil
+}
+
+func do(t *testing.T, method string, url string, body string) *http.Response {
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp
+}
+
+// go test -run TestAdmin -v ./mock/admin
+func TestAdmin(t *testing.T) {
+	s := NewServer()
+	defer s.Install()()
+	server := httptest.NewServer(s.Handler())
+	defer server.Close()
+
+	// stubs
+	resp := do(t, http.MethodGet, server.URL+"/stubs", "")
+	var stubs struct {
+		Stubs struct {
+			PkgMapping map[string]struct {
+				FuncMapping map[string]map[string]struct {
+					Results []struct {
+						Default json.RawMessage
+					}
+				}
+			}
+		} `json:"stubs"`
+	}
+	err := json.NewDecoder(resp.Body).Decode(&stubs)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	results := stubs.Stubs.PkgMapping[findStub.PkgName].FuncMapping["Dao"]["Find"].Results
+	if len(results) != 1 || string(results[0].Default) != `{"name":""}` {
+		t.Fatalf("expect %s = %+v, actual:%+v", "default response", `{"name":""}`, results)
+	}
+
+	// mock data
+	resp = do(t, http.MethodPut, server.URL+"/mock-data", `{"Mapping":{"test/admin/dao":{"Dao.Find":{"Resp":{"name":"mock"}}}}}`)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("expect %s = %+v, actual:%+v", "status", http.StatusNoContent, resp.StatusCode)
+	}
+	u, err := find(context.Background(), 1)
+	if err != nil || u.Name != "mock" {
+		t.Fatalf("expect %s = %+v, actual:%+v %v", "u.Name", "mock", u, err)
+	}
+
+	resp = do(t, http.MethodDelete, server.URL+"/mock-data", "")
+	resp.Body.Close()
+	u, err = find(context.Background(), 2)
+	if err != nil || u.Name != "real" {
+		t.Fatalf("expect %s = %+v, actual:%+v %v", "u.Name", "real", u, err)
+	}
+
+	// recent calls
+	resp = do(t, http.MethodGet, server.URL+"/calls?follow=false", "")
+	records, err := generalmock.LoadRecords(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 || string(records[0].Resp) != `{"name":"mock"}` || string(records[1].Req) != `{"id":2}` {
+		t.Fatalf("expect %s = %+v, actual:%+v", "len(records)", 2, records)
+	}
+}
+
+// go test -run TestFollowCalls -v ./mock/admin
+func TestFollowCalls(t *testing.T) {
+	s := NewServer()
+	defer s.Install()()
+	server := httptest.NewServer(s.Handler())
+	defer server.Close()
+
+	resp := do(t, http.MethodGet, server.URL+"/calls", "")
+	defer resp.Body.Close()
+
+	find(context.Background(), 3)
+	line, err := bufio.NewReader(resp.Body).ReadString('\n')
+	if err != nil {
+		t.Fatal(err)
+	}
+	var call Call
+	err = json.Unmarshal([]byte(line), &call)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if call.Func != "Dao.Find" || string(call.Req) != `{"id":3}` {
+		t.Fatalf("expect %s = %+v, actual:%+v", "call", `Dao.Find {"id":3}`, line)
+	}
+}
+
+// go test -run TestRejectRequests -v ./mock/admin
+func TestRejectRequests(t *testing.T) {
+	s := NewServer()
+	server := httptest.NewServer(s.Handler())
+	defer server.Close()
+
+	// DNS rebinding: a page of evil.com resolved to 127.0.0.1
+	req, _ := http.NewRequest(http.MethodGet, server.URL+"/stubs", nil)
+	req.Host = "evil.com"
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("expect %s = %+v, actual:%+v", "status", http.StatusForbidden, resp.StatusCode)
+	}
+
+	// form or text body, which pages send cross-origin without preflight
+	req, _ = http.NewRequest(http.MethodPut, server.URL+"/mock-data", strings.NewReader(`{}`))
+	req.Header.Set("Content-Type", "text/plain")
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnsupportedMediaType {
+		t.Fatalf("expect %s = %+v, actual:%+v", "status", http.StatusUnsupportedMediaType, resp.StatusCode)
+	}
+
+	// malformed matchers
+	resp = do(t, http.MethodPut, server.URL+"/mock-data", `{"Mapping":{"test/admin/dao":{"Dao.Find":{"Match":{"Paths":{"$.a[x]":1}}}}}}`)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expect %s = %+v, actual:%+v", "status", http.StatusBadRequest, resp.StatusCode)
+	}
+
+	// any Host over unix sockets
+	dir, err := ioutil.TempDir("", "admin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	sock := filepath.Join(dir, "admin.sock")
+	ln, err := Listen("unix:" + sock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	unixServer := &http.Server{Handler: s.Handler()}
+	go unixServer.Serve(ln)
+	defer unixServer.Close()
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			return net.Dial("unix", sock)
+		},
+	}}
+	resp, err = client.Get("http://unix/stubs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expect %s = %+v, actual:%+v", "status", http.StatusOK, resp.StatusCode)
+	}
+
+	for host, expect := range map[string]bool{
+		"localhost:7070": true,
+		"127.0.0.1":      true,
+		"[::1]:7070":     true,
+		"[::1]":          true,
+		"localhost.evil": false,
+		"":               false,
+	} {
+		if ok := isLoopbackHost(host); ok != expect {
+			t.Fatalf("expect %s = %+v, actual:%+v", "isLoopbackHost("+host+")", expect, ok)
+		}
+	}
+}
+
+// go test -run TestListen -v ./mock/admin
+func TestListen(t *testing.T) {
+	_, err := Listen("0.0.0.0:0")
+	if err == nil {
+		t.Fatalf("expect %s = %+v, actual:%+v", "err", "non-loopback error", err)
+	}
+	ln, err := Listen(":0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	if !strings.HasPrefix(ln.Addr().String(), "127.0.0.1:") {
+		t.Fatalf("expect %s = %+v, actual:%+v", "addr", "127.0.0.1:*", ln.Addr())
+	}
+}
@@ -0,0 +1,64 @@
+package admin
+
+import "sync"
+
+// callLog keeps recent calls, and sends new calls to subscribers.
+// Subscribers not keeping up miss calls instead of blocking the caller.
+type callLog struct {
+	mutex       sync.Mutex
+	calls       []*Call // ring buffer
+	next        int
+	full        bool
+	subscribers map[chan *Call]bool
+}
+
+func newCallLog(size int) *callLog {
+	return &callLog{
+		calls:       make([]*Call, size),
+		subscribers: make(map[chan *Call]bool),
+	}
+}
+
+func (c *callLog) add(call *Call) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.calls[c.next] = call
+	c.next++
+	if c.next == len(c.calls) {
+		c.next = 0
+		c.full = true
+	}
+	for ch := range c.subscribers {
+		select {
+		case ch <- call:
+		default:
+		}
+	}
+}
+
+// recent must be called with lock held
+func (c *callLog) recent() []*Call {
+	if !c.full {
+		return append([]*Call(nil), c.calls[:c.next]...)
+	}
+	calls := make([]*Call, 0, len(c.calls))
+	calls = append(calls, c.calls[c.next:]...)
+	return append(calls, c.calls[:c.next]...)
+}
+
+// subscribe returns recent calls, and if follow, calls added after them
+func (c *callLog) subscribe(follow bool) (recent []*Call, ch <-chan *Call, cancel func()) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	recent = c.recent()
+	if !follow {
+		return recent, nil, func() {}
+	}
+	sub := make(chan *Call, 64)
+	c.subscribers[sub] = true
+	return recent, sub, func() {
+		c.mutex.Lock()
+		defer c.mutex.Unlock()
+		delete(c.subscribers, sub)
+	}
+}
@@ -0,0 +1,66 @@
+// Package autoload installs features configured by environment
+// variables, Install is called by the binary built with go-mock.
+//
+// Supported:
+//
+//	GO_MOCK_FAULT, GO_MOCK_FAULT_FILE: see package fault
+//	GO_MOCK_TRACE_FILE, GO_MOCK_TRACE_FORMAT, GO_MOCK_CALL_TREE: see package trace
+//	GO_MOCK_RECORD_FILE, GO_MOCK_RECORD_FILTER, GO_MOCK_REPLAY_FILE: see package generalmock
+//	GO_MOCK_DATA_DIR, GO_MOCK_DATA_DIR_INTERVAL: see package generalmock
+//	GO_MOCK_HTTP_FIXTURE_FILE, GO_MOCK_HTTP_RECORD_FILE: see package httpmock
+//	GO_MOCK_SQL_FIXTURE_FILE: see package sqlmock
+//	GO_MOCK_ADMIN_ADDR: see package admin
+package autoload
+
+import (
+	"fmt"
+
+	"github.com/xhd2015/go-mock/generalmock"
+	"github.com/xhd2015/go-mock/mock/admin"
+	"github.com/xhd2015/go-mock/mock/fault"
+	"github.com/xhd2015/go-mock/mock/httpmock"
+	"github.com/xhd2015/go-mock/mock/sqlmock"
+	"github.com/xhd2015/go-mock/mock/trace"
+)
+
+const _SKIP_MOCK = true
+
+// Install installs features configured by environment variables,
+// it panics on errors. It is called by an init function of the main
+// package generated by go-mock, instead of init of this package, so
+// that go-mock itself, which imports this package for vendoring,
+// does not install them, like listening on GO_MOCK_ADMIN_ADDR.
+func Install() {
+	_, err := fault.InstallFromEnv()
+	if err != nil {
+		panic(fmt.Errorf("go-mock: install fault: %v", err))
+	}
+	_, err = trace.InstallFromEnv()
+	if err != nil {
+		panic(fmt.Errorf("go-mock: install trace: %v", err))
+	}
+	_, err = generalmock.RecordFromEnv()
+	if err != nil {
+		panic(fmt.Errorf("go-mock: install record: %v", err))
+	}
+	_, err = generalmock.ReplayFromEnv()
+	if err != nil {
+		panic(fmt.Errorf("go-mock: install replay: %v", err))
+	}
+	_, err = generalmock.WatchDirFromEnv()
+	if err != nil {
+		panic(fmt.Errorf("go-mock: install mock data dir: %v", err))
+	}
+	_, err = httpmock.InstallFromEnv()
+	if err != nil {
+		panic(fmt.Errorf("go-mock: install http mock: %v", err))
+	}
+	_, err = sqlmock.InstallFromEnv()
+	if err != nil {
+		panic(fmt.Errorf("go-mock: install sql mock: %v", err))
+	}
+	_, err = admin.InstallFromEnv()
+	if err != nil {
+		panic(fmt.Errorf("go-mock: start admin server: %v", err))
+	}
+}
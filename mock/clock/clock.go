@@ -0,0 +1,333 @@
+// Package clock provides a virtual clock for code rewritten with
+// the -virtual-clock option, which redirects time.Now, time.Since,
+// time.Sleep, time.After and time.NewTimer in rewritten packages
+// to functions of this package.
+// They use the clock of the goroutine local context set by Setup,
+// or the real clock if there is none.
+//
+// The time package itself is never rewritten: the mock runtime depends
+// on it, and std packages cannot import packages outside std. So these
+// still use the real clock: calls in packages not rewritten, including
+// dependencies and std, time.AfterFunc, time.Tick, time.NewTicker, and
+// deadlines of context.WithTimeout and context.WithDeadline.
+package clock
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"runtime"
+	"sort"
+	"sync"
+	"time"
+	"unsafe"
+
+	"github.com/xhd2015/go-mock/mock"
+)
+
+const _SKIP_MOCK = true
+
+type clockKeyType int
+
+var clockKey clockKeyType
+
+// Clock is a virtual clock, its time only changes by Advance and Set.
+type Clock struct {
+	mutex   sync.Mutex
+	cond    *sync.Cond
+	now     time.Time
+	waiters []*waiter
+}
+
+// waiter is a pending Sleep, After or Timer
+type waiter struct {
+	when time.Time
+	ch   chan time.Time
+}
+
+// New creates a clock starting at start
+func New(start time.Time) *Clock {
+	c := &Clock{now: start}
+	c.cond = sync.NewCond(&c.mutex)
+	return c
+}
+
+// Setup attaches a new clock starting at start to ctx, and
+// associates the returned ctx with current goroutine, like
+// Setup of mock stubs, until mock.RestoreLocal is called with it.
+// Mocks should be set up on the returned ctx.
+func Setup(ctx context.Context, start time.Time) context.Context {
+	return mock.SetupLocal(context.WithValue(ctx, clockKey, New(start)))
+}
+
+// Get returns the clock attached to ctx, or nil.
+func Get(ctx context.Context) *Clock {
+	if ctx == nil {
+		return nil
+	}
+	c, _ := ctx.Value(clockKey).(*Clock)
+	return c
+}
+
+// Advance moves the clock attached to ctx forward by d,
+// see (*Clock).Advance.
+func Advance(ctx context.Context, d time.Duration) {
+	mustGet(ctx).Advance(d)
+}
+
+// BlockUntil waits until the clock attached to ctx has at least n
+// pending sleeps and timers, see (*Clock).BlockUntil.
+func BlockUntil(ctx context.Context, n int) {
+	mustGet(ctx).BlockUntil(n)
+}
+
+func mustGet(ctx context.Context) *Clock {
+	c := Get(ctx)
+	if c == nil {
+		panic(fmt.Errorf("no clock in ctx, use clock.Setup first"))
+	}
+	return c
+}
+
+// Now returns the virtual time
+func (c *Clock) Now() time.Time {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.now
+}
+
+// Since is like time.Since, but based on the virtual time
+func (c *Clock) Since(t time.Time) time.Duration {
+	return c.Now().Sub(t)
+}
+
+// Sleep blocks until the clock is advanced by d
+func (c *Clock) Sleep(d time.Duration) {
+	if d <= 0 {
+		return
+	}
+	<-c.After(d)
+}
+
+// After is like time.After, the channel receives when the
+// clock is advanced by d.
+func (c *Clock) After(d time.Duration) <-chan time.Time {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.addWaiter(d, make(chan time.Time, 1)).ch
+}
+
+// NewTimer is like time.NewTimer, the timer fires when the clock
+// is advanced by d.
+// Stop and Reset of the timer only take effect on the virtual time when
+// called from rewritten packages, which call StopTimer and ResetTimer
+// instead, Reset from other packages fires the timer by the real time.
+func (c *Clock) NewTimer(d time.Duration) *time.Timer {
+	c.mutex.Lock()
+	w := c.addWaiter(d, make(chan time.Time, 1))
+	c.mutex.Unlock()
+
+	// a stopped real timer, so the zero-value check of Stop and Reset passes.
+	// Unlike NewTimer, AfterFunc does not make a cycle between the timer
+	// and its channel, which would keep the finalizer of registerTimer from running.
+	ch := w.ch
+	t := time.AfterFunc(time.Duration(math.MaxInt64), func() {
+		select {
+		case ch <- time.Now():
+		default:
+		}
+	})
+	t.Stop()
+	t.C = ch
+	registerTimer(t, &virtualTimer{clock: c, w: w})
+	return t
+}
+
+// Advance moves the clock forward by d, firing sleeps and timers
+// whose deadline is reached in the order of their deadlines.
+func (c *Clock) Advance(d time.Duration) {
+	c.mutex.Lock()
+	c.setLocked(c.now.Add(d))
+}
+
+// Set sets the clock to t, which must not be before current time
+func (c *Clock) Set(t time.Time) {
+	c.mutex.Lock()
+	if t.Before(c.now) {
+		c.mutex.Unlock()
+		panic(fmt.Errorf("cannot set clock backward from %v to %v", c.now, t))
+	}
+	c.setLocked(t)
+}
+
+// BlockUntil waits until there are at least n pending sleeps and timers,
+// so Advance will not happen before the code under test starts waiting.
+func (c *Clock) BlockUntil(n int) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	for len(c.waiters) < n {
+		c.cond.Wait()
+	}
+}
+
+// setLocked unlocks c.mutex before firing
+func (c *Clock) setLocked(t time.Time) {
+	c.now = t
+	var fired []*waiter
+	pending := c.waiters[:0]
+	for _, w := range c.waiters {
+		if w.when.After(t) {
+			pending = append(pending, w)
+		} else {
+			fired = append(fired, w)
+		}
+	}
+	c.waiters = pending
+	c.mutex.Unlock()
+
+	sort.SliceStable(fired, func(i, j int) bool {
+		return fired[i].when.Before(fired[j].when)
+	})
+	for _, w := range fired {
+		// buffered with 1, a timer not received since last fire drops the value
+		select {
+		case w.ch <- w.when:
+		default:
+		}
+	}
+}
+
+// addWaiter must be called with c.mutex held
+func (c *Clock) addWaiter(d time.Duration, ch chan time.Time) *waiter {
+	w := &waiter{when: c.now.Add(d), ch: ch}
+	if d <= 0 {
+		// fires immediately, like the real timer
+		select {
+		case ch <- c.now:
+		default:
+		}
+		return w
+	}
+	c.waiters = append(c.waiters, w)
+	c.cond.Broadcast()
+	return w
+}
+
+// removeWaiter must be called with c.mutex held
+func (c *Clock) removeWaiter(w *waiter) bool {
+	for i, x := range c.waiters {
+		if x == w {
+			c.waiters = append(c.waiters[:i], c.waiters[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// virtualTimer is a timer created by a clock
+type virtualTimer struct {
+	clock *Clock
+	w     *waiter // guarded by clock.mutex
+}
+
+func (c *virtualTimer) stop() bool {
+	c.clock.mutex.Lock()
+	defer c.clock.mutex.Unlock()
+	return c.clock.removeWaiter(c.w)
+}
+
+func (c *virtualTimer) reset(d time.Duration) bool {
+	c.clock.mutex.Lock()
+	defer c.clock.mutex.Unlock()
+	active := c.clock.removeWaiter(c.w)
+	c.w = c.clock.addWaiter(d, c.w.ch)
+	return active
+}
+
+// virtual timers by address, so StopTimer and ResetTimer do not depend
+// on the clock of current goroutine. The map does not reference timers,
+// entries are removed by their finalizers, so timers dropped by the code
+// under test are not kept, while timers still referenced can be Reset
+// after they fire or stop.
+var timerMutex sync.RWMutex
+var virtualTimers = make(map[uintptr]*virtualTimer)
+
+func registerTimer(t *time.Timer, vt *virtualTimer) {
+	key := uintptr(unsafe.Pointer(t))
+	timerMutex.Lock()
+	virtualTimers[key] = vt
+	timerMutex.Unlock()
+	runtime.SetFinalizer(t, func(*time.Timer) {
+		timerMutex.Lock()
+		defer timerMutex.Unlock()
+		delete(virtualTimers, key)
+	})
+}
+
+func getVirtualTimer(t *time.Timer) *virtualTimer {
+	timerMutex.RLock()
+	defer timerMutex.RUnlock()
+	return virtualTimers[uintptr(unsafe.Pointer(t))]
+}
+
+// current returns the clock of current goroutine, or nil
+func current() *Clock {
+	return Get(mock.GetContext(nil))
+}
+
+// Now replaces time.Now in rewritten packages
+func Now() time.Time {
+	if c := current(); c != nil {
+		return c.Now()
+	}
+	return time.Now()
+}
+
+// Since replaces time.Since in rewritten packages
+func Since(t time.Time) time.Duration {
+	if c := current(); c != nil {
+		return c.Since(t)
+	}
+	return time.Since(t)
+}
+
+// Sleep replaces time.Sleep in rewritten packages
+func Sleep(d time.Duration) {
+	if c := current(); c != nil {
+		c.Sleep(d)
+		return
+	}
+	time.Sleep(d)
+}
+
+// After replaces time.After in rewritten packages
+func After(d time.Duration) <-chan time.Time {
+	if c := current(); c != nil {
+		return c.After(d)
+	}
+	return time.After(d)
+}
+
+// NewTimer replaces time.NewTimer in rewritten packages
+func NewTimer(d time.Duration) *time.Timer {
+	if c := current(); c != nil {
+		return c.NewTimer(d)
+	}
+	return time.NewTimer(d)
+}
+
+// StopTimer replaces t.Stop() in rewritten packages
+func StopTimer(t *time.Timer) bool {
+	if vt := getVirtualTimer(t); vt != nil {
+		return vt.stop()
+	}
+	return t.Stop()
+}
+
+// ResetTimer replaces t.Reset(d) in rewritten packages
+func ResetTimer(t *time.Timer, d time.Duration) bool {
+	if vt := getVirtualTimer(t); vt != nil {
+		return vt.reset(d)
+	}
+	return t.Reset(d)
+}
@@ -0,0 +1,106 @@
+package clock
+
+import (
+	"context"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/xhd2015/go-mock/mock"
+)
+
+// go test -run TestClock -v ./mock/clock
+func TestClock(t *testing.T) {
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	c := New(start)
+
+	timer := c.NewTimer(2 * time.Minute)
+	after := c.After(time.Minute)
+	slept := make(chan bool)
+	go func() {
+		c.Sleep(3 * time.Minute)
+		slept <- true
+	}()
+	c.BlockUntil(3)
+
+	c.Advance(time.Minute)
+	if v := <-after; !v.Equal(start.Add(time.Minute)) {
+		t.Fatalf("expect %s = %+v, actual:%+v", `<-after`, start.Add(time.Minute), v)
+	}
+	// reset before firing
+	if !ResetTimer(timer, 2*time.Minute) {
+		t.Fatalf("expect %s = %+v, actual:%+v", `ResetTimer(timer)`, true, false)
+	}
+	c.Advance(2 * time.Minute)
+	<-slept
+	if v := <-timer.C; !v.Equal(start.Add(3 * time.Minute)) {
+		t.Fatalf("expect %s = %+v, actual:%+v", `<-timer.C`, start.Add(3*time.Minute), v)
+	}
+	if StopTimer(timer) {
+		t.Fatalf("expect %s = %+v, actual:%+v", `StopTimer(timer)`, false, true)
+	}
+	if since := c.Since(start); since != 3*time.Minute {
+		t.Fatalf("expect %s = %+v, actual:%+v", `c.Since(start)`, 3*time.Minute, since)
+	}
+}
+
+// go test -run TestLocalClock -v ./mock/clock
+func TestLocalClock(t *testing.T) {
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	ctx := Setup(context.Background(), start)
+	Advance(ctx, time.Hour)
+	if now := Now(); !now.Equal(start.Add(time.Hour)) {
+		t.Fatalf("expect %s = %+v, actual:%+v", `Now()`, start.Add(time.Hour), now)
+	}
+
+	// other goroutines use the real clock
+	done := make(chan time.Time)
+	go func() {
+		done <- Now()
+	}()
+	if now := <-done; now.Year() == 2020 {
+		t.Fatalf("expect %s = %+v, actual:%+v", `Now().Year()`, "real", now)
+	}
+
+	mock.RestoreLocal(ctx)
+	if now := Now(); now.Year() == 2020 {
+		t.Fatalf("expect %s = %+v, actual:%+v", `Now().Year()`, "real", now)
+	}
+}
+
+// go test -run TestTimerReleased -v ./mock/clock
+func TestTimerReleased(t *testing.T) {
+	c := New(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	count := func() int {
+		timerMutex.RLock()
+		defer timerMutex.RUnlock()
+		return len(virtualTimers)
+	}
+	// a retry loop creating a timer per iteration
+	for i := 0; i < 100; i++ {
+		timer := c.NewTimer(time.Second)
+		if i%2 == 0 {
+			StopTimer(timer)
+		} else {
+			c.Advance(time.Second)
+			<-timer.C
+		}
+	}
+	kept := c.NewTimer(time.Second)
+	for i := 0; i < 50 && count() > 1; i++ {
+		runtime.GC()
+		time.Sleep(time.Millisecond)
+	}
+	if n := count(); n != 1 || getVirtualTimer(kept) == nil {
+		t.Fatalf("expect only the referenced timer kept, actual:%d", n)
+	}
+
+	// a timer still referenced can be reset after it fires
+	c.Advance(time.Second)
+	<-kept.C
+	if ResetTimer(kept, time.Second) {
+		t.Fatalf("expect %s = %+v, actual:%+v", `ResetTimer(kept)`, false, true)
+	}
+	c.Advance(time.Second)
+	<-kept.C
+}
@@ -0,0 +1,81 @@
+package mock
+
+import (
+	"reflect"
+)
+
+// deepCopy copies v recursively, exported fields, slices, maps and pointers
+// are copied, unexported fields are shallow copied.
+func deepCopy(v interface{}) interface{} {
+	if v == nil {
+		return nil
+	}
+	return copyValue(reflect.ValueOf(v), make(map[copiedPtr]reflect.Value)).Interface()
+}
+
+type copiedPtr struct {
+	t   reflect.Type
+	ptr uintptr
+}
+
+func copyValue(v reflect.Value, seen map[copiedPtr]reflect.Value) reflect.Value {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			return v
+		}
+		key := copiedPtr{t: v.Type(), ptr: v.Pointer()}
+		if p, ok := seen[key]; ok {
+			return p
+		}
+		p := reflect.New(v.Type().Elem())
+		seen[key] = p
+		p.Elem().Set(copyValue(v.Elem(), seen))
+		return p
+	case reflect.Interface:
+		if v.IsNil() {
+			return v
+		}
+		x := reflect.New(v.Type()).Elem()
+		x.Set(copyValue(v.Elem(), seen))
+		return x
+	case reflect.Struct:
+		x := reflect.New(v.Type()).Elem()
+		x.Set(v) // unexported fields
+		for i := 0; i < v.NumField(); i++ {
+			if !x.Field(i).CanSet() {
+				continue
+			}
+			x.Field(i).Set(copyValue(v.Field(i), seen))
+		}
+		return x
+	case reflect.Array:
+		x := reflect.New(v.Type()).Elem()
+		for i := 0; i < v.Len(); i++ {
+			x.Index(i).Set(copyValue(v.Index(i), seen))
+		}
+		return x
+	case reflect.Slice:
+		if v.IsNil() {
+			return v
+		}
+		x := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+		for i := 0; i < v.Len(); i++ {
+			x.Index(i).Set(copyValue(v.Index(i), seen))
+		}
+		return x
+	case reflect.Map:
+		if v.IsNil() {
+			return v
+		}
+		x := reflect.MakeMapWithSize(v.Type(), v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			x.SetMapIndex(iter.Key(), copyValue(iter.Value(), seen))
+		}
+		return x
+	default:
+		// basic types, func, chan
+		return v
+	}
+}
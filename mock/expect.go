@@ -0,0 +1,439 @@
+package mock
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// TestingT is the subset of *testing.T used to report failures
+type TestingT interface {
+	Helper()
+	Errorf(format string, args ...interface{})
+}
+
+// Matcher matches a single argument
+type Matcher interface {
+	Matches(x interface{}) bool
+	String() string
+}
+
+// Controller holds expectations and reports
+// unmet or unexpected calls.
+// usage:
+//
+//	ctrl := mock.NewController()
+//	ctx = mock.WithController(ctx, ctrl)
+//	mock.Expect(ctx, pkg, "", "Run").WithArgs(1, mock.Any()).Times(2).Return(10, nil)
+//	...
+//	ctrl.Verify(t)
+type Controller struct {
+	mutex        sync.Mutex
+	expectations []*Expectation
+	unexpected   []string
+}
+
+// Expectation describes how a function is expected to be called
+type Expectation struct {
+	key fnMockKey
+
+	argMatchers   []Matcher
+	namedMatchers map[string]Matcher
+
+	minTimes int
+	maxTimes int // <0: unlimited
+
+	returns []interface{}
+	callOld bool
+
+	prereqs []*Expectation
+	calls   int
+}
+
+func NewController() *Controller {
+	return &Controller{}
+}
+
+type controllerKeyType struct{}
+
+var controllerKey controllerKeyType
+
+// WithController attach ctrl to ctx, expectations added to
+// ctrl only apply to calls under the returned context.
+func WithController(ctx context.Context, ctrl *Controller) context.Context {
+	if ctrl == nil {
+		panic(fmt.Errorf("controller cannot be nil"))
+	}
+	return context.WithValue(ctx, controllerKey, ctrl)
+}
+
+func getController(ctx context.Context) *Controller {
+	if ctx == nil {
+		return nil
+	}
+	ctrl, _ := ctx.Value(controllerKey).(*Controller)
+	return ctrl
+}
+
+// Expect adds an expectation to the controller attached to ctx,
+// it panics if no controller is attached.
+func Expect(ctx context.Context, pkg string, owner string, name string) *Expectation {
+	ctrl := getController(ctx)
+	if ctrl == nil {
+		panic(fmt.Errorf("no controller in ctx, use mock.WithController first"))
+	}
+	return ctrl.Expect(pkg, owner, name)
+}
+
+// Expect adds an expectation which by default is
+// called exactly once and returns zero values.
+func (c *Controller) Expect(pkg string, owner string, name string) *Expectation {
+	e := &Expectation{
+		key:      fnMockKey{pkg: pkg, owner: owner, name: name},
+		minTimes: 1,
+		maxTimes: 1,
+	}
+	c.mutex.Lock()
+	c.expectations = append(c.expectations, e)
+	c.mutex.Unlock()
+	return e
+}
+
+// WithArgs set positional matchers of arguments,
+// ctx is not included. A non-Matcher value is matched by Eq.
+func (c *Expectation) WithArgs(args ...interface{}) *Expectation {
+	matchers := make([]Matcher, 0, len(args))
+	for _, arg := range args {
+		matchers = append(matchers, toMatcher(arg))
+	}
+	c.argMatchers = matchers
+	return c
+}
+
+// WithArg set matcher for argument by its name,
+// name is the json name of the generated req struct field,
+// which is the same as the argument name in source.
+func (c *Expectation) WithArg(name string, arg interface{}) *Expectation {
+	if c.namedMatchers == nil {
+		c.namedMatchers = make(map[string]Matcher, 1)
+	}
+	c.namedMatchers[name] = toMatcher(arg)
+	return c
+}
+
+// Times set the exact number of calls
+func (c *Expectation) Times(n int) *Expectation {
+	c.minTimes, c.maxTimes = n, n
+	return c
+}
+
+func (c *Expectation) MinTimes(n int) *Expectation {
+	c.minTimes = n
+	if c.maxTimes >= 0 && c.maxTimes < n {
+		c.maxTimes = -1
+	}
+	return c
+}
+func (c *Expectation) MaxTimes(n int) *Expectation {
+	c.maxTimes = n
+	return c
+}
+func (c *Expectation) AnyTimes() *Expectation {
+	c.minTimes, c.maxTimes = 0, -1
+	return c
+}
+
+// Return set the results, if the function returns error as its last
+// result, the error can be given as the last value.
+func (c *Expectation) Return(values ...interface{}) *Expectation {
+	c.returns = values
+	c.callOld = false
+	return c
+}
+
+// CallOld makes the matched call go to the original function,
+// the call is still counted.
+func (c *Expectation) CallOld() *Expectation {
+	c.returns = nil
+	c.callOld = true
+	return c
+}
+
+// After requires the call happen after prereqs are satisfied
+func (c *Expectation) After(prereqs ...*Expectation) *Expectation {
+	c.prereqs = append(c.prereqs, prereqs...)
+	return c
+}
+
+// InOrder requires expectations be satisfied in order
+func InOrder(exps ...*Expectation) {
+	for i := 1; i < len(exps); i++ {
+		exps[i].After(exps[i-1])
+	}
+}
+
+func (c *Expectation) String() string {
+	return (&StubInfo{PkgName: c.key.pkg, Owner: c.key.owner, Name: c.key.name}).String()
+}
+
+func (c *Expectation) satisfied() bool {
+	return c.calls >= c.minTimes
+}
+func (c *Expectation) exhausted() bool {
+	return c.maxTimes >= 0 && c.calls >= c.maxTimes
+}
+
+func (c *Expectation) matches(req interface{}) bool {
+	for _, p := range c.prereqs {
+		if !p.satisfied() {
+			return false
+		}
+	}
+	if len(c.argMatchers) == 0 && len(c.namedMatchers) == 0 {
+		return true
+	}
+	v := reflect.ValueOf(req).Elem()
+	if len(c.argMatchers) > 0 {
+		if len(c.argMatchers) != v.NumField() {
+			return false
+		}
+		for i, m := range c.argMatchers {
+			if !m.Matches(v.Field(i).Interface()) {
+				return false
+			}
+		}
+	}
+	for name, m := range c.namedMatchers {
+		idx := fieldIndex(v.Type(), name)
+		if idx < 0 || !m.Matches(v.Field(idx).Interface()) {
+			return false
+		}
+	}
+	return true
+}
+
+// match find the first unexhausted expectation of stub that matches req.
+// matched==false&&hasExpect==true means an unexpected call.
+func (c *Controller) match(stubInfo *StubInfo, req interface{}) (e *Expectation, hasExpect bool) {
+	key := fnMockKey{pkg: stubInfo.PkgName, owner: stubInfo.Owner, name: stubInfo.Name}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	for _, exp := range c.expectations {
+		if exp.key != key {
+			continue
+		}
+		hasExpect = true
+		if exp.exhausted() || !exp.matches(req) {
+			continue
+		}
+		exp.calls++
+		return exp, true
+	}
+	if hasExpect {
+		c.unexpected = append(c.unexpected, fmt.Sprintf("%s(%s)", stubInfo.String(), formatArgs(req)))
+	}
+	return nil, hasExpect
+}
+
+// Verify verifies the controller attached to ctx
+func Verify(ctx context.Context, t TestingT) {
+	t.Helper()
+	ctrl := getController(ctx)
+	if ctrl == nil {
+		panic(fmt.Errorf("no controller in ctx, use mock.WithController first"))
+	}
+	ctrl.Verify(t)
+}
+
+// Verify reports unmet expectations and unexpected calls to t
+func (c *Controller) Verify(t TestingT) {
+	t.Helper()
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	for _, e := range c.expectations {
+		if !e.satisfied() {
+			t.Errorf("missing call(s) to %s: expect at least %d, actual:%d", e.String(), e.minTimes, e.calls)
+		}
+	}
+	for _, call := range c.unexpected {
+		t.Errorf("unexpected call to %s", call)
+	}
+}
+
+// getExpectation applies expectations from ctx
+func getExpectation(ctx context.Context, stubInfo *StubInfo, req interface{}, resp interface{}) (mockResp bool, mockErr error) {
+	ctrl := getController(ctx)
+	if ctrl == nil {
+		return false, nil
+	}
+	e, _ := ctrl.match(stubInfo, req)
+	if e == nil || e.callOld {
+		// unexpected call goes to original
+		return false, nil
+	}
+	return true, setResults(resp, e.returns)
+}
+
+func formatArgs(req interface{}) string {
+	v := reflect.ValueOf(req).Elem()
+	list := make([]string, 0, v.NumField())
+	for i := 0; i < v.NumField(); i++ {
+		data, err := json.Marshal(v.Field(i).Interface())
+		s := string(data)
+		if err != nil {
+			s = fmt.Sprintf("%v", v.Field(i).Interface())
+		}
+		list = append(list, fmt.Sprintf("%s=%s", fieldName(v.Type().Field(i)), s))
+	}
+	return strings.Join(list, ", ")
+}
+
+func toMatcher(v interface{}) Matcher {
+	if m, ok := v.(Matcher); ok {
+		return m
+	}
+	return Eq(v)
+}
+
+type anyMatcher struct{}
+
+// Any matches any value
+func Any() Matcher {
+	return anyMatcher{}
+}
+func (anyMatcher) Matches(x interface{}) bool { return true }
+func (anyMatcher) String() string             { return "is anything" }
+
+type eqMatcher struct {
+	v interface{}
+}
+
+// Eq matches value by reflect.DeepEqual,
+// numbers of different types are compared by value.
+func Eq(v interface{}) Matcher {
+	return eqMatcher{v: v}
+}
+func (c eqMatcher) Matches(x interface{}) bool {
+	if reflect.DeepEqual(c.v, x) {
+		return true
+	}
+	if c.v == nil || x == nil {
+		return isNilValue(c.v) && isNilValue(x)
+	}
+	cv, err := toValue(c.v, reflect.TypeOf(x))
+	if err != nil {
+		return false
+	}
+	return reflect.DeepEqual(cv.Interface(), x)
+}
+func (c eqMatcher) String() string { return fmt.Sprintf("is equal to %v", c.v) }
+
+func isNilValue(v interface{}) bool {
+	if v == nil {
+		return true
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Ptr, reflect.Map, reflect.Slice, reflect.Interface, reflect.Func, reflect.Chan:
+		return rv.IsNil()
+	}
+	return false
+}
+
+type notMatcher struct {
+	m Matcher
+}
+
+// Not reverses m
+func Not(m interface{}) Matcher {
+	return notMatcher{m: toMatcher(m)}
+}
+func (c notMatcher) Matches(x interface{}) bool { return !c.m.Matches(x) }
+func (c notMatcher) String() string             { return "not(" + c.m.String() + ")" }
+
+type funcMatcher struct {
+	desc string
+	fn   func(x interface{}) bool
+}
+
+// MatchFunc creates a matcher from fn
+func MatchFunc(desc string, fn func(x interface{}) bool) Matcher {
+	return funcMatcher{desc: desc, fn: fn}
+}
+func (c funcMatcher) Matches(x interface{}) bool { return c.fn(x) }
+func (c funcMatcher) String() string             { return c.desc }
+
+type jsonSubsetMatcher struct {
+	v interface{}
+}
+
+// JSONSubset matches a value whose JSON contains the JSON of v,
+// see IsJSONSubset.
+func JSONSubset(v interface{}) Matcher {
+	return jsonSubsetMatcher{v: v}
+}
+func (c jsonSubsetMatcher) Matches(x interface{}) bool {
+	expected, err := toJSONValue(c.v)
+	if err != nil {
+		return false
+	}
+	actual, err := toJSONValue(x)
+	if err != nil {
+		return false
+	}
+	return IsJSONSubset(expected, actual)
+}
+func (c jsonSubsetMatcher) String() string { return fmt.Sprintf("contains JSON %v", c.v) }
+
+// toJSONValue converts v to a decoded JSON value,
+// json.RawMessage is decoded as is.
+func toJSONValue(v interface{}) (interface{}, error) {
+	data, ok := v.(json.RawMessage)
+	if !ok {
+		var err error
+		data, err = json.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+	}
+	var x interface{}
+	err := json.Unmarshal(data, &x)
+	return x, err
+}
+
+// IsJSONSubset tells whether actual contains expected, both are values
+// decoded by json.Unmarshal into interface{}: objects contain fields of
+// expected, arrays have the same length and contain expected element-wise,
+// other values are equal.
+func IsJSONSubset(expected interface{}, actual interface{}) bool {
+	switch expected := expected.(type) {
+	case map[string]interface{}:
+		actual, ok := actual.(map[string]interface{})
+		if !ok {
+			return false
+		}
+		for k, v := range expected {
+			av, ok := actual[k]
+			if !ok || !IsJSONSubset(v, av) {
+				return false
+			}
+		}
+		return true
+	case []interface{}:
+		actual, ok := actual.([]interface{})
+		if !ok || len(actual) != len(expected) {
+			return false
+		}
+		for i, v := range expected {
+			if !IsJSONSubset(v, actual[i]) {
+				return false
+			}
+		}
+		return true
+	default:
+		return expected == actual
+	}
+}
@@ -0,0 +1,160 @@
+package mock
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"testing"
+)
+
+type fakeT struct {
+	errors []string
+}
+
+func (c *fakeT) Helper() {}
+func (c *fakeT) Errorf(format string, args ...interface{}) {
+	c.errors = append(c.errors, fmt.Sprintf(format, args...))
+}
+
+// go test -run TestExpect -v ./mock
+func TestExpect(t *testing.T) {
+	ctrl := NewController()
+	ctx := WithController(context.Background(), ctrl)
+	Expect(ctx, "test", "", "Greet").WithArgs("a").Times(2).Return("mock a", nil)
+	Expect(ctx, "test", "", "Greet").WithArg("name", Not("a")).Return(nil, errors.New("mock err"))
+
+	for i := 0; i < 2; i++ {
+		s, err := greet(ctx, "a")
+		if s != "mock a" || err != nil {
+			t.Fatalf("expect %s = %+v, actual:%+v %v", `s`, "mock a", s, err)
+		}
+	}
+	_, err := greet(ctx, "b")
+	if err == nil || err.Error() != "mock err" {
+		t.Fatalf("expect %s = %+v, actual:%+v", `err`, "mock err", err)
+	}
+	// unexpected, goes to the original
+	s, _ := greet(ctx, "a")
+	if s != "hello a" {
+		t.Fatalf("expect %s = %+v, actual:%+v", `s`, "hello a", s)
+	}
+
+	ft := &fakeT{}
+	ctrl.Verify(ft)
+	if len(ft.errors) != 1 {
+		t.Fatalf("expect %s = %+v, actual:%+v", `len(ft.errors)`, 1, ft.errors)
+	}
+}
+
+// go test -run TestExpectInOrder -v ./mock
+func TestExpectInOrder(t *testing.T) {
+	ctrl := NewController()
+	ctx := WithController(context.Background(), ctrl)
+	first := Expect(ctx, "test", "", "Greet").WithArgs("a").Return("1", nil)
+	second := Expect(ctx, "test", "", "Greet").WithArgs(Any()).Return("2", nil)
+	InOrder(first, second)
+
+	s1, _ := greet(ctx, "a")
+	s2, _ := greet(ctx, "a")
+	if s1 != "1" || s2 != "2" {
+		t.Fatalf("expect %s = %+v, actual:%+v", `s1,s2`, "1,2", s1+","+s2)
+	}
+	ft := &fakeT{}
+	ctrl.Verify(ft)
+	if len(ft.errors) != 0 {
+		t.Fatalf("expect no errors, actual:%+v", ft.errors)
+	}
+
+	ft = &fakeT{}
+	Expect(ctx, "test", "", "Greet").MinTimes(1)
+	ctrl.Verify(ft)
+	if len(ft.errors) != 1 {
+		t.Fatalf("expect %s = %+v, actual:%+v", `len(ft.errors)`, 1, ft.errors)
+	}
+}
+
+// go test -run TestEqMatcher -v ./mock
+func TestEqMatcher(t *testing.T) {
+	if !Eq(1).Matches(int64(1)) {
+		t.Fatalf("expect int matches int64")
+	}
+	if Eq(1).Matches("1") {
+		t.Fatalf("expect int not matches string")
+	}
+	var p *int
+	if !Eq(nil).Matches(p) {
+		t.Fatalf("expect nil matches nil pointer")
+	}
+}
+
+// go test -run TestEqMatcherNumberLoss -v ./mock
+func TestEqMatcherNumberLoss(t *testing.T) {
+	if Eq(1.5).Matches(1) {
+		t.Fatalf("expect 1.5 not matches 1")
+	}
+	if Eq(257).Matches(int8(1)) {
+		t.Fatalf("expect 257 not matches int8(1)")
+	}
+	if Eq(-1).Matches(uint64(math.MaxUint64)) {
+		t.Fatalf("expect -1 not matches MaxUint64")
+	}
+	if Eq(uint64(math.MaxUint64)).Matches(-1) {
+		t.Fatalf("expect MaxUint64 not matches -1")
+	}
+	if !Eq(2.0).Matches(2) || !Eq(200).Matches(uint8(200)) || !Eq(1.5).Matches(float32(1.5)) {
+		t.Fatalf("expect numbers kept by conversion to match")
+	}
+}
+
+// go test -run TestConvertResultNumberLoss -v ./mock
+func TestConvertResultNumberLoss(t *testing.T) {
+	type resp struct {
+		N int     `json:"n"`
+		B int8    `json:"b"`
+		F float32 `json:"f"`
+	}
+	expectPanic := func(name string, fn func()) {
+		defer func() {
+			if recover() == nil {
+				t.Fatalf("expect %s to panic", name)
+			}
+		}()
+		fn()
+	}
+	expectPanic("Return(1.5) to int", func() {
+		setResults(&resp{}, []interface{}{1.5, 1, 1})
+	})
+	expectPanic("Set(b, 257)", func() {
+		AsFields(&resp{}).Set("b", 257)
+	})
+	expectPanic("Set(f, 1e300)", func() {
+		AsFields(&resp{}).Set("f", 1e300)
+	})
+
+	var r resp
+	setResults(&r, []interface{}{2.0, 100, 0.5})
+	if r.N != 2 || r.B != 100 || r.F != 0.5 {
+		t.Fatalf("expect %s = %+v, actual:%+v", "resp", resp{N: 2, B: 100, F: 0.5}, r)
+	}
+}
+
+// go test -run TestJSONSubset -v ./mock
+func TestJSONSubset(t *testing.T) {
+	type user struct {
+		ID   int64    `json:"id"`
+		Name string   `json:"name"`
+		Tags []string `json:"tags"`
+	}
+	u := &user{ID: 1, Name: "a", Tags: []string{"x"}}
+	if !JSONSubset(map[string]interface{}{"id": 1, "tags": []string{"x"}}).Matches(u) {
+		t.Fatalf("expect subset matches")
+	}
+	if JSONSubset(map[string]interface{}{"id": 2}).Matches(u) {
+		t.Fatalf("expect different id not matches")
+	}
+	if JSONSubset(json.RawMessage(`{"tags":[]}`)).Matches(u) {
+		t.Fatalf("expect arrays of different length not matches")
+	}
+}
@@ -0,0 +1,56 @@
+package mock
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/xhd2015/go-mock/inspect/serialize"
+)
+
+// FakeFallback decides what a method of a generated interface
+// fake does when its func field is nil.
+type FakeFallback int
+
+const (
+	// FakeZero returns zero values
+	FakeZero FakeFallback = iota
+	// FakePanic panics, to catch unexpected calls
+	FakePanic
+	// FakeDefault returns default values made by serialize.Mock,
+	// error is always nil.
+	FakeDefault
+)
+
+func (c FakeFallback) String() string {
+	switch c {
+	case FakeZero:
+		return "zero"
+	case FakePanic:
+		return "panic"
+	case FakeDefault:
+		return "default"
+	default:
+		return fmt.Sprintf("FakeFallback(%d)", int(c))
+	}
+}
+
+// FakeResults fills results of a fake method whose func field is nil,
+// results are pointers to the results excluding error.
+// This is not meant to be called by the user, but by the generated stub file.
+func FakeResults(fallback FakeFallback, stubInfo *StubInfo, results ...interface{}) {
+	switch fallback {
+	case FakeZero:
+	case FakePanic:
+		panic(fmt.Errorf("fake %s not implemented", stubInfo.String()))
+	case FakeDefault:
+		for _, res := range results {
+			v := reflect.ValueOf(res).Elem()
+			def := serialize.MockType(v.Type())
+			if def != nil {
+				v.Set(reflect.ValueOf(def))
+			}
+		}
+	default:
+		panic(fmt.Errorf("unknown fallback:%v", fallback))
+	}
+}
@@ -0,0 +1,33 @@
+package mock
+
+import (
+	"testing"
+)
+
+// go test -run TestFakeResults -v ./mock
+func TestFakeResults(t *testing.T) {
+	stub := &StubInfo{PkgName: "test", Owner: "Store", Name: "Get"}
+
+	var name string
+	var list []int
+	FakeResults(FakeZero, stub, &name, &list)
+	if name != "" || list != nil {
+		t.Fatalf("expect %s = %+v, actual:%+v", `name,list`, "zero", []interface{}{name, list})
+	}
+
+	FakeResults(FakeDefault, stub, &name, &list)
+	if list == nil {
+		t.Fatalf("expect %s = %+v, actual:%+v", `list`, "non-nil", list)
+	}
+
+	var panicErr interface{}
+	func() {
+		defer func() {
+			panicErr = recover()
+		}()
+		FakeResults(FakePanic, stub, &name)
+	}()
+	if panicErr == nil {
+		t.Fatalf("expect %s = %+v, actual:%+v", `panicErr`, "not nil", panicErr)
+	}
+}
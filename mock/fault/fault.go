@@ -0,0 +1,268 @@
+// Package fault injects latency, errors and panics into trapped
+// functions according to rules, to run binaries built by go-mock
+// under chaos scenarios without changing code.
+package fault
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/xhd2015/go-mock/mock"
+)
+
+const _SKIP_MOCK = true
+
+const (
+	// ENV_FAULT the JSON content of Config
+	ENV_FAULT = "GO_MOCK_FAULT"
+	// ENV_FAULT_FILE the JSON file of Config
+	ENV_FAULT_FILE = "GO_MOCK_FAULT_FILE"
+)
+
+// Config example:
+//
+//	{
+//	  "seed": 10,
+//	  "rules": [
+//	    {"pattern": "github.com/acme/dao/*::*::Find*", "probability": 0.1, "latency": "100ms", "max_latency": "1s"},
+//	    {"pattern": "github.com/acme/rpc::*::*", "probability": 0.05, "error_name": "context.DeadlineExceeded"},
+//	    {"pattern": "github.com/acme/cache::*::Get", "panic": "cache crashed"}
+//	  ]
+//	}
+type Config struct {
+	// Seed makes runs deterministic, 0 means seeded by time
+	Seed  int64   `json:"seed"`
+	Rules []*Rule `json:"rules"`
+}
+
+// Rule applies to stubs matching Pattern, see mock.Pattern
+// for the format.
+// When triggered, the latency is applied first, then the panic
+// or error if any.
+// Error only takes effect on functions returning error, others
+// run as normal, use Panic for them.
+type Rule struct {
+	Pattern string `json:"pattern"`
+	// Probability in [0,1], 0 means always
+	Probability float64 `json:"probability"`
+
+	// Latency a fixed latency, or the lower bound if MaxLatency is set
+	Latency Duration `json:"latency"`
+	// MaxLatency if greater than Latency, the latency is random in [Latency,MaxLatency)
+	MaxLatency Duration `json:"max_latency"`
+
+	// Error message of the error
+	Error string `json:"error"`
+	// ErrorName a registered error, see RegisterError
+	ErrorName string `json:"error_name"`
+
+	// Panic message of the panic
+	Panic string `json:"panic"`
+
+	pattern *mock.Pattern
+	err     error
+}
+
+// Duration is time.Duration in JSON, either a string like "100ms",
+// or a number of nanoseconds.
+type Duration time.Duration
+
+func (c Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(c).String())
+}
+
+func (c *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return err
+		}
+		*c = Duration(d)
+		return nil
+	}
+	var n int64
+	if err := json.Unmarshal(data, &n); err != nil {
+		return fmt.Errorf("invalid duration: %s", string(data))
+	}
+	*c = Duration(n)
+	return nil
+}
+
+var errorRegistryMutex sync.RWMutex
+var errorRegistry = map[string]error{
+	"context.Canceled":         context.Canceled,
+	"context.DeadlineExceeded": context.DeadlineExceeded,
+	"io.EOF":                   io.EOF,
+	"io.ErrUnexpectedEOF":      io.ErrUnexpectedEOF,
+	"io.ErrClosedPipe":         io.ErrClosedPipe,
+}
+
+// RegisterError makes err available to Rule.ErrorName,
+// so that callers checking errors.Is(err, target) are satisfied.
+func RegisterError(name string, err error) {
+	if err == nil {
+		panic(fmt.Errorf("err cannot be nil"))
+	}
+	errorRegistryMutex.Lock()
+	defer errorRegistryMutex.Unlock()
+	errorRegistry[name] = err
+}
+
+func getError(name string) error {
+	errorRegistryMutex.RLock()
+	defer errorRegistryMutex.RUnlock()
+	return errorRegistry[name]
+}
+
+// Injector decides faults of each call
+type Injector struct {
+	rules []*Rule
+
+	mutex sync.Mutex
+	rand  *rand.Rand
+}
+
+func ParseConfig(data []byte) (*Config, error) {
+	var config Config
+	err := json.Unmarshal(data, &config)
+	if err != nil {
+		return nil, fmt.Errorf("parse fault config: %v", err)
+	}
+	return &config, nil
+}
+
+func LoadConfig(file string) (*Config, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	return ParseConfig(data)
+}
+
+func New(config *Config) (*Injector, error) {
+	seed := config.Seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	rules := make([]*Rule, 0, len(config.Rules))
+	for i, rule := range config.Rules {
+		r := *rule
+		p, err := mock.ParsePattern(r.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("rule %d: %v", i, err)
+		}
+		r.pattern = p
+		if r.Probability < 0 || r.Probability > 1 {
+			return nil, fmt.Errorf("rule %d: probability must be in [0,1], actual:%v", i, r.Probability)
+		}
+		if r.ErrorName != "" {
+			r.err = getError(r.ErrorName)
+			if r.err == nil {
+				return nil, fmt.Errorf("rule %d: unknown error_name %s", i, r.ErrorName)
+			}
+		} else if r.Error != "" {
+			r.err = errors.New(r.Error)
+		}
+		rules = append(rules, &r)
+	}
+	return &Injector{
+		rules: rules,
+		rand:  rand.New(rand.NewSource(seed)),
+	}, nil
+}
+
+// Install adds the interceptor of c, until remove is called
+func (c *Injector) Install() (remove func()) {
+	return mock.AddInterceptor(c.Interceptor).Remove
+}
+
+// Interceptor applies the first triggered rule
+func (c *Injector) Interceptor(ctx context.Context, stubInfo *mock.StubInfo, inst, req, resp interface{}, f mock.Filter, next func(ctx context.Context) error) error {
+	ff, ok := f.(mock.FaultFilter)
+	if !ok {
+		return next(ctx)
+	}
+	rule, latency := c.pick(stubInfo)
+	if rule == nil {
+		return next(ctx)
+	}
+	if latency > 0 {
+		if err := sleep(ctx, latency); err != nil {
+			ff.SetMockError(err)
+			return next(ctx)
+		}
+	}
+	if rule.Panic != "" {
+		ff.SetMockPanic(fmt.Errorf("fault: %s", rule.Panic))
+	} else if rule.err != nil {
+		ff.SetMockError(rule.err)
+	}
+	return next(ctx)
+}
+
+func (c *Injector) pick(stubInfo *mock.StubInfo) (rule *Rule, latency time.Duration) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	for _, r := range c.rules {
+		if !r.pattern.Match(stubInfo) {
+			continue
+		}
+		if r.Probability > 0 && c.rand.Float64() >= r.Probability {
+			continue
+		}
+		latency = time.Duration(r.Latency)
+		if r.MaxLatency > r.Latency {
+			latency += time.Duration(c.rand.Int63n(int64(r.MaxLatency - r.Latency)))
+		}
+		return r, latency
+	}
+	return nil, 0
+}
+
+// sleep returns ctx.Err() if ctx is done before d elapses
+func sleep(ctx context.Context, d time.Duration) error {
+	if ctx == nil {
+		time.Sleep(d)
+		return nil
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// InstallFromEnv installs an injector configured by GO_MOCK_FAULT
+// or GO_MOCK_FAULT_FILE, it does nothing if neither is set.
+func InstallFromEnv() (installed bool, err error) {
+	var config *Config
+	if content := strings.TrimSpace(os.Getenv(ENV_FAULT)); content != "" {
+		config, err = ParseConfig([]byte(content))
+	} else if file := os.Getenv(ENV_FAULT_FILE); file != "" {
+		config, err = LoadConfig(file)
+	} else {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	injector, err := New(config)
+	if err != nil {
+		return false, err
+	}
+	injector.Install()
+	return true, nil
+}
@@ -0,0 +1,164 @@
+package fault
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/xhd2015/go-mock/mock"
+)
+
+var getStub = &mock.StubInfo{PkgName: "test/dao", Name: "Get"}
+
+// simulate the rewritten code
+func get(ctx context.Context) (n int, err error) {
+	var _mockreq = struct{}{}
+	var _mockresp struct {
+		N int `json:"n"`
+	}
+	err = mock.TrapFunc(ctx, getStub, nil, &_mockreq, &_mockresp, _mockget, false, true, true)
+	n = _mockresp.N
+	return
+}
+func _mockget(ctx context.Context) (n int, err error) {
+	return 1, nil
+}
+
+var touchStub = &mock.StubInfo{PkgName: "test/dao", Name: "Touch"}
+var countStub = &mock.StubInfo{PkgName: "test/dao", Name: "Count"}
+
+var touched int
+
+// simulate the rewritten code of a function without results
+func touch(ctx context.Context) {
+	var _mockreq = struct{}{}
+	var _mockresp struct{}
+	mock.TrapFunc(ctx, touchStub, nil, &_mockreq, &_mockresp, _mocktouch, false, true, false)
+}
+func _mocktouch(ctx context.Context) {
+	touched++
+}
+
+// simulate the rewritten code of a function without error result
+func count(ctx context.Context) (n int) {
+	var _mockreq = struct{}{}
+	var _mockresp struct {
+		N int `json:"n"`
+	}
+	mock.TrapFunc(ctx, countStub, nil, &_mockreq, &_mockresp, _mockcount, false, true, false)
+	n = _mockresp.N
+	return
+}
+func _mockcount(ctx context.Context) (n int) {
+	return 2
+}
+
+// go test -run TestFaultError -v ./mock/fault
+func TestFaultError(t *testing.T) {
+	config, err := ParseConfig([]byte(`{"rules":[{"pattern":"test/dao::*::G*","error_name":"context.DeadlineExceeded"}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	injector, err := New(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	remove := injector.Install()
+	_, err = get(context.Background())
+	remove()
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expect %s = %+v, actual:%+v", `err`, context.DeadlineExceeded, err)
+	}
+	if n, err := get(context.Background()); n != 1 || err != nil {
+		t.Fatalf("expect %s = %+v, actual:%+v %v", `n`, 1, n, err)
+	}
+}
+
+// go test -run TestFaultErrorNoErrorResult -v ./mock/fault
+func TestFaultErrorNoErrorResult(t *testing.T) {
+	injector, err := New(&Config{Rules: []*Rule{{Pattern: "test/dao::*::*", Error: "broken"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	remove := injector.Install()
+
+	// the error cannot be returned, the original function runs
+	touched = 0
+	touch(context.Background())
+	if touched != 1 {
+		t.Fatalf("expect %s = %+v, actual:%+v", `touched`, 1, touched)
+	}
+	if n := count(context.Background()); n != 2 {
+		t.Fatalf("expect %s = %+v, actual:%+v", `n`, 2, n)
+	}
+	remove()
+
+	// so does a latency stopped by the context
+	injector, err = New(&Config{Rules: []*Rule{{Pattern: "test/dao::*::Count", Latency: Duration(time.Second)}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer injector.Install()()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if n := count(ctx); n != 2 {
+		t.Fatalf("expect %s = %+v, actual:%+v", `n`, 2, n)
+	}
+}
+
+// go test -run TestFaultLatency -v ./mock/fault
+func TestFaultLatency(t *testing.T) {
+	injector, err := New(&Config{Rules: []*Rule{{Pattern: "test/dao", Latency: Duration(time.Second)}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer injector.Install()()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	begin := time.Now()
+	_, err = get(ctx)
+	if cost := time.Since(begin); cost > 500*time.Millisecond {
+		t.Fatalf("expect latency respects deadline, actual:%v", cost)
+	}
+	if err != context.DeadlineExceeded {
+		t.Fatalf("expect %s = %+v, actual:%+v", `err`, context.DeadlineExceeded, err)
+	}
+}
+
+// go test -run TestFaultPanic -v ./mock/fault
+func TestFaultPanic(t *testing.T) {
+	injector, err := New(&Config{Rules: []*Rule{{Pattern: "test/*", Panic: "crash"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer injector.Install()()
+	defer func() {
+		if e := recover(); e == nil {
+			t.Fatalf("expect panic")
+		}
+	}()
+	get(context.Background())
+}
+
+// go test -run TestFaultProbability -v ./mock/fault
+func TestFaultProbability(t *testing.T) {
+	run := func() int {
+		injector, err := New(&Config{Seed: 10, Rules: []*Rule{{Pattern: "*", Probability: 0.5, Error: "fault"}}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		n := 0
+		for i := 0; i < 100; i++ {
+			if rule, _ := injector.pick(getStub); rule != nil {
+				n++
+			}
+		}
+		return n
+	}
+	n1, n2 := run(), run()
+	if n1 != n2 || n1 == 0 || n1 == 100 {
+		t.Fatalf("expect deterministic partial faults, actual:%d %d", n1, n2)
+	}
+}
@@ -0,0 +1,205 @@
+package mock
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"strings"
+)
+
+// fieldName returns the name of a generated req/resp field,
+// which is the name in json tag, or the go name if no tag.
+func fieldName(f reflect.StructField) string {
+	tag := f.Tag.Get("json")
+	if idx := strings.Index(tag, ","); idx >= 0 {
+		tag = tag[:idx]
+	}
+	if tag == "" || tag == "-" {
+		return f.Name
+	}
+	return tag
+}
+
+// fieldIndex find field by json name or go name
+func fieldIndex(t reflect.Type, name string) int {
+	for i := 0; i < t.NumField(); i++ {
+		if fieldName(t.Field(i)) == name {
+			return i
+		}
+	}
+	for i := 0; i < t.NumField(); i++ {
+		if t.Field(i).Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// toValue converts v to type t, nil is converted to zero value,
+// numbers are converted between different kinds only if the
+// value is kept, see convertNumber.
+func toValue(v interface{}, t reflect.Type) (reflect.Value, error) {
+	if v == nil {
+		return reflect.Zero(t), nil
+	}
+	rv := reflect.ValueOf(v)
+	if rv.Type().AssignableTo(t) {
+		if rv.Type() == t {
+			return rv, nil
+		}
+		x := reflect.New(t).Elem()
+		x.Set(rv)
+		return x, nil
+	}
+	if isNumberKind(rv.Kind()) && isNumberKind(t.Kind()) {
+		return convertNumber(rv, t)
+	}
+	if rv.Kind() == t.Kind() && rv.Type().ConvertibleTo(t) {
+		return rv.Convert(t), nil
+	}
+	return reflect.Value{}, fmt.Errorf("cannot use %T as %v", v, t)
+}
+
+// convertNumber converts rv to t if the value survives the round trip
+// and keeps its sign, so 1.5 to int, 257 to int8 and -1 to uint64 fail.
+// Between floats only overflow fails, the precision of 0.1 as float32
+// is lost as in go.
+func convertNumber(rv reflect.Value, t reflect.Type) (reflect.Value, error) {
+	x := rv.Convert(t)
+	if isFloatKind(rv.Kind()) && isFloatKind(t.Kind()) {
+		f := rv.Float()
+		if !math.IsInf(f, 0) && math.IsInf(x.Float(), 0) {
+			return reflect.Value{}, fmt.Errorf("cannot use %v as %v: overflow", rv.Interface(), t)
+		}
+		return x, nil
+	}
+	if x.Convert(rv.Type()).Interface() != rv.Interface() || isNegative(x) != isNegative(rv) {
+		return reflect.Value{}, fmt.Errorf("cannot use %v as %v: value changed to %v", rv.Interface(), t, x.Interface())
+	}
+	return x, nil
+}
+
+func isNegative(v reflect.Value) bool {
+	switch {
+	case isFloatKind(v.Kind()):
+		return v.Float() < 0
+	case v.Kind() >= reflect.Int && v.Kind() <= reflect.Int64:
+		return v.Int() < 0
+	}
+	return false
+}
+
+func isFloatKind(k reflect.Kind) bool {
+	return k == reflect.Float32 || k == reflect.Float64
+}
+
+func isNumberKind(k reflect.Kind) bool {
+	switch k {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
+
+// setResults set values to resp, if values has one more
+// element than resp's fields, the last is treated as error.
+func setResults(resp interface{}, values []interface{}) (err error) {
+	v := reflect.ValueOf(resp).Elem()
+	t := v.Type()
+	n := t.NumField()
+	if len(values) != n && len(values) != n+1 {
+		panic(fmt.Errorf("expecting %d or %d return values, actual:%d, resp=%T", n, n+1, len(values), resp))
+	}
+	if len(values) == n+1 {
+		last := values[n]
+		if last != nil {
+			var ok bool
+			err, ok = last.(error)
+			if !ok {
+				panic(fmt.Errorf("last return value must be error, actual:%T", last))
+			}
+		}
+		values = values[:n]
+	}
+	res := make([]reflect.Value, 0, n)
+	for i, val := range values {
+		x, cerr := toValue(val, t.Field(i).Type)
+		if cerr != nil {
+			panic(fmt.Errorf("return value %d: %v", i, cerr))
+		}
+		res = append(res, x)
+	}
+	valuesToStruct(res, resp)
+	return
+}
+
+// Fields is a generic view of the generated req/resp struct,
+// fields are accessed by their json names, which are the same
+// as the argument and result names in source.
+type Fields struct {
+	v reflect.Value
+}
+
+// AsFields wraps a pointer to the generated req/resp struct
+func AsFields(v interface{}) *Fields {
+	if !isStructPtr(v) {
+		panic(fmt.Errorf("val must be non-nil pointer to struct, found:%T", v))
+	}
+	return &Fields{v: reflect.ValueOf(v).Elem()}
+}
+
+// isStructPtr tells whether v is a non-nil pointer to struct
+func isStructPtr(v interface{}) bool {
+	ptr := reflect.ValueOf(v)
+	return ptr.Kind() == reflect.Ptr && !ptr.IsNil() && ptr.Elem().Kind() == reflect.Struct
+}
+
+// Names returns field names in declaring order
+func (c *Fields) Names() []string {
+	t := c.v.Type()
+	names := make([]string, 0, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		names = append(names, fieldName(t.Field(i)))
+	}
+	return names
+}
+
+func (c *Fields) Len() int {
+	return c.v.NumField()
+}
+
+func (c *Fields) Has(name string) bool {
+	return fieldIndex(c.v.Type(), name) >= 0
+}
+
+// Get returns the value of the named field, it panics if not found.
+func (c *Fields) Get(name string) interface{} {
+	return c.v.Field(c.mustIndex(name)).Interface()
+}
+
+// Type returns the type of the named field, it panics if not found.
+func (c *Fields) Type(name string) reflect.Type {
+	return c.v.Type().Field(c.mustIndex(name)).Type
+}
+
+// Set sets the named field, value is converted like
+// Expectation.Return does, it panics if not found or
+// value cannot be converted.
+func (c *Fields) Set(name string, value interface{}) {
+	idx := c.mustIndex(name)
+	x, err := toValue(value, c.v.Type().Field(idx).Type)
+	if err != nil {
+		panic(fmt.Errorf("set %s: %v", name, err))
+	}
+	c.v.Field(idx).Set(x)
+}
+
+func (c *Fields) mustIndex(name string) int {
+	idx := fieldIndex(c.v.Type(), name)
+	if idx < 0 {
+		panic(fmt.Errorf("no field %s in %v", name, c.v.Type()))
+	}
+	return idx
+}
@@ -0,0 +1,128 @@
+package mock
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/xhd2015/go-mock/inspect/typeinfo"
+)
+
+// TypeArgsString returns type arguments of a generic function or
+// method of a generic type in brackets, e.g. `[string,main.User]`,
+// or "" if not generic.
+func (c *StubInfo) TypeArgsString() string {
+	if len(c.TypeArgs) == 0 {
+		return ""
+	}
+	names := make([]string, 0, len(c.TypeArgs))
+	for _, t := range c.TypeArgs {
+		names = append(names, t.String())
+	}
+	return "[" + strings.Join(names, ",") + "]"
+}
+
+// type ids make type arguments a comparable key,
+// reflect.Type.String() is not unique across packages.
+var typeIDMutex sync.Mutex
+var typeIDs = make(map[reflect.Type]int)
+
+func typeArgsKey(typeArgs []reflect.Type) string {
+	if len(typeArgs) == 0 {
+		return ""
+	}
+	typeIDMutex.Lock()
+	defer typeIDMutex.Unlock()
+	ids := make([]string, 0, len(typeArgs))
+	for _, t := range typeArgs {
+		id, ok := typeIDs[t]
+		if !ok {
+			id = len(typeIDs) + 1
+			typeIDs[t] = id
+		}
+		ids = append(ids, strconv.Itoa(id))
+	}
+	return strings.Join(ids, ",")
+}
+
+// WithGenericMock inject mock of one instantiation of a generic function,
+// or a method of a generic type into the context.
+// typeArgs are the type arguments in declaration order of the function's
+// type params, or the receiver type's type params for methods.
+// Other instantiations are not affected, use WithPatternMock to mock
+// all instantiations.
+func WithGenericMock(ctx context.Context, pkg string, owner string, name string, typeArgs []reflect.Type, fn interface{}) context.Context {
+	if fn == nil {
+		panic(fmt.Errorf("fn cannot be nil"))
+	}
+	if len(typeArgs) == 0 {
+		panic(fmt.Errorf("typeArgs cannot be empty"))
+	}
+	return context.WithValue(ctx, fnMockKey{pkg: pkg, owner: owner, name: name, typeArgs: typeArgsKey(typeArgs)}, fn)
+}
+
+// generic functions cannot be registered at package level,
+// each instantiation is registered on its first call.
+var registeredInstantiations sync.Map
+
+// registerInstantiation registers stubInfo with type arguments appended
+// to the owner for methods, or to the name for functions, like `Cache[string,main.User]`.
+// Type arguments are qualified by package paths if the name is taken by
+// another instantiation, like `Cache[string,github.com/acme/main.User]`.
+// Args and results are taken from fields of req and resp.
+func registerInstantiation(stubInfo *StubInfo, inst interface{}, req interface{}, resp interface{}, firstIsCtx bool, lastIsErr bool) {
+	// keyed by type ids, see typeArgsKey
+	if _, loaded := registeredInstantiations.LoadOrStore(newStubKey(stubInfo), true); loaded {
+		return
+	}
+	defer func() {
+		// registration must not break the call
+		if e := recover(); e != nil {
+			fmt.Fprintf(os.Stderr, "go-mock: register %s: %v\n", stubInfo.String(), e)
+		}
+	}()
+	var ownerType reflect.Type
+	if stubInfo.Owner != "" {
+		ownerType = reflect.TypeOf(inst)
+	}
+	owner, name := instantiationNames(stubInfo, stubInfo.TypeArgsString())
+	if hasMockStub(stubInfo.PkgName, owner, name) {
+		owner, name = instantiationNames(stubInfo, qualifiedTypeArgsString(stubInfo.TypeArgs))
+	}
+	RegisterMockStub(stubInfo.PkgName, owner, ownerType, name, structTypeInfos(req), structTypeInfos(resp), firstIsCtx, lastIsErr)
+}
+
+func instantiationNames(stubInfo *StubInfo, typeArgs string) (owner string, name string) {
+	if stubInfo.Owner != "" {
+		return stubInfo.Owner + typeArgs, stubInfo.Name
+	}
+	return "", stubInfo.Name + typeArgs
+}
+
+// qualifiedTypeArgsString is like TypeArgsString, with
+// named types qualified by their package path
+func qualifiedTypeArgsString(typeArgs []reflect.Type) string {
+	names := make([]string, 0, len(typeArgs))
+	for _, t := range typeArgs {
+		if t.Name() != "" && t.PkgPath() != "" {
+			names = append(names, t.PkgPath()+"."+t.Name())
+		} else {
+			names = append(names, t.String())
+		}
+	}
+	return "[" + strings.Join(names, ",") + "]"
+}
+
+func structTypeInfos(s interface{}) []typeinfo.TypeInfo {
+	t := reflect.TypeOf(s).Elem()
+	infos := make([]typeinfo.TypeInfo, 0, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		infos = append(infos, typeinfo.NewTypeInfo(fieldName(field), field.Type))
+	}
+	return infos
+}
@@ -0,0 +1,111 @@
+package mock
+
+import (
+	"context"
+	htmltemplate "html/template"
+	"reflect"
+	"testing"
+	texttemplate "text/template"
+)
+
+// the following simulate instantiations of a rewritten generic function:
+//    func First[T any](ctx context.Context, list []T) (v T)
+
+func firstInt(ctx context.Context, list []int) (v int) {
+	var _mockreq = struct {
+		List []int `json:"list"`
+	}{List: list}
+	var _mockresp struct {
+		V int `json:"v"`
+	}
+	TrapFunc(ctx, &StubInfo{PkgName: "test", Name: "First", TypeArgs: []reflect.Type{reflect.TypeOf((*int)(nil)).Elem()}}, nil, &_mockreq, &_mockresp, _mockFirstInt, false, true, false)
+	v = _mockresp.V
+	return
+}
+func _mockFirstInt(ctx context.Context, list []int) (v int) {
+	return list[0]
+}
+
+func firstString(ctx context.Context, list []string) (v string) {
+	var _mockreq = struct {
+		List []string `json:"list"`
+	}{List: list}
+	var _mockresp struct {
+		V string `json:"v"`
+	}
+	TrapFunc(ctx, &StubInfo{PkgName: "test", Name: "First", TypeArgs: []reflect.Type{reflect.TypeOf((*string)(nil)).Elem()}}, nil, &_mockreq, &_mockresp, _mockFirstString, false, true, false)
+	v = _mockresp.V
+	return
+}
+func _mockFirstString(ctx context.Context, list []string) (v string) {
+	return list[0]
+}
+
+// go test -run TestGenericMock -v ./mock
+func TestGenericMock(t *testing.T) {
+	ctx := WithGenericMock(context.Background(), "test", "", "First", []reflect.Type{reflect.TypeOf((*int)(nil)).Elem()}, func(ctx context.Context, list []int) int {
+		return 100
+	})
+	if v := firstInt(ctx, []int{1}); v != 100 {
+		t.Fatalf("expect %s = %+v, actual:%+v", `v`, 100, v)
+	}
+	// other instantiations are not affected
+	if v := firstString(ctx, []string{"a"}); v != "a" {
+		t.Fatalf("expect %s = %+v, actual:%+v", `v`, "a", v)
+	}
+
+	// all instantiations
+	ctx = WithPatternMock(ctx, "test::::First", func(ctx context.Context, call *DynamicCall) error {
+		if call.Stub.TypeArgs[0].Kind() != reflect.String {
+			CallOld()
+		}
+		call.Results.Set("v", "pattern")
+		return nil
+	})
+	if v := firstString(ctx, []string{"a"}); v != "pattern" {
+		t.Fatalf("expect %s = %+v, actual:%+v", `v`, "pattern", v)
+	}
+	// instantiation mock takes precedence
+	if v := firstInt(ctx, []int{1}); v != 100 {
+		t.Fatalf("expect %s = %+v, actual:%+v", `v`, 100, v)
+	}
+
+	// each instantiation is registered
+	funcs := GetMockStubs().PkgMapping["test"].FuncMapping[""]
+	for _, name := range []string{"First[int]", "First[string]"} {
+		if funcs[name] == nil {
+			t.Fatalf("expect %s registered, actual:%+v", name, funcs)
+		}
+	}
+}
+
+// go test -run TestStubInfoTypeArgs -v ./mock
+func TestStubInfoTypeArgs(t *testing.T) {
+	stub := &StubInfo{PkgName: "test", Owner: "Cache", OwnerPtr: true, Name: "Get", TypeArgs: []reflect.Type{reflect.TypeOf(""), reflect.TypeOf(0)}}
+	if s := stub.String(); s != "test.*Cache[string,int].Get" {
+		t.Fatalf("expect %s = %+v, actual:%+v", `s`, "test.*Cache[string,int].Get", s)
+	}
+	fn := &StubInfo{PkgName: "test", Name: "First", TypeArgs: []reflect.Type{reflect.TypeOf(0)}}
+	if s := fn.String(); s != "test.First[int]" {
+		t.Fatalf("expect %s = %+v, actual:%+v", `s`, "test.First[int]", s)
+	}
+}
+
+// go test -run TestRegisterInstantiationSameName -v ./mock
+func TestRegisterInstantiationSameName(t *testing.T) {
+	// both are template.Template
+	textType := reflect.TypeOf(texttemplate.Template{})
+	htmlType := reflect.TypeOf(htmltemplate.Template{})
+	for _, typ := range []reflect.Type{textType, htmlType} {
+		var _mockreq struct{}
+		var _mockresp struct{}
+		stub := &StubInfo{PkgName: "test/same", Name: "New", TypeArgs: []reflect.Type{typ}}
+		TrapFunc(context.Background(), stub, nil, &_mockreq, &_mockresp, func(ctx context.Context) {}, false, true, false)
+	}
+	funcs := GetMockStubs().PkgMapping["test/same"].FuncMapping[""]
+	for _, name := range []string{"New[template.Template]", "New[html/template.Template]"} {
+		if funcs[name] == nil {
+			t.Fatalf("expect %s registered, actual:%+v", name, funcs)
+		}
+	}
+}
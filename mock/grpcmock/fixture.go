@@ -0,0 +1,112 @@
+package grpcmock
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/xhd2015/go-mock/inspect/serialize"
+	"github.com/xhd2015/go-mock/mock"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Config example:
+//
+//	{
+//	  "methods": {
+//	    "/acme.user.UserService/GetUser": {"reply": {"id": 1, "name": "alice"}},
+//	    "/acme.user.UserService/DeleteUser": {"code": "NOT_FOUND", "message": "user not found"}
+//	  }
+//	}
+type Config struct {
+	Methods map[string]*Response `json:"methods"`
+}
+
+// Response is the result of a mocked method. Reply is unmarshaled
+// into the reply message by serialize.Unmarshal. Code, if not OK,
+// makes the call fail with a status error of Code and Message instead.
+// Code can be given by name like "NOT_FOUND", or by number.
+type Response struct {
+	Reply   json.RawMessage `json:"reply,omitempty"`
+	Code    codes.Code      `json:"code,omitempty"`
+	Message string          `json:"message,omitempty"`
+}
+
+// ParseConfig parses config
+func ParseConfig(data []byte) (*Config, error) {
+	var config Config
+	err := json.Unmarshal(data, &config)
+	if err != nil {
+		return nil, err
+	}
+	return &config, nil
+}
+
+// LoadConfig loads config from files, methods of former
+// files take precedence.
+func LoadConfig(files ...string) (*Config, error) {
+	config := &Config{Methods: make(map[string]*Response)}
+	for _, file := range files {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		c, err := ParseConfig(data)
+		if err != nil {
+			return nil, fmt.Errorf("parse %s: %v", file, err)
+		}
+		for method, resp := range c.Methods {
+			if _, ok := config.Methods[method]; !ok {
+				config.Methods[method] = resp
+			}
+		}
+	}
+	return config, nil
+}
+
+// Fixtures serves calls of methods in config
+type Fixtures struct {
+	methods map[string]*Response
+}
+
+// New creates fixtures of config
+func New(config *Config) *Fixtures {
+	c := &Fixtures{methods: make(map[string]*Response, len(config.Methods))}
+	for method, resp := range config.Methods {
+		if resp != nil {
+			c.methods[method] = resp
+		}
+	}
+	return c
+}
+
+// Patch serves calls of the whole process, until restore is called
+func (c *Fixtures) Patch() (restore func()) {
+	return mock.Patch(NewStubInfo(), c.mockInvoke)
+}
+
+// WithFixtures serves calls with ctx by fixtures
+func WithFixtures(ctx context.Context, fixtures *Fixtures) context.Context {
+	return mock.WithMock(ctx, PKG, OWNER, NAME, fixtures.mockInvoke)
+}
+
+// mockInvoke serves methods in fixtures, others are sent for real
+func (c *Fixtures) mockInvoke(cc *grpc.ClientConn, ctx context.Context, method string, args, reply interface{}, opts ...grpc.CallOption) error {
+	resp := c.methods[method]
+	if resp == nil {
+		mock.CallOld()
+	}
+	if resp.Code != codes.OK {
+		return status.Error(resp.Code, resp.Message)
+	}
+	if len(resp.Reply) > 0 {
+		err := serialize.Unmarshal(resp.Reply, reply)
+		if err != nil {
+			return status.Errorf(codes.Internal, "grpcmock: unmarshal reply of %s: %v", method, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,10 @@
+module github.com/xhd2015/go-mock/mock/grpcmock
+
+go 1.13
+
+require (
+	github.com/xhd2015/go-mock v1.1.0
+	google.golang.org/grpc v1.47.0
+)
+
+replace github.com/xhd2015/go-mock => ../..
@@ -0,0 +1,58 @@
+// Package grpcmock mocks RPC clients of google.golang.org/grpc
+// by full method name, like `/pkg.Service/Method`, with replies
+// given as JSON.
+//
+// Calls are trapped as method Invoke of owner ClientConn in package
+// google.golang.org/grpc, either by the rewritten grpc.(*ClientConn).Invoke,
+// which is enabled by listing google.golang.org/grpc via -mock-module,
+// or by UnaryClientInterceptor, which needs no rewriting. Use only one
+// of them, otherwise calls are trapped twice.
+//
+// This package is a separate module, so that go-mock itself does
+// not depend on grpc.
+package grpcmock
+
+import (
+	"context"
+
+	"github.com/xhd2015/go-mock/mock"
+	"google.golang.org/grpc"
+)
+
+const _SKIP_MOCK = true
+
+const (
+	PKG   = "google.golang.org/grpc"
+	OWNER = "ClientConn"
+	NAME  = "Invoke"
+)
+
+// InvokeReq is the req of trapped Invoke, as seen by interceptors
+type InvokeReq struct {
+	Method string            `json:"method"`
+	Args   interface{}       `json:"args"`
+	Reply  interface{}       `json:"reply"`
+	Opts   []grpc.CallOption `json:"opts"`
+}
+
+// NewStubInfo returns the stub of trapped Invoke, to be used with mock.Patch.
+// Mock functions have the signature:
+//
+//	func(cc *grpc.ClientConn, ctx context.Context, method string, args, reply interface{}, opts ...grpc.CallOption) error
+func NewStubInfo() *mock.StubInfo {
+	return &mock.StubInfo{PkgName: PKG, Owner: OWNER, OwnerPtr: true, Name: NAME}
+}
+
+// UnaryClientInterceptor traps unary calls of clients dialed with
+// grpc.WithUnaryInterceptor(grpcmock.UnaryClientInterceptor()),
+// calls not mocked are sent by invoker.
+func UnaryClientInterceptor() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		_mockreq := InvokeReq{Method: method, Args: req, Reply: reply, Opts: opts}
+		var _mockresp struct{}
+		invoke := func(cc *grpc.ClientConn, ctx context.Context, method string, args, reply interface{}, opts ...grpc.CallOption) error {
+			return invoker(ctx, method, args, reply, cc, opts...)
+		}
+		return mock.TrapFunc(ctx, NewStubInfo(), cc, &_mockreq, &_mockresp, invoke, true, true, true)
+	}
+}
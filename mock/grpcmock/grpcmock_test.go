@@ -0,0 +1,109 @@
+package grpcmock
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+const checkMethod = "/grpc.health.v1.Health/Check"
+
+// newHealthClient serves the health service in process over bufconn
+func newHealthClient(t *testing.T) (client healthpb.HealthClient, stop func()) {
+	lis := bufconn.Listen(1024 * 1024)
+	server := grpc.NewServer()
+	healthpb.RegisterHealthServer(server, health.NewServer())
+	go server.Serve(lis)
+
+	conn, err := grpc.Dial("bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, s string) (net.Conn, error) {
+			return lis.Dial()
+		}),
+		grpc.WithInsecure(),
+		grpc.WithUnaryInterceptor(UnaryClientInterceptor()),
+	)
+	if err != nil {
+		server.Stop()
+		t.Fatal(err)
+	}
+	return healthpb.NewHealthClient(conn), func() {
+		conn.Close()
+		server.Stop()
+	}
+}
+
+// go test -run TestFixtures -v ./
+func TestFixtures(t *testing.T) {
+	client, stop := newHealthClient(t)
+	defer stop()
+	config, err := ParseConfig([]byte(`{
+		"methods": {
+			"/grpc.health.v1.Health/Check": {"reply": {"status": 2}}
+		}
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := WithFixtures(context.Background(), New(config))
+
+	resp, err := client.Check(ctx, &healthpb.HealthCheckRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Status != healthpb.HealthCheckResponse_NOT_SERVING {
+		t.Fatalf("expect %s = %+v, actual:%+v", "status", healthpb.HealthCheckResponse_NOT_SERVING, resp.Status)
+	}
+
+	// without fixtures, served by the server
+	resp, err = client.Check(context.Background(), &healthpb.HealthCheckRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Status != healthpb.HealthCheckResponse_SERVING {
+		t.Fatalf("expect %s = %+v, actual:%+v", "status", healthpb.HealthCheckResponse_SERVING, resp.Status)
+	}
+
+	// methods not in fixtures are served by the server
+	ctx = WithFixtures(context.Background(), New(&Config{Methods: map[string]*Response{
+		"/grpc.health.v1.Health/Other": {Code: codes.Internal},
+	}}))
+	_, err = client.Check(ctx, &healthpb.HealthCheckRequest{Service: "unknown"})
+	if status.Code(err) != codes.NotFound {
+		t.Fatalf("expect %s = %+v, actual:%+v", "code", codes.NotFound, status.Code(err))
+	}
+}
+
+// go test -run TestStatusError -v ./
+func TestStatusError(t *testing.T) {
+	client, stop := newHealthClient(t)
+	defer stop()
+	config, err := ParseConfig([]byte(`{
+		"methods": {
+			"/grpc.health.v1.Health/Check": {"code": "PERMISSION_DENIED", "message": "no access"}
+		}
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	restore := New(config).Patch()
+	defer restore()
+
+	_, err = client.Check(context.Background(), &healthpb.HealthCheckRequest{})
+	st, _ := status.FromError(err)
+	if st.Code() != codes.PermissionDenied || st.Message() != "no access" {
+		t.Fatalf("expect %s = %+v, actual:%+v", "status", "PermissionDenied: no access", st)
+	}
+
+	restore()
+	_, err = client.Check(context.Background(), &healthpb.HealthCheckRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
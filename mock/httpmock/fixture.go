@@ -0,0 +1,338 @@
+package httpmock
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/xhd2015/go-mock/mock"
+)
+
+// HAR is the subset of HTTP Archive format used by fixtures, example:
+//
+//	{
+//	  "log": {
+//	    "entries": [
+//	      {
+//	        "request": {
+//	          "method": "POST",
+//	          "url": "https://api.acme.com/users/*",
+//	          "headers": [{"name": "X-Env", "value": "test"}],
+//	          "postData": {"mimeType": "application/json", "text": "{\"type\":\"admin\"}"}
+//	        },
+//	        "response": {
+//	          "status": 200,
+//	          "headers": [{"name": "Content-Type", "value": "application/json"}],
+//	          "content": {"text": "{\"id\":1,\"name\":\"mock\"}"}
+//	        }
+//	      }
+//	    ]
+//	  }
+//	}
+type HAR struct {
+	Log *Log `json:"log"`
+}
+
+type Log struct {
+	Entries []*Entry `json:"entries"`
+}
+
+// Entry serves Response to requests matching Request
+type Entry struct {
+	Request  *Request  `json:"request"`
+	Response *Response `json:"response"`
+}
+
+// Request describes requests to be matched, empty fields match any request.
+// Method is compared case-insensitively. URL is a glob where `*` matches
+// any characters, including `/` and `?`. Each of Headers must be present
+// with the same value. PostData.Text must be a JSON subset of the body
+// if it is JSON, see mock.IsJSONSubset, otherwise equal to the body.
+type Request struct {
+	Method   string    `json:"method,omitempty"`
+	URL      string    `json:"url,omitempty"`
+	Headers  []*Header `json:"headers,omitempty"`
+	PostData *PostData `json:"postData,omitempty"`
+}
+
+type Header struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type PostData struct {
+	MimeType string `json:"mimeType,omitempty"`
+	Text     string `json:"text"`
+}
+
+type Response struct {
+	Status     int       `json:"status"`
+	StatusText string    `json:"statusText,omitempty"`
+	Headers    []*Header `json:"headers,omitempty"`
+	Content    *Content  `json:"content,omitempty"`
+}
+
+type Content struct {
+	MimeType string `json:"mimeType,omitempty"`
+	Text     string `json:"text"`
+}
+
+// Fixtures serves requests by the first matching entry
+type Fixtures struct {
+	entries []*Entry
+}
+
+// NewFixtures creates fixtures of entries in hars, in order
+func NewFixtures(hars ...*HAR) *Fixtures {
+	c := &Fixtures{}
+	for _, har := range hars {
+		if har == nil || har.Log == nil {
+			continue
+		}
+		for _, e := range har.Log.Entries {
+			if e == nil || e.Request == nil || e.Response == nil {
+				continue
+			}
+			c.entries = append(c.entries, e)
+		}
+	}
+	return c
+}
+
+// ParseHAR parses a HAR file content
+func ParseHAR(data []byte) (*HAR, error) {
+	var har HAR
+	err := json.Unmarshal(data, &har)
+	if err != nil {
+		return nil, err
+	}
+	return &har, nil
+}
+
+// LoadFixtures loads fixtures from HAR files, entries of
+// former files take precedence.
+func LoadFixtures(files ...string) (*Fixtures, error) {
+	hars := make([]*HAR, 0, len(files))
+	for _, file := range files {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		har, err := ParseHAR(data)
+		if err != nil {
+			return nil, fmt.Errorf("parse %s: %v", file, err)
+		}
+		hars = append(hars, har)
+	}
+	return NewFixtures(hars...), nil
+}
+
+// Patch serves requests of the whole process, until restore is called
+func (c *Fixtures) Patch() (restore func()) {
+	return mock.Patch(NewStubInfo(), c.mockRoundTrip)
+}
+
+// WithFixtures serves requests with ctx by fixtures
+func WithFixtures(ctx context.Context, fixtures *Fixtures) context.Context {
+	return mock.WithMock(ctx, PKG, OWNER, NAME, fixtures.mockRoundTrip)
+}
+
+// mockRoundTrip serves matched requests, others are sent by the Transport
+func (c *Fixtures) mockRoundTrip(t *Transport, ctx context.Context, req *http.Request) (*http.Response, error) {
+	e, err := c.Match(req)
+	if err != nil {
+		return nil, err
+	}
+	if e == nil {
+		mock.CallOld()
+	}
+	return e.Response.toHTTP(req), nil
+}
+
+// Match returns the first entry matching req, or nil.
+// The body of req is read if needed, and replaced with the same content.
+func (c *Fixtures) Match(req *http.Request) (*Entry, error) {
+	var body []byte
+	bodyRead := false
+	for _, e := range c.entries {
+		if !e.Request.matchNoBody(req) {
+			continue
+		}
+		if e.Request.PostData != nil {
+			if !bodyRead {
+				var err error
+				body, err = readRequestBody(req)
+				if err != nil {
+					return nil, err
+				}
+				bodyRead = true
+			}
+			if !matchBody(e.Request.PostData.Text, body) {
+				continue
+			}
+		}
+		return e, nil
+	}
+	return nil, nil
+}
+
+func (c *Request) matchNoBody(req *http.Request) bool {
+	if c.Method != "" && !strings.EqualFold(c.Method, req.Method) {
+		return false
+	}
+	if c.URL != "" && !matchURL(c.URL, req.URL.String()) {
+		return false
+	}
+	for _, h := range c.Headers {
+		if !containsValue(req.Header[http.CanonicalHeaderKey(h.Name)], h.Value) {
+			return false
+		}
+	}
+	return true
+}
+
+func containsValue(values []string, v string) bool {
+	for _, x := range values {
+		if x == v {
+			return true
+		}
+	}
+	return false
+}
+
+// matchURL matches url against glob with `*`
+func matchURL(glob string, url string) bool {
+	parts := strings.Split(glob, "*")
+	if len(parts) == 1 {
+		return glob == url
+	}
+	if !strings.HasPrefix(url, parts[0]) {
+		return false
+	}
+	url = url[len(parts[0]):]
+	last := parts[len(parts)-1]
+	for _, part := range parts[1 : len(parts)-1] {
+		i := strings.Index(url, part)
+		if i < 0 {
+			return false
+		}
+		url = url[i+len(part):]
+	}
+	return strings.HasSuffix(url, last)
+}
+
+func matchBody(text string, body []byte) bool {
+	var expected interface{}
+	if err := json.Unmarshal([]byte(text), &expected); err != nil {
+		return text == string(body)
+	}
+	var actual interface{}
+	if err := json.Unmarshal(body, &actual); err != nil {
+		return false
+	}
+	return mock.IsJSONSubset(expected, actual)
+}
+
+// readRequestBody reads the body of req, and replaces it with the same content
+func readRequestBody(req *http.Request) ([]byte, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil, nil
+	}
+	body, err := ioutil.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	req.Body = ioutil.NopCloser(bytes.NewReader(body))
+	return body, nil
+}
+
+// readResponseBody reads the body of resp, and replaces it with the same content
+func readResponseBody(resp *http.Response) ([]byte, error) {
+	if resp.Body == nil || resp.Body == http.NoBody {
+		return nil, nil
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+	return body, nil
+}
+
+func (c *Response) toHTTP(req *http.Request) *http.Response {
+	statusText := c.StatusText
+	if statusText == "" {
+		statusText = http.StatusText(c.Status)
+	}
+	header := make(http.Header, len(c.Headers))
+	for _, h := range c.Headers {
+		header.Add(h.Name, h.Value)
+	}
+	var text string
+	if c.Content != nil {
+		text = c.Content.Text
+		if c.Content.MimeType != "" && header.Get("Content-Type") == "" {
+			header.Set("Content-Type", c.Content.MimeType)
+		}
+	}
+	return &http.Response{
+		Status:        strconv.Itoa(c.Status) + " " + statusText,
+		StatusCode:    c.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          ioutil.NopCloser(strings.NewReader(text)),
+		ContentLength: int64(len(text)),
+		Request:       req,
+	}
+}
+
+// newRequest converts req to Request, body is omitted if nil
+func newRequest(req *http.Request, body []byte) *Request {
+	r := &Request{
+		Method:  req.Method,
+		URL:     req.URL.String(),
+		Headers: newHeaders(req.Header),
+	}
+	if body != nil {
+		r.PostData = &PostData{MimeType: req.Header.Get("Content-Type"), Text: string(body)}
+	}
+	return r
+}
+
+// newResponse converts resp to Response, content is omitted if nil
+func newResponse(resp *http.Response, body []byte) *Response {
+	r := &Response{
+		Status:     resp.StatusCode,
+		StatusText: strings.TrimSpace(strings.TrimPrefix(resp.Status, strconv.Itoa(resp.StatusCode))),
+		Headers:    newHeaders(resp.Header),
+	}
+	if body != nil {
+		r.Content = &Content{MimeType: resp.Header.Get("Content-Type"), Text: string(body)}
+	}
+	return r
+}
+
+func newHeaders(header http.Header) []*Header {
+	names := make([]string, 0, len(header))
+	for name := range header {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var headers []*Header
+	for _, name := range names {
+		for _, v := range header[name] {
+			headers = append(headers, &Header{Name: name, Value: v})
+		}
+	}
+	return headers
+}
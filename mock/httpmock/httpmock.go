@@ -0,0 +1,197 @@
+// Package httpmock traps outbound HTTP requests, and serves them
+// from HAR fixture files, or records them into one.
+//
+// Requests are trapped by Transport, which passes them through
+// mock.TrapFunc as function RoundTrip of owner Transport in package
+// net/http, so interceptors, traces and mocks of mock apply to them like
+// to any rewritten function. The net/http package itself is not rewritten:
+// std packages cannot import packages outside std.
+package httpmock
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/xhd2015/go-mock/mock"
+)
+
+const _SKIP_MOCK = true
+
+const (
+	PKG   = "net/http"
+	OWNER = "Transport"
+	NAME  = "RoundTrip"
+)
+
+const (
+	// ENV_FIXTURE_FILE comma separated HAR files serving all requests
+	// of the process, see Fixtures.
+	ENV_FIXTURE_FILE = "GO_MOCK_HTTP_FIXTURE_FILE"
+	// ENV_RECORD_FILE records all requests of the process into the HAR file,
+	// see Recorder.
+	ENV_RECORD_FILE = "GO_MOCK_HTTP_RECORD_FILE"
+)
+
+// the default transport before Install
+var defaultTransport = http.DefaultTransport
+
+// Transport traps requests, then sends them by Base if not mocked.
+// Mock functions have the signature:
+//
+//	func(t *httpmock.Transport, ctx context.Context, req *http.Request) (*http.Response, error)
+type Transport struct {
+	// Base sends requests not mocked, nil means http.DefaultTransport before Install
+	Base http.RoundTripper
+}
+
+var _ http.RoundTripper = (*Transport)(nil)
+
+// RoundTripReq is the req of trapped RoundTrip, as seen by interceptors
+type RoundTripReq struct {
+	Req *http.Request `json:"req"`
+}
+
+// RoundTripResp is the resp of trapped RoundTrip, as seen by interceptors
+type RoundTripResp struct {
+	Resp *http.Response `json:"resp"`
+}
+
+// MarshalJSON serializes Req as a HAR request without body,
+// because *http.Request is not serializable
+func (c RoundTripReq) MarshalJSON() ([]byte, error) {
+	var req *Request
+	if c.Req != nil {
+		req = newRequest(c.Req, nil)
+	}
+	return json.Marshal(struct {
+		Req *Request `json:"req"`
+	}{req})
+}
+
+// MarshalJSON serializes Resp as a HAR response without content
+func (c RoundTripResp) MarshalJSON() ([]byte, error) {
+	var resp *Response
+	if c.Resp != nil {
+		resp = newResponse(c.Resp, nil)
+	}
+	return json.Marshal(struct {
+		Resp *Response `json:"resp"`
+	}{resp})
+}
+
+// NewStubInfo returns the stub of trapped RoundTrip, to be used with mock.Patch
+func NewStubInfo() *mock.StubInfo {
+	return &mock.StubInfo{PkgName: PKG, Owner: OWNER, OwnerPtr: true, Name: NAME}
+}
+
+func isRoundTrip(stubInfo *mock.StubInfo) bool {
+	return stubInfo.PkgName == PKG && stubInfo.Owner == OWNER && stubInfo.Name == NAME
+}
+
+// RoundTrip implements http.RoundTripper
+func (c *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	_mockreq := RoundTripReq{Req: req}
+	var _mockresp RoundTripResp
+	err := mock.TrapFunc(req.Context(), NewStubInfo(), c, &_mockreq, &_mockresp, (*Transport).roundTrip, true, true, true)
+	return _mockresp.Resp, err
+}
+
+func (c *Transport) roundTrip(ctx context.Context, req *http.Request) (*http.Response, error) {
+	base := c.Base
+	if base == nil {
+		base = defaultTransport
+	}
+	return base.RoundTrip(req)
+}
+
+var installMutex sync.Mutex
+
+// Install replaces http.DefaultTransport with a Transport, so requests
+// of http.DefaultClient and clients without Transport are trapped.
+// Clients with their own Transport should wrap it by Transport instead,
+// or be called in packages rewritten with -mock-http, see ClientDo.
+func Install() (restore func()) {
+	installMutex.Lock()
+	defer installMutex.Unlock()
+	prev := http.DefaultTransport
+	http.DefaultTransport = &Transport{Base: prev}
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			installMutex.Lock()
+			defer installMutex.Unlock()
+			http.DefaultTransport = prev
+		})
+	}
+}
+
+// InstallFromEnv installs Transport, with fixtures configured by
+// GO_MOCK_HTTP_FIXTURE_FILE, and recorder configured by GO_MOCK_HTTP_RECORD_FILE,
+// it does nothing if neither is set.
+func InstallFromEnv() (installed bool, err error) {
+	fixtureFiles := strings.TrimSpace(os.Getenv(ENV_FIXTURE_FILE))
+	recordFile := os.Getenv(ENV_RECORD_FILE)
+	if fixtureFiles == "" && recordFile == "" {
+		return false, nil
+	}
+	if fixtureFiles != "" {
+		fixtures, err := LoadFixtures(strings.Split(fixtureFiles, ",")...)
+		if err != nil {
+			return false, err
+		}
+		fixtures.Patch()
+	}
+	if recordFile != "" {
+		NewRecorder(recordFile).Install()
+	}
+	Install()
+	return true, nil
+}
+
+// ClientDo replaces c.Do in packages rewritten with -mock-http,
+// the request is trapped even if c has its own Transport.
+func ClientDo(c *http.Client, req *http.Request) (*http.Response, error) {
+	return trapClient(c).Do(req)
+}
+
+// ClientGet replaces c.Get, see ClientDo
+func ClientGet(c *http.Client, url string) (*http.Response, error) {
+	return trapClient(c).Get(url)
+}
+
+// ClientPost replaces c.Post, see ClientDo
+func ClientPost(c *http.Client, url string, contentType string, body io.Reader) (*http.Response, error) {
+	return trapClient(c).Post(url, contentType, body)
+}
+
+// ClientPostForm replaces c.PostForm, see ClientDo
+func ClientPostForm(c *http.Client, url string, data url.Values) (*http.Response, error) {
+	return trapClient(c).PostForm(url, data)
+}
+
+// ClientHead replaces c.Head, see ClientDo
+func ClientHead(c *http.Client, url string) (*http.Response, error) {
+	return trapClient(c).Head(url)
+}
+
+// trapClient returns c if its transport is trapped already,
+// otherwise a copy of c whose transport is wrapped by Transport
+func trapClient(c *http.Client) *http.Client {
+	rt := c.Transport
+	if rt == nil {
+		rt = http.DefaultTransport
+	}
+	if _, ok := rt.(*Transport); ok {
+		return c
+	}
+	copied := *c
+	copied.Transport = &Transport{Base: rt}
+	return &copied
+}
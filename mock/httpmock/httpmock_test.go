@@ -0,0 +1,267 @@
+package httpmock
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/xhd2015/go-mock/mock"
+)
+
+const testHAR = `{
+  "log": {
+    "entries": [
+      {
+        "request": {
+          "method": "POST",
+          "url": "*/users/*",
+          "headers": [{"name": "x-env", "value": "test"}],
+          "postData": {"text": "{\"type\":\"admin\"}"}
+        },
+        "response": {
+          "status": 201,
+          "content": {"mimeType": "application/json", "text": "{\"id\":1}"}
+        }
+      }
+    ]
+  }
+}`
+
+func newTestServer() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("real " + r.URL.Path))
+	}))
+}
+
+func post(t *testing.T, client *http.Client, url string, env string, body string) (int, string) {
+	req, err := http.NewRequest("POST", url, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("X-Env", env)
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp.StatusCode, string(data)
+}
+
+// go test -run TestFixtures -v ./mock/httpmock
+func TestFixtures(t *testing.T) {
+	server := newTestServer()
+	defer server.Close()
+
+	har, err := ParseHAR([]byte(testHAR))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := WithFixtures(context.Background(), NewFixtures(har))
+	rec := mock.NewRecorder()
+	ctx = mock.WithRecorder(ctx, rec)
+	client := &http.Client{Transport: &Transport{}}
+
+	doPost := func(env string, body string) (int, string) {
+		req, _ := http.NewRequest("POST", server.URL+"/users/1", strings.NewReader(body))
+		req = req.WithContext(ctx)
+		req.Header.Set("X-Env", env)
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		data, _ := ioutil.ReadAll(resp.Body)
+		return resp.StatusCode, string(data)
+	}
+	code, body := doPost("test", `{"type":"admin","name":"a"}`)
+	if code != 201 || body != `{"id":1}` {
+		t.Fatalf("expect %s = %+v, actual:%+v", `code,body`, `201 {"id":1}`, []interface{}{code, body})
+	}
+	// header and body not matched, sent for real
+	code, body = doPost("prod", `{"type":"admin"}`)
+	if code != 200 || body != "real /users/1" {
+		t.Fatalf("expect %s = %+v, actual:%+v", `code,body`, "200 real /users/1", []interface{}{code, body})
+	}
+	code, body = doPost("test", `{"type":"user"}`)
+	if body != "real /users/1" {
+		t.Fatalf("expect %s = %+v, actual:%+v", `body`, "real /users/1", body)
+	}
+
+	calls := rec.Calls(NewStubInfo())
+	if len(calls) != 3 || calls[0].MockStatus != mock.MockStatus_MockResp || calls[1].MockStatus != mock.MockStatus_NormalResp {
+		t.Fatalf("expect %s = %+v, actual:%+v", `calls`, "mock_resp,normal_resp,normal_resp", calls)
+	}
+}
+
+// go test -run TestRecordAndReplay -v ./mock/httpmock
+func TestRecordAndReplay(t *testing.T) {
+	server := newTestServer()
+	dir, err := ioutil.TempDir("", "httpmock")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "record.har")
+
+	restore := Install()
+	defer restore()
+
+	recorder := NewRecorder(file)
+	remove := recorder.Install()
+	_, body := post(t, http.DefaultClient, server.URL+"/a", "test", `{"k":1}`)
+	remove()
+	if body != "real /a" {
+		t.Fatalf("expect %s = %+v, actual:%+v", `body`, "real /a", body)
+	}
+	server.Close()
+
+	fixtures, err := LoadFixtures(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	restorePatch := fixtures.Patch()
+	defer restorePatch()
+	_, body = post(t, http.DefaultClient, server.URL+"/a", "test", `{"k":1}`)
+	if body != "real /a" {
+		t.Fatalf("expect %s = %+v, actual:%+v", `body`, "real /a", body)
+	}
+}
+
+// go test -run TestClientDo -v ./mock/httpmock
+func TestClientDo(t *testing.T) {
+	server := newTestServer()
+	defer server.Close()
+
+	har, err := ParseHAR([]byte(testHAR))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := WithFixtures(context.Background(), NewFixtures(har))
+	// a client with its own transport, not trapped by Install
+	client := &http.Client{Transport: &http.Transport{}}
+
+	req, _ := http.NewRequest("POST", server.URL+"/users/1", strings.NewReader(`{"type":"admin"}`))
+	req = req.WithContext(ctx)
+	req.Header.Set("X-Env", "test")
+	resp, err := ClientDo(client, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != 201 {
+		t.Fatalf("expect %s = %+v, actual:%+v", `code`, 201, resp.StatusCode)
+	}
+	if _, ok := client.Transport.(*http.Transport); !ok {
+		t.Fatalf("expect %s = %+v, actual:%+v", `client.Transport`, "unchanged", client.Transport)
+	}
+
+	// trapped transport is not wrapped again
+	trapped := &http.Client{Transport: &Transport{}}
+	if c := trapClient(trapped); c != trapped {
+		t.Fatalf("expect %s = %+v, actual:%+v", `trapClient(trapped)`, trapped, c)
+	}
+}
+
+// go test -run TestRecorderStream -v ./mock/httpmock
+func TestRecorderStream(t *testing.T) {
+	next := make(chan bool)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.SetCookie(w, &http.Cookie{Name: "session", Value: "secret"})
+		if r.URL.Path == "/large" {
+			w.Write([]byte(strings.Repeat("x", 32)))
+			return
+		}
+		w.Write([]byte("data: 1\n"))
+		w.(http.Flusher).Flush()
+		<-next
+		w.Write([]byte("data: 2\n"))
+	}))
+	defer server.Close()
+	dir, err := ioutil.TempDir("", "httpmock")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "record.har")
+
+	recorder := NewRecorder(file)
+	recorder.MaxBodySize = 16
+	remove := recorder.Install()
+	defer remove()
+	client := &http.Client{Transport: &Transport{}}
+
+	req, _ := http.NewRequest("GET", server.URL+"/events", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the first event arrives before the response ends
+	line := make([]byte, 8)
+	if _, err := io.ReadFull(resp.Body, line); err != nil || string(line) != "data: 1\n" {
+		t.Fatalf("expect %s = %+v, actual:%+v", `line`, "data: 1", []interface{}{string(line), err})
+	}
+	close(next)
+	rest, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(rest) != "data: 2\n" {
+		t.Fatalf("expect %s = %+v, actual:%+v", `rest`, "data: 2", string(rest))
+	}
+
+	// larger than MaxBodySize
+	_, body := post(t, client, server.URL+"/large", "test", `{}`)
+	if body != strings.Repeat("x", 32) {
+		t.Fatalf("expect %s = %+v, actual:%+v", `body`, strings.Repeat("x", 32), body)
+	}
+
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	har, err := ParseHAR(data)
+	if err != nil {
+		t.Fatalf("expect %s = %+v, actual:%+v", `ParseHAR`, "valid", string(data))
+	}
+	if len(har.Log.Entries) != 2 {
+		t.Fatalf("expect %s = %+v, actual:%+v", `entries`, 2, string(data))
+	}
+	if c := har.Log.Entries[0].Response.Content; c == nil || c.Text != "data: 1\ndata: 2\n" {
+		t.Fatalf("expect %s = %+v, actual:%+v", `content`, "data: 1,data: 2", c)
+	}
+	if c := har.Log.Entries[1].Response.Content; c != nil {
+		t.Fatalf("expect %s = %+v, actual:%+v", `large content`, nil, c)
+	}
+	if strings.Contains(string(data), "secret") {
+		t.Fatalf("expect %s = %+v, actual:%+v", `credentials`, "redacted", string(data))
+	}
+}
+
+// go test -run TestMatchURL -v ./mock/httpmock
+func TestMatchURL(t *testing.T) {
+	cases := []struct {
+		glob   string
+		url    string
+		expect bool
+	}{
+		{"https://a.com/users", "https://a.com/users", true},
+		{"https://a.com/users/*", "https://a.com/users/1?x=2", true},
+		{"*/users/*/orders", "https://a.com/users/1/orders", true},
+		{"*/users/*/orders", "https://a.com/users/1/items", false},
+		{"https://a.com/*", "http://a.com/x", false},
+	}
+	for _, c := range cases {
+		if actual := matchURL(c.glob, c.url); actual != c.expect {
+			t.Fatalf("expect %s = %+v, actual:%+v", "matchURL("+c.glob+","+c.url+")", c.expect, actual)
+		}
+	}
+}
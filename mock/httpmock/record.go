@@ -0,0 +1,236 @@
+package httpmock
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/xhd2015/go-mock/mock"
+)
+
+// DefaultRedactHeaders are headers not recorded by default, they carry credentials
+var DefaultRedactHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie"}
+
+// DefaultMaxBodySize is the default Recorder.MaxBodySize
+const DefaultMaxBodySize = 1 << 20
+
+const (
+	harHeader      = "{\n  \"log\": {\n    \"entries\": [\n"
+	harFooter      = "\n    ]\n  }\n}\n"
+	harEntryIndent = "      "
+)
+
+// Recorder records requests sent by Transport, and their responses,
+// as entries of a HAR file, which can be used as fixtures later.
+// Requests are always sent for real while recording, failed
+// requests are not recorded.
+//
+// The response body is passed to the caller as it arrives, and copied
+// while the caller reads it, so streaming responses are not held back.
+// The entry is recorded when the body is read to the end or closed,
+// its content is omitted if the body is not read to the end, or is
+// larger than MaxBodySize.
+//
+// Entries are appended to the file, which is a complete HAR
+// after each entry, even if the process is killed.
+type Recorder struct {
+	// RedactHeaders are headers of requests and responses not recorded,
+	// case-insensitive. nil means DefaultRedactHeaders.
+	RedactHeaders []string
+	// MaxBodySize is the max size of response content recorded,
+	// 0 means DefaultMaxBodySize.
+	MaxBodySize int
+
+	file string
+
+	mutex      sync.Mutex
+	f          *os.File
+	offset     int64 // end of the last entry
+	numEntries int
+}
+
+// NewRecorder creates a recorder writing into file
+func NewRecorder(file string) *Recorder {
+	return &Recorder{file: file}
+}
+
+// Install adds the interceptor of c, until remove is called
+func (c *Recorder) Install() (remove func()) {
+	return mock.AddInterceptor(c.Interceptor).Remove
+}
+
+// Interceptor records RoundTrip of Transport
+func (c *Recorder) Interceptor(ctx context.Context, stubInfo *mock.StubInfo, inst, req, resp interface{}, f mock.Filter, next func(ctx context.Context) error) error {
+	rtReq, ok := req.(*RoundTripReq)
+	if !ok || !isRoundTrip(stubInfo) {
+		return next(ctx)
+	}
+	f.SetForceUseOld(true)
+	reqBody, err := readRequestBody(rtReq.Req)
+	if err != nil {
+		return err
+	}
+	err = next(ctx)
+	rtResp := resp.(*RoundTripResp)
+	if err != nil || rtResp.Resp == nil {
+		return err
+	}
+	e := &Entry{
+		Request:  newRequest(rtReq.Req, reqBody),
+		Response: newResponse(rtResp.Resp, nil),
+	}
+	e.Request.Headers = c.redact(e.Request.Headers)
+	e.Response.Headers = c.redact(e.Response.Headers)
+
+	body := rtResp.Resp.Body
+	if body == nil || body == http.NoBody {
+		c.add(e)
+		return nil
+	}
+	maxSize := c.MaxBodySize
+	if maxSize <= 0 {
+		maxSize = DefaultMaxBodySize
+	}
+	rtResp.Resp.Body = &recordBody{
+		ReadCloser: body,
+		maxSize:    maxSize,
+		done: func(content []byte) {
+			if content != nil {
+				e.Response.Content = &Content{MimeType: rtResp.Resp.Header.Get("Content-Type"), Text: string(content)}
+			}
+			c.add(e)
+		},
+	}
+	return nil
+}
+
+func (c *Recorder) redact(headers []*Header) []*Header {
+	names := c.RedactHeaders
+	if names == nil {
+		names = DefaultRedactHeaders
+	}
+	var res []*Header
+	for _, h := range headers {
+		if !containsFold(names, h.Name) {
+			res = append(res, h)
+		}
+	}
+	return res
+}
+
+func containsFold(list []string, s string) bool {
+	for _, e := range list {
+		if strings.EqualFold(e, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// add appends e to the file, by overwriting the footer
+// of the HAR with e followed by the footer
+func (c *Recorder) add(e *Entry) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	err := c.addLocked(e)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "go-mock: record http: %v\n", err)
+	}
+}
+
+func (c *Recorder) addLocked(e *Entry) error {
+	data, err := json.MarshalIndent(e, harEntryIndent, "  ")
+	if err != nil {
+		return err
+	}
+	if c.f == nil {
+		c.f, err = os.Create(c.file)
+		if err != nil {
+			return err
+		}
+		c.offset = int64(len(harHeader))
+		_, err = c.f.WriteString(harHeader)
+		if err != nil {
+			return err
+		}
+	}
+	var b bytes.Buffer
+	if c.numEntries > 0 {
+		b.WriteString(",\n")
+	}
+	b.WriteString(harEntryIndent)
+	b.Write(data)
+	n := b.Len()
+	b.WriteString(harFooter)
+	_, err = c.f.WriteAt(b.Bytes(), c.offset)
+	if err != nil {
+		return err
+	}
+	c.offset += int64(n)
+	c.numEntries++
+	return nil
+}
+
+// recordBody copies the body while it is read, and calls done
+// once, when the body is read to the end or closed. Close may be
+// called concurrently with Read, to cancel it.
+type recordBody struct {
+	io.ReadCloser
+	maxSize int
+	done    func(content []byte) // content is nil if incomplete
+
+	mutex     sync.Mutex
+	buf       bytes.Buffer
+	truncated bool
+	eof       bool
+	finished  bool
+}
+
+func (c *recordBody) Read(p []byte) (int, error) {
+	n, err := c.ReadCloser.Read(p)
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if n > 0 && !c.truncated && !c.finished {
+		if c.buf.Len()+n > c.maxSize {
+			c.truncated = true
+			c.buf = bytes.Buffer{}
+		} else {
+			c.buf.Write(p[:n])
+		}
+	}
+	if err == io.EOF {
+		c.eof = true
+		c.finishLocked()
+	}
+	return n, err
+}
+
+func (c *recordBody) Close() error {
+	err := c.ReadCloser.Close()
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.finishLocked()
+	return err
+}
+
+func (c *recordBody) finishLocked() {
+	if c.finished {
+		return
+	}
+	c.finished = true
+	var content []byte
+	if c.eof && !c.truncated {
+		content = c.buf.Bytes()
+		if content == nil {
+			content = []byte{}
+		}
+	}
+	c.buf = bytes.Buffer{}
+	c.done(content)
+}
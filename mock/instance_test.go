@@ -0,0 +1,96 @@
+package mock
+
+import (
+	"context"
+	"testing"
+)
+
+// the following simulate a rewritten method
+
+type client struct {
+	name string
+}
+
+var clientGetStub = &StubInfo{PkgName: "test", Owner: "client", OwnerPtr: true, Name: "Get"}
+
+func (c *client) Get(ctx context.Context, key string) (val string, err error) {
+	var _mockreq = struct {
+		Key string `json:"key"`
+	}{Key: key}
+	var _mockresp struct {
+		Val string `json:"val"`
+	}
+	err = TrapFunc(ctx, clientGetStub, c, &_mockreq, &_mockresp, (*client)._mockGet, true, true, true)
+	val = _mockresp.Val
+	return
+}
+func (c *client) _mockGet(ctx context.Context, key string) (val string, err error) {
+	return c.name + ":" + key, nil
+}
+
+// go test -run TestInstanceMock -v ./mock
+func TestInstanceMock(t *testing.T) {
+	primary := &client{name: "primary"}
+	replica := &client{name: "replica"}
+
+	ctx := WithMock(context.Background(), "test", "client", "Get", func(c *client, ctx context.Context, key string) (string, error) {
+		return "type mock", nil
+	})
+	ctx = WithInstanceMock(ctx, "test", "client", replica, "Get", func(c *client, ctx context.Context, key string) (string, error) {
+		return "replica mock", nil
+	})
+
+	if v, _ := primary.Get(ctx, "k"); v != "type mock" {
+		t.Fatalf("expect %s = %+v, actual:%+v", `v`, "type mock", v)
+	}
+	if v, _ := replica.Get(ctx, "k"); v != "replica mock" {
+		t.Fatalf("expect %s = %+v, actual:%+v", `v`, "replica mock", v)
+	}
+	if v, _ := replica.Get(context.Background(), "k"); v != "replica:k" {
+		t.Fatalf("expect %s = %+v, actual:%+v", `v`, "replica:k", v)
+	}
+}
+
+// a value receiver, whose field may hold uncomparable values
+
+type valueClient struct {
+	opts interface{}
+}
+
+var valueClientGetStub = &StubInfo{PkgName: "test", Owner: "valueClient", Name: "Get"}
+
+func (c valueClient) Get(ctx context.Context) (val string, err error) {
+	var _mockreq struct{}
+	var _mockresp struct {
+		Val string `json:"val"`
+	}
+	err = TrapFunc(ctx, valueClientGetStub, c, &_mockreq, &_mockresp, valueClient._mockGet, true, true, true)
+	val = _mockresp.Val
+	return
+}
+func (c valueClient) _mockGet(ctx context.Context) (val string, err error) {
+	return "real", nil
+}
+
+// go test -run TestInstanceMockUncomparable -v ./mock
+func TestInstanceMockUncomparable(t *testing.T) {
+	ctx := WithInstanceMock(context.Background(), "test", "valueClient", valueClient{opts: []string{"a"}}, "Get", func(c valueClient, ctx context.Context) (string, error) {
+		return "mock", nil
+	})
+	if v, err := (valueClient{opts: []string{"a"}}).Get(ctx); err != nil || v != "real" {
+		t.Fatalf("expect %s = %+v, actual:%+v %v", `v`, "real", v, err)
+	}
+	// other owners with the same method name are not affected
+	ctx = WithInstanceMock(context.Background(), "test", "other", valueClient{opts: 1}, "Get", func(c valueClient, ctx context.Context) (string, error) {
+		return "mock", nil
+	})
+	if v, _ := (valueClient{opts: 1}).Get(ctx); v != "real" {
+		t.Fatalf("expect %s = %+v, actual:%+v", `v`, "real", v)
+	}
+	ctx = WithInstanceMock(ctx, "test", "valueClient", valueClient{opts: 1}, "Get", func(c valueClient, ctx context.Context) (string, error) {
+		return "mock", nil
+	})
+	if v, _ := (valueClient{opts: 1}).Get(ctx); v != "mock" {
+		t.Fatalf("expect %s = %+v, actual:%+v", `v`, "mock", v)
+	}
+}
@@ -0,0 +1,141 @@
+package mock
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+// InterceptorHandle identifies an added interceptor
+type InterceptorHandle struct {
+	h        Interceptor
+	priority int
+	seq      int64
+}
+
+// DefaultInterceptorPriority is used by AddInterceptor and WithInterceptor.
+// Interceptors with higher priority are executed first,
+// for the same priority, the last added is executed first.
+const DefaultInterceptorPriority = 0
+
+var interceptorSeq int64
+
+// globalInterceptorMutex serializes writers, readers
+// load the sorted snapshot from globalInterceptors without lock.
+var globalInterceptorMutex sync.Mutex
+var globalInterceptors atomic.Value // []*InterceptorHandle
+
+func newInterceptorHandle(h Interceptor, priority int) *InterceptorHandle {
+	if h == nil {
+		panic(fmt.Errorf("interceptor cannot be nil"))
+	}
+	return &InterceptorHandle{
+		h:        h,
+		priority: priority,
+		seq:      atomic.AddInt64(&interceptorSeq, 1),
+	}
+}
+
+// AddInterceptor add function calling interceptor
+// order: first added interceptor lastly executed
+func AddInterceptor(h Interceptor) *InterceptorHandle {
+	return AddInterceptorWithPriority(h, DefaultInterceptorPriority)
+}
+
+// AddInterceptorWithPriority add a global interceptor,
+// interceptors with higher priority are executed first.
+func AddInterceptorWithPriority(h Interceptor, priority int) *InterceptorHandle {
+	handle := newInterceptorHandle(h, priority)
+	globalInterceptorMutex.Lock()
+	defer globalInterceptorMutex.Unlock()
+	old := loadGlobalInterceptors()
+	list := make([]*InterceptorHandle, 0, len(old)+1)
+	list = append(list, old...)
+	list = append(list, handle)
+	sortInterceptors(list)
+	globalInterceptors.Store(list)
+	return handle
+}
+
+// Remove removes a global interceptor, calls already
+// in progress are not affected.
+// Removing an interceptor twice has no effect.
+func (c *InterceptorHandle) Remove() {
+	globalInterceptorMutex.Lock()
+	defer globalInterceptorMutex.Unlock()
+	old := loadGlobalInterceptors()
+	list := make([]*InterceptorHandle, 0, len(old))
+	for _, e := range old {
+		if e != c {
+			list = append(list, e)
+		}
+	}
+	globalInterceptors.Store(list)
+}
+
+type interceptorKeyType struct{}
+
+var interceptorKey interceptorKeyType
+
+type interceptorNode struct {
+	handle *InterceptorHandle
+	parent *interceptorNode
+}
+
+// WithInterceptor applies h only to calls under the returned context
+func WithInterceptor(ctx context.Context, h Interceptor) context.Context {
+	return WithInterceptorPriority(ctx, h, DefaultInterceptorPriority)
+}
+
+// WithInterceptorPriority is like WithInterceptor, the
+// priority is compared with global interceptors as well.
+func WithInterceptorPriority(ctx context.Context, h Interceptor, priority int) context.Context {
+	handle := newInterceptorHandle(h, priority)
+	parent, _ := ctx.Value(interceptorKey).(*interceptorNode)
+	return context.WithValue(ctx, interceptorKey, &interceptorNode{handle: handle, parent: parent})
+}
+
+func loadGlobalInterceptors() []*InterceptorHandle {
+	list, _ := globalInterceptors.Load().([]*InterceptorHandle)
+	return list
+}
+
+// getInterceptors returns the sorted interceptors applied to ctx,
+// the result must not be modified.
+func getInterceptors(ctx context.Context) []*InterceptorHandle {
+	list := loadGlobalInterceptors()
+	if ctx == nil {
+		return list
+	}
+	node, _ := ctx.Value(interceptorKey).(*interceptorNode)
+	if node == nil {
+		return list
+	}
+	merged := append([]*InterceptorHandle(nil), list...)
+	for ; node != nil; node = node.parent {
+		merged = append(merged, node.handle)
+	}
+	sortInterceptors(merged)
+	return merged
+}
+
+func sortInterceptors(list []*InterceptorHandle) {
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].priority != list[j].priority {
+			return list[i].priority > list[j].priority
+		}
+		return list[i].seq > list[j].seq
+	})
+}
+
+func callInterceptors(list []*InterceptorHandle, i int, ctx context.Context, stubInfo *StubInfo, inst, req, resp interface{}, f Filter, next func(ctx context.Context) error) error {
+	if i >= len(list) {
+		return next(ctx)
+	}
+	return list[i].h(ctx, stubInfo, inst, req, resp, f, func(ctx context.Context) error {
+		// f will remain the same for all next
+		return callInterceptors(list, i+1, ctx, stubInfo, inst, req, resp, f, next)
+	})
+}
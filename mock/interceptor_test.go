@@ -0,0 +1,50 @@
+package mock
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func appendInterceptor(trace *[]string, name string) Interceptor {
+	return func(ctx context.Context, stubInfo *StubInfo, inst, req, resp interface{}, f Filter, next func(ctx context.Context) error) error {
+		*trace = append(*trace, name)
+		return next(ctx)
+	}
+}
+
+// go test -run TestInterceptorOrder -v ./mock
+func TestInterceptorOrder(t *testing.T) {
+	var trace []string
+	h1 := AddInterceptor(appendInterceptor(&trace, "a"))
+	defer h1.Remove()
+	h2 := AddInterceptor(appendInterceptor(&trace, "b"))
+	defer h2.Remove()
+	h3 := AddInterceptorWithPriority(appendInterceptor(&trace, "high"), 10)
+	defer h3.Remove()
+
+	ctx := WithInterceptorPriority(context.Background(), appendInterceptor(&trace, "ctx"), 5)
+	greet(ctx, "a")
+
+	res := strings.Join(trace, ",")
+	if res != "high,ctx,b,a" {
+		t.Fatalf("expect %s = %+v, actual:%+v", `trace`, "high,ctx,b,a", res)
+	}
+}
+
+// go test -run TestInterceptorRemove -v ./mock
+func TestInterceptorRemove(t *testing.T) {
+	var trace []string
+	h := AddInterceptor(appendInterceptor(&trace, "a"))
+	add(1, 2)
+	h.Remove()
+	h.Remove()
+	add(1, 2)
+
+	// ctx interceptor does not apply to calls without ctx
+	WithInterceptor(context.Background(), appendInterceptor(&trace, "ctx"))
+	add(1, 2)
+	if len(trace) != 1 {
+		t.Fatalf("expect %s = %+v, actual:%+v", `len(trace)`, 1, trace)
+	}
+}
@@ -0,0 +1,127 @@
+package mock
+
+import (
+	"bytes"
+	"context"
+	"runtime"
+	"strconv"
+	"sync"
+)
+
+// goroutine local context makes mocks available to calls without ctx,
+// or with nil ctx. It is set by Setup, and copied into child goroutines
+// by rewritten go statements, see RewriteOptions.PropagateGo.
+// Entries are keyed by goroutine id, which is never reused, so each
+// association must be undone: RestoreLocal after Setup, ClearLocalContext
+// after SetLocalContext, or scoped by WithLocal.
+
+var localMutex sync.RWMutex
+var localContexts = make(map[int64]context.Context)
+
+// SetLocalContext associates ctx with current goroutine, calls trapped
+// with nil ctx in this goroutine use it. nil ctx clears the association.
+func SetLocalContext(ctx context.Context) {
+	swapLocal(goroutineID(), ctx)
+}
+
+// localRestoreKey holds the association replaced by SetupLocal
+type localRestoreKey struct{}
+
+type localRestore struct {
+	id      int64
+	prev    context.Context
+	hasPrev bool
+}
+
+// SetupLocal associates ctx with current goroutine, the returned ctx
+// remembers the previous association, which RestoreLocal brings back.
+// This is not meant to be called by the user, but by Setup.
+func SetupLocal(ctx context.Context) context.Context {
+	if ctx == nil {
+		return nil
+	}
+	r := &localRestore{id: goroutineID()}
+	ctx = context.WithValue(ctx, localRestoreKey{}, r)
+	r.prev, r.hasPrev = swapLocal(r.id, ctx)
+	return ctx
+}
+
+// RestoreLocal undoes the association made by the Setup returning ctx,
+// restoring the previous one of that goroutine. Tests should defer it:
+//
+//	ctx = mock_biz.Setup(ctx, ...)
+//	defer mock.RestoreLocal(ctx)
+func RestoreLocal(ctx context.Context) {
+	if ctx == nil {
+		return
+	}
+	r, _ := ctx.Value(localRestoreKey{}).(*localRestore)
+	if r == nil {
+		return
+	}
+	restoreLocal(r.id, r.prev, r.hasPrev)
+}
+
+// WithLocal associates ctx with current goroutine while fn runs, so
+// trapped calls without ctx, or with nil ctx, in fn use ctx.
+// The previous association is restored when fn returns.
+func WithLocal(ctx context.Context, fn func()) {
+	id := goroutineID()
+	prev, hasPrev := swapLocal(id, ctx)
+	defer restoreLocal(id, prev, hasPrev)
+	fn()
+}
+
+// swapLocal sets ctx of goroutine id, returning the previous one
+func swapLocal(id int64, ctx context.Context) (prev context.Context, hasPrev bool) {
+	localMutex.Lock()
+	defer localMutex.Unlock()
+	prev, hasPrev = localContexts[id]
+	if ctx == nil {
+		delete(localContexts, id)
+	} else {
+		localContexts[id] = ctx
+	}
+	return
+}
+
+func restoreLocal(id int64, prev context.Context, hasPrev bool) {
+	if !hasPrev {
+		prev = nil
+	}
+	swapLocal(id, prev)
+}
+
+// GetLocalContext returns ctx associated with current goroutine, or nil.
+func GetLocalContext() context.Context {
+	localMutex.RLock()
+	defer localMutex.RUnlock()
+	// avoid parsing stack, trapped calls without ctx always get here
+	if len(localContexts) == 0 {
+		return nil
+	}
+	return localContexts[goroutineID()]
+}
+
+// ClearLocalContext removes ctx associated with current goroutine,
+// goroutines that called SetLocalContext should clear it before exit.
+func ClearLocalContext() {
+	SetLocalContext(nil)
+}
+
+var goroutinePrefix = []byte("goroutine ")
+
+// goroutineID parses id from the first line of stack: `goroutine 18 [running]:`
+func goroutineID() int64 {
+	var buf [64]byte
+	b := buf[:runtime.Stack(buf[:], false)]
+	b = bytes.TrimPrefix(b, goroutinePrefix)
+	if i := bytes.IndexByte(b, ' '); i > 0 {
+		b = b[:i]
+	}
+	id, err := strconv.ParseInt(string(b), 10, 64)
+	if err != nil {
+		panic(err)
+	}
+	return id
+}
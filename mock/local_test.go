@@ -0,0 +1,85 @@
+package mock
+
+import (
+	"context"
+	"testing"
+)
+
+// go test -run TestLocalContext -v ./mock
+func TestLocalContext(t *testing.T) {
+	defer ClearLocalContext()
+	ctx := WithMock(context.Background(), "test", "", "Greet", func(ctx context.Context, name string) (string, error) {
+		return "local " + name, nil
+	})
+	SetLocalContext(ctx)
+	if GetLocalContext() != ctx {
+		t.Fatalf("expect %s = %+v, actual:%+v", `GetLocalContext()`, ctx, GetLocalContext())
+	}
+	// nil ctx falls back to local
+	s, _ := greet(nil, "a")
+	if s != "local a" {
+		t.Fatalf("expect %s = %+v, actual:%+v", `s`, "local a", s)
+	}
+
+	// other goroutines are not affected
+	done := make(chan string)
+	go func() {
+		s, _ := greet(nil, "b")
+		done <- s
+	}()
+	if s := <-done; s != "hello b" {
+		t.Fatalf("expect %s = %+v, actual:%+v", `s`, "hello b", s)
+	}
+
+	ClearLocalContext()
+	if GetLocalContext() != nil {
+		t.Fatalf("expect %s = %+v, actual:%+v", `GetLocalContext()`, nil, GetLocalContext())
+	}
+}
+
+// go test -run TestWithLocal -v ./mock
+func TestWithLocal(t *testing.T) {
+	outer := WithMock(context.Background(), "test", "", "Greet", func(ctx context.Context, name string) (string, error) {
+		return "outer " + name, nil
+	})
+	inner := WithMock(context.Background(), "test", "", "Greet", func(ctx context.Context, name string) (string, error) {
+		return "inner " + name, nil
+	})
+	WithLocal(outer, func() {
+		WithLocal(inner, func() {
+			if s, _ := greet(nil, "a"); s != "inner a" {
+				t.Fatalf("expect %s = %+v, actual:%+v", `s`, "inner a", s)
+			}
+		})
+		// restored after inner returns
+		if s, _ := greet(nil, "a"); s != "outer a" {
+			t.Fatalf("expect %s = %+v, actual:%+v", `s`, "outer a", s)
+		}
+	})
+	if GetLocalContext() != nil {
+		t.Fatalf("expect %s = %+v, actual:%+v", `GetLocalContext()`, nil, GetLocalContext())
+	}
+
+}
+
+// go test -run TestSetupLocal -v ./mock
+func TestSetupLocal(t *testing.T) {
+	outer := WithMockSetup(context.Background(), "test", struct{}{})
+	if GetLocalContext() != outer {
+		t.Fatalf("expect %s = %+v, actual:%+v", `GetLocalContext()`, outer, GetLocalContext())
+	}
+	inner := WithMockSetup(outer, "test", struct{}{})
+	if GetLocalContext() != inner {
+		t.Fatalf("expect %s = %+v, actual:%+v", `GetLocalContext()`, inner, GetLocalContext())
+	}
+
+	// restored in reverse order
+	RestoreLocal(inner)
+	if GetLocalContext() != outer {
+		t.Fatalf("expect %s = %+v, actual:%+v", `GetLocalContext()`, outer, GetLocalContext())
+	}
+	RestoreLocal(outer)
+	if GetLocalContext() != nil {
+		t.Fatalf("expect %s = %+v, actual:%+v", `GetLocalContext()`, nil, GetLocalContext())
+	}
+}
@@ -32,20 +32,20 @@ type StubInfo struct {
 	Owner    string
 	OwnerPtr bool
 	Name     string
+	// TypeArgs type arguments of generic function, or of the
+	// receiver type for methods of generic type, nil if not generic.
+	TypeArgs []reflect.Type
 }
 
 func (c *StubInfo) String() string {
+	if c.Owner == "" {
+		return fmt.Sprintf("%s.%s%s", c.PkgName, c.Name, c.TypeArgsString())
+	}
 	ownerPrefix := ""
-	owner := ""
-	ownerCC := ""
-	if c.Owner != "" {
-		owner = c.Owner
-		ownerCC = "."
-		if c.OwnerPtr {
-			ownerPrefix = "*"
-		}
+	if c.OwnerPtr {
+		ownerPrefix = "*"
 	}
-	return fmt.Sprintf("%s%s%s%s.%s", c.PkgName, ownerCC, ownerPrefix, owner, c.Name)
+	return fmt.Sprintf("%s.%s%s%s.%s", c.PkgName, ownerPrefix, c.Owner, c.TypeArgsString(), c.Name)
 }
 
 type Filter interface {
@@ -56,12 +56,37 @@ type Filter interface {
 	SetForceUseOld(force bool)
 }
 
+// FaultFilter is implemented by the Filter passed to interceptors,
+// to inject faults, interceptors get it by type assertion:
+//
+//	if ff, ok := f.(mock.FaultFilter); ok {
+//		ff.SetMockError(err)
+//	}
+type FaultFilter interface {
+	// MockError if set, the call returns the error without
+	// calling mock or the original function. Ignored by
+	// functions without error result.
+	MockError() error
+	SetMockError(err error)
+
+	// MockPanic if set, the call panics with the value without
+	// calling mock or the original function.
+	MockPanic() interface{}
+	SetMockPanic(v interface{})
+}
+
+var _ FaultFilter = (*filter)(nil)
+
 type Interceptor func(ctx context.Context, stubInfo *StubInfo, inst interface{}, req interface{}, resp interface{}, f Filter, next func(ctx context.Context) error) error
 
 // GetContext defines extension point where
 // when Trap encounters nil context, user can
 // to get a context.
+// By default it falls back to the goroutine local context set by Setup.
 var GetContext = func(ctx context.Context) context.Context {
+	if ctx == nil {
+		return GetLocalContext()
+	}
 	return ctx
 }
 
@@ -70,6 +95,27 @@ type fnMockKey struct {
 	pkg   string
 	owner string
 	name  string
+	// typeArgs identifies an instantiation of generic function
+	typeArgs string
+}
+
+// stubKey identifies a function by all fields of StubInfo
+type stubKey struct {
+	pkg      string
+	owner    string
+	ownerPtr bool
+	name     string
+	typeArgs string
+}
+
+func newStubKey(stubInfo *StubInfo) stubKey {
+	return stubKey{
+		pkg:      stubInfo.PkgName,
+		owner:    stubInfo.Owner,
+		ownerPtr: stubInfo.OwnerPtr,
+		name:     stubInfo.Name,
+		typeArgs: typeArgsKey(stubInfo.TypeArgs),
+	}
 }
 
 // WithMock inject mock into the context
@@ -80,11 +126,54 @@ func WithMock(ctx context.Context, pkg string, owner string, name string, fn int
 	return context.WithValue(ctx, fnMockKey{pkg: pkg, owner: owner, name: name}, fn)
 }
 
+// instMockKey identifies a method of a specific receiver
+type instMockKey struct {
+	pkg   string
+	owner string
+	inst  interface{}
+	name  string
+}
+
+// WithInstanceMock inject mock of inst's method into the context,
+// other receivers of the same type are not affected.
+// inst is the receiver passed to TrapFunc, for pointer receivers
+// it is matched by pointer identity, for value receivers by value.
+// Values holding slices, maps or functions in interface fields
+// cannot be compared, they never match.
+func WithInstanceMock(ctx context.Context, pkg string, owner string, inst interface{}, name string, fn interface{}) context.Context {
+	if fn == nil {
+		panic(fmt.Errorf("fn cannot be nil"))
+	}
+	if inst == nil {
+		panic(fmt.Errorf("inst cannot be nil"))
+	}
+	if !reflect.TypeOf(inst).Comparable() {
+		panic(fmt.Errorf("inst must be comparable, found:%T", inst))
+	}
+	return context.WithValue(ctx, instMockKey{pkg: pkg, owner: owner, inst: inst, name: name}, fn)
+}
+
+// getInstanceFunc get instance mock from ctx
+func getInstanceFunc(ctx context.Context, stubInfo *StubInfo, inst interface{}) (fn interface{}) {
+	if ctx == nil || inst == nil || !reflect.TypeOf(inst).Comparable() {
+		return nil
+	}
+	defer func() {
+		// comparing interface fields holding uncomparable values panics
+		if e := recover(); e != nil {
+			fn = nil
+		}
+	}()
+	return ctx.Value(instMockKey{pkg: stubInfo.PkgName, owner: stubInfo.Owner, inst: inst, name: stubInfo.Name})
+}
+
 // WithMockSetup traverse the object to register all functions,
 // the traversing order is not guranteed to be the same with assign order,
+// The returned ctx is also associated with current goroutine, until
+// RestoreLocal is called with it.
 // This is not meant to be called by the user, but by the generated stub file.
 func WithMockSetup(ctx context.Context, pkg string, obj interface{}) context.Context {
-	return withMockSetup(ctx, pkg, obj)
+	return SetupLocal(withMockSetup(ctx, pkg, obj))
 }
 
 // GetMock get mock from ctx
@@ -93,18 +182,13 @@ func GetMock(ctx context.Context, stubInfo *StubInfo, inst interface{}, req inte
 	return getMock(ctx, stubInfo, inst, req, resp)
 }
 
-// getFunc get functional mock from ctx
-func getFunc(ctx context.Context, pkg string, owner string, name string) interface{} {
+// getFunc get functional mock from ctx,
+// generic functions only get mocks of the same instantiation.
+func getFunc(ctx context.Context, stubInfo *StubInfo) interface{} {
 	if ctx == nil {
 		return nil
 	}
-	return ctx.Value(fnMockKey{pkg: pkg, owner: owner, name: name})
-}
-
-// AddInterceptor add function calling interceptor
-// order: first added interceptor lastly executed
-func AddInterceptor(h Interceptor) {
-	addInterceptor(h)
+	return ctx.Value(fnMockKey{pkg: stubInfo.PkgName, owner: stubInfo.Owner, name: stubInfo.Name, typeArgs: typeArgsKey(stubInfo.TypeArgs)})
 }
 
 // TrapFunc provides trap to function, req and resp have their special format.
@@ -131,30 +215,23 @@ func CallOld() {
 	panic(errCallOld)
 }
 
-var interceptors []Interceptor
-
-var combinedInterceptor Interceptor
-
-// first added interceptor last executed
-func addInterceptor(h Interceptor) {
-	if h == nil {
-		panic(fmt.Errorf("interceptor cannot be nil"))
-	}
-	interceptors = append(interceptors, h)
-	last := combinedInterceptor
-	if last == nil {
-		combinedInterceptor = h
-	} else {
-		combinedInterceptor = func(ctx context.Context, stubInfo *StubInfo, inst, req, resp interface{}, f Filter, next func(ctx context.Context) error) error {
-			return h(ctx, stubInfo, inst, req, resp, f, func(ctx context.Context) error {
-				return last(ctx, stubInfo, inst, req, resp, f, next) // f will remain the same for all next
-			})
-		}
+func trapFunc(ctx context.Context, stubInfo *StubInfo, inst interface{}, req interface{}, resp interface{}, oldFunc interface{}, hasRecv bool, firstIsCtx bool, lastIsErr bool, needProcessArgs bool) (trapErr error) {
+	ctx = GetContext(ctx)
+	if len(stubInfo.TypeArgs) > 0 {
+		registerInstantiation(stubInfo, inst, req, resp, firstIsCtx, lastIsErr)
 	}
-}
 
-func trapFunc(ctx context.Context, stubInfo *StubInfo, inst interface{}, req interface{}, resp interface{}, oldFunc interface{}, hasRecv bool, firstIsCtx bool, lastIsErr bool, needProcessArgs bool) error {
-	ctx = GetContext(ctx)
+	var rec *callRecording
+	if recorders := getRecorders(ctx); len(recorders) > 0 {
+		rec = startRecording(recorders, stubInfo, inst, req)
+		defer func() {
+			panicErr := recover()
+			rec.finish(resp, trapErr, panicErr)
+			if panicErr != nil {
+				panic(panicErr)
+			}
+		}()
+	}
 
 	f := &filter{}
 	fn := func(ctx context.Context, logger Logger) (err error) {
@@ -166,7 +243,11 @@ func trapFunc(ctx context.Context, stubInfo *StubInfo, inst interface{}, req int
 		//  - mock panic
 		// nevertheless, the panic should be thrown out in any condition.
 		shouldCatchPanic := true
-		if f.NeedTrace() && logger != nil {
+		needLog := f.NeedTrace() && logger != nil
+		if needLog {
+			logger.SetRequest(req)
+		}
+		if needLog || rec != nil {
 			defer func() {
 				var panicErr interface{}
 				if shouldCatchPanic {
@@ -185,16 +266,33 @@ func trapFunc(ctx context.Context, stubInfo *StubInfo, inst interface{}, req int
 						}
 					}
 				}
-				// end the tracing span.
-				logger.SetMockStatus(status)
-				logger.SetIsPanic(isPanic)
-				logger.SetError(err)
-				logger.SetResp(resp)
+				if rec != nil {
+					rec.resolve(status, isPanic)
+				}
+				if needLog {
+					// end the tracing span.
+					logger.SetMockStatus(status)
+					logger.SetIsPanic(isPanic)
+					logger.SetError(err)
+					logger.SetResp(resp)
+				}
 				if panicErr != nil {
 					panic(panicErr)
 				}
 			}()
 		}
+		if p := f.MockPanic(); p != nil {
+			// caught by the deferred func above
+			status = MockStatus_MockError
+			panic(p)
+		}
+		// the error cannot be returned by functions without error result,
+		// so they run as normal
+		if mockErr := f.MockError(); mockErr != nil && lastIsErr {
+			shouldCatchPanic = false
+			status = MockStatus_MockError
+			return mockErr
+		}
 		if !f.IsForceUseOld() {
 			var mockFn interface{}
 			var mockResp bool
@@ -246,11 +344,11 @@ func trapFunc(ctx context.Context, stubInfo *StubInfo, inst interface{}, req int
 		return WithTrace(ctx, stubInfo, inst, req, fn)
 	}
 
-	if combinedInterceptor == nil {
+	interceptors := getInterceptors(ctx)
+	if len(interceptors) == 0 {
 		return processor(ctx)
 	}
-
-	return combinedInterceptor(ctx, stubInfo, inst, req, resp, f, processor)
+	return callInterceptors(interceptors, 0, ctx, stubInfo, inst, req, resp, f, processor)
 }
 
 func callImplFunc(ctx context.Context, fn interface{}, req interface{}, resp interface{}, inst interface{}, hasRecv bool, firstIsCtx bool, lastIsErr bool, needProcessArgs bool) error {
@@ -267,7 +365,12 @@ func callImplFunc(ctx context.Context, fn interface{}, req interface{}, resp int
 		args = append(args, reflect.ValueOf(inst))
 	}
 	if firstIsCtx {
-		args = append(args, reflect.ValueOf(ctx))
+		if ctx == nil {
+			// reflect.ValueOf(nil) is invalid
+			args = append(args, reflect.Zero(ctxType))
+		} else {
+			args = append(args, reflect.ValueOf(ctx))
+		}
 	}
 	if needProcessArgs {
 		args = append(args, structToValues(req)...)
@@ -296,6 +399,8 @@ func callImplFunc(ctx context.Context, fn interface{}, req interface{}, resp int
 	return nil
 }
 
+var ctxType = reflect.TypeOf((*context.Context)(nil)).Elem()
+
 func structToValues(s interface{}) []reflect.Value {
 	v := reflect.ValueOf(s).Elem()
 	if v.Kind() != reflect.Struct {
@@ -363,14 +468,37 @@ func traverseMock(obj interface{}, callback func(owner string, name string, fn i
 // getMock supports json and functional mock.
 func getMock(ctx context.Context, stubInfo *StubInfo, inst interface{}, req interface{}, resp interface{}) (fn interface{}, mockResp bool, mockErr error) {
 	ctx = GetContext(ctx)
-	fn = getFunc(ctx, stubInfo.PkgName, stubInfo.Owner, stubInfo.Name)
-	// if fn is nil,then no mock
+	fn = getInstanceFunc(ctx, stubInfo, inst)
+	if fn != nil {
+		return
+	}
+	fn = getFunc(ctx, stubInfo)
+	if fn != nil {
+		return
+	}
+	mockResp, mockErr = getExpectation(ctx, stubInfo, req, resp)
+	if mockResp || mockErr != nil {
+		return
+	}
+	mockResp, mockErr = getCtxPatternMock(ctx, stubInfo, inst, req, resp)
+	if mockResp {
+		return
+	}
+	// fallback to process-wide patches
+	fn = getPatch(stubInfo)
+	if fn != nil {
+		return
+	}
+	mockResp, mockErr = getGlobalPatternMock(ctx, stubInfo, inst, req, resp)
+	// if nothing found,then no mock
 	return
 }
 
 type filter struct {
 	noNeedTrace bool
 	forceUseOld bool
+	mockErr     error
+	mockPanic   interface{}
 }
 
 func (c *filter) NeedTrace() bool {
@@ -385,6 +513,18 @@ func (c *filter) IsForceUseOld() bool {
 func (c *filter) SetForceUseOld(force bool) {
 	c.forceUseOld = force
 }
+func (c *filter) MockError() error {
+	return c.mockErr
+}
+func (c *filter) SetMockError(err error) {
+	c.mockErr = err
+}
+func (c *filter) MockPanic() interface{} {
+	return c.mockPanic
+}
+func (c *filter) SetMockPanic(v interface{}) {
+	c.mockPanic = v
+}
 
 var errCallOld = errors.New("mock: call back to old")
 
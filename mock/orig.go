@@ -0,0 +1,113 @@
+package mock
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// original functions are the bodies of rewritten functions without trap,
+// calling them never reaches mocks, so a mock can call through with
+// modified arguments, and alter the real results.
+
+type origKey struct {
+	pkg   string
+	owner string
+	name  string
+}
+
+var origMutex sync.RWMutex
+var origFuncs = make(map[origKey]interface{})
+
+// RegisterOrigFunc registers the original function of a rewritten function,
+// methods take receiver as the first argument.
+// This is not meant to be called by the user, but by the rewritten code.
+func RegisterOrigFunc(pkg string, owner string, name string, fn interface{}) {
+	if fn == nil {
+		panic(fmt.Errorf("fn cannot be nil"))
+	}
+	origMutex.Lock()
+	defer origMutex.Unlock()
+	origFuncs[origKey{pkg: pkg, owner: owner, name: name}] = fn
+}
+
+// GetOrigFunc returns the original function registered by RegisterOrigFunc,
+// or nil if not rewritten.
+func GetOrigFunc(pkg string, owner string, name string) interface{} {
+	origMutex.RLock()
+	defer origMutex.RUnlock()
+	return origFuncs[origKey{pkg: pkg, owner: owner, name: name}]
+}
+
+// SetupOrig fills func fields of orig, a pointer to a struct of the same
+// layout as M of a mock stub, with original functions of pkg.
+// Fields whose function is not rewritten are left nil.
+// Receivers declared as interface{} are converted to the real receiver.
+func SetupOrig(pkg string, orig interface{}) {
+	v := reflect.ValueOf(orig)
+	if v.Kind() != reflect.Ptr || v.Elem().Kind() != reflect.Struct {
+		panic(fmt.Errorf("orig must be pointer to struct,actual:%T", orig))
+	}
+	var doSetup func(x reflect.Value, owner string, depth int)
+	doSetup = func(x reflect.Value, owner string, depth int) {
+		for i := 0; i < x.NumField(); i++ {
+			f := x.Field(i)
+			name := strings.TrimPrefix(x.Type().Field(i).Name, "M_")
+			if f.Kind() != reflect.Func {
+				if f.Kind() == reflect.Struct && depth == 0 {
+					doSetup(f, name, depth+1)
+				}
+				continue
+			}
+			fn := GetOrigFunc(pkg, owner, name)
+			if fn == nil {
+				continue
+			}
+			fv := adaptFunc(reflect.ValueOf(fn), f.Type())
+			if fv.IsValid() {
+				f.Set(fv)
+			}
+		}
+	}
+	doSetup(v.Elem(), "", 0)
+}
+
+// adaptFunc returns fn as type t, interface{} params of t are
+// asserted to params of fn. Returns invalid value if not compatible.
+func adaptFunc(fn reflect.Value, t reflect.Type) reflect.Value {
+	ft := fn.Type()
+	if ft.AssignableTo(t) {
+		return fn
+	}
+	if ft.NumIn() != t.NumIn() || ft.NumOut() != t.NumOut() || ft.IsVariadic() != t.IsVariadic() {
+		return reflect.Value{}
+	}
+	for i := 0; i < t.NumOut(); i++ {
+		if !ft.Out(i).AssignableTo(t.Out(i)) {
+			return reflect.Value{}
+		}
+	}
+	for i := 0; i < t.NumIn(); i++ {
+		if !t.In(i).AssignableTo(ft.In(i)) && t.In(i).Kind() != reflect.Interface {
+			return reflect.Value{}
+		}
+	}
+	return reflect.MakeFunc(t, func(args []reflect.Value) []reflect.Value {
+		in := make([]reflect.Value, len(args))
+		for i, arg := range args {
+			if !arg.Type().AssignableTo(ft.In(i)) {
+				if arg.IsNil() {
+					arg = reflect.Zero(ft.In(i))
+				} else {
+					arg = arg.Elem()
+				}
+			}
+			in[i] = arg
+		}
+		if ft.IsVariadic() {
+			return fn.CallSlice(in)
+		}
+		return fn.Call(in)
+	})
+}
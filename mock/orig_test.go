@@ -0,0 +1,55 @@
+package mock
+
+import (
+	"context"
+	"testing"
+)
+
+type counter struct {
+	n int
+}
+
+func _mockcounter_Add(c *counter, delta int) int {
+	c.n += delta
+	return c.n
+}
+
+// like M of a mock stub
+type origM struct {
+	Greet     func(ctx context.Context, name string) (s string, err error)
+	M_counter struct {
+		Add func(c interface{}, delta int) int
+	}
+	Missing func()
+}
+
+// go test -run TestSetupOrig -v ./mock
+func TestSetupOrig(t *testing.T) {
+	RegisterOrigFunc("test", "", "Greet", _mockgreet)
+	RegisterOrigFunc("test", "counter", "Add", _mockcounter_Add)
+
+	var orig origM
+	SetupOrig("test", &orig)
+	if orig.Missing != nil {
+		t.Fatalf("expect %s = %+v, actual:%+v", `orig.Missing`, nil, "non-nil")
+	}
+	c := &counter{}
+	if n := orig.M_counter.Add(c, 2); n != 2 {
+		t.Fatalf("expect %s = %+v, actual:%+v", `n`, 2, n)
+	}
+
+	// spy: call through with modified args, then alter results
+	ctx := WithMockSetup(context.Background(), "test", origM{
+		Greet: func(ctx context.Context, name string) (string, error) {
+			s, err := orig.Greet(ctx, "spy "+name)
+			return s + "!", err
+		},
+	})
+	s, err := greet(ctx, "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s != "hello spy a!" {
+		t.Fatalf("expect %s = %+v, actual:%+v", `s`, "hello spy a!", s)
+	}
+}
@@ -0,0 +1,79 @@
+package mock
+
+import (
+	"fmt"
+	"sync"
+)
+
+type patchEntry struct {
+	fn interface{}
+}
+
+// patches records process-wide replacements,
+// the last patched entry wins.
+var patchMutex sync.RWMutex
+var patches = make(map[stubKey][]*patchEntry)
+
+// Patch replaces the function identified by stub
+// for all calls in the process, no matter whether
+// a context is given or not.
+// fn has the same signature as the field in the generated
+// M struct, i.e. receiver(if any) comes as the first argument.
+// Calling restore removes the patch, it is safe to call
+// restore multiple times and in any order.
+// Mocks injected into ctx take precedence over patches.
+func Patch(stub *StubInfo, fn interface{}) (restore func()) {
+	if stub == nil {
+		panic(fmt.Errorf("stub cannot be nil"))
+	}
+	if fn == nil {
+		panic(fmt.Errorf("fn cannot be nil"))
+	}
+	key := newStubKey(stub)
+	entry := &patchEntry{fn: fn}
+
+	patchMutex.Lock()
+	patches[key] = append(patches[key], entry)
+	patchMutex.Unlock()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			removePatch(key, entry)
+		})
+	}
+}
+
+func removePatch(key stubKey, entry *patchEntry) {
+	patchMutex.Lock()
+	defer patchMutex.Unlock()
+	list := patches[key]
+	for i, e := range list {
+		if e != entry {
+			continue
+		}
+		newList := make([]*patchEntry, 0, len(list)-1)
+		newList = append(newList, list[:i]...)
+		newList = append(newList, list[i+1:]...)
+		if len(newList) == 0 {
+			delete(patches, key)
+		} else {
+			patches[key] = newList
+		}
+		return
+	}
+}
+
+// getPatch get the latest patched function
+func getPatch(stubInfo *StubInfo) interface{} {
+	patchMutex.RLock()
+	defer patchMutex.RUnlock()
+	if len(patches) == 0 {
+		return nil
+	}
+	list := patches[newStubKey(stubInfo)]
+	if len(list) == 0 {
+		return nil
+	}
+	return list[len(list)-1].fn
+}
@@ -0,0 +1,103 @@
+package mock
+
+import (
+	"context"
+	"testing"
+)
+
+// the following functions simulate the rewritten code
+
+var addStub = &StubInfo{PkgName: "test", Name: "Add"}
+
+func add(a int, b int) (r int) {
+	var _mockreq = struct {
+		A int `json:"a"`
+		B int `json:"b"`
+	}{A: a, B: b}
+	var _mockresp struct {
+		R int `json:"r"`
+	}
+	TrapFunc(nil, addStub, nil, &_mockreq, &_mockresp, _mockadd, false, false, false)
+	r = _mockresp.R
+	return
+}
+func _mockadd(a int, b int) (r int) {
+	return a + b
+}
+
+var greetStub = &StubInfo{PkgName: "test", Name: "Greet"}
+
+func greet(ctx context.Context, name string) (s string, err error) {
+	var _mockreq = struct {
+		Name string `json:"name"`
+	}{Name: name}
+	var _mockresp struct {
+		S string `json:"s"`
+	}
+	err = TrapFunc(ctx, greetStub, nil, &_mockreq, &_mockresp, _mockgreet, false, true, true)
+	s = _mockresp.S
+	return
+}
+func _mockgreet(ctx context.Context, name string) (s string, err error) {
+	return "hello " + name, nil
+}
+
+// go test -run TestPatchNoCtx -v ./mock
+func TestPatchNoCtx(t *testing.T) {
+	restore := Patch(addStub, func(a int, b int) int {
+		return a * b
+	})
+	r := add(2, 3)
+	if r != 6 {
+		t.Fatalf("expect %s = %+v, actual:%+v", `r`, 6, r)
+	}
+	restore()
+	restore() // repeated restore is ok
+
+	r = add(2, 3)
+	if r != 5 {
+		t.Fatalf("expect %s = %+v, actual:%+v", `r`, 5, r)
+	}
+}
+
+// go test -run TestPatchNested -v ./mock
+func TestPatchNested(t *testing.T) {
+	restore1 := Patch(addStub, func(a int, b int) int {
+		return 1
+	})
+	restore2 := Patch(addStub, func(a int, b int) int {
+		return 2
+	})
+	if r := add(0, 0); r != 2 {
+		t.Fatalf("expect %s = %+v, actual:%+v", `r`, 2, r)
+	}
+	// restore out of order
+	restore1()
+	if r := add(0, 0); r != 2 {
+		t.Fatalf("expect %s = %+v, actual:%+v", `r`, 2, r)
+	}
+	restore2()
+	if r := add(1, 1); r != 2 {
+		t.Fatalf("expect %s = %+v, actual:%+v", `r`, 2, r)
+	}
+}
+
+// go test -run TestPatchCtxPrecedence -v ./mock
+func TestPatchCtxPrecedence(t *testing.T) {
+	defer Patch(greetStub, func(ctx context.Context, name string) (string, error) {
+		return "patch " + name, nil
+	})()
+
+	s, _ := greet(nil, "a")
+	if s != "patch a" {
+		t.Fatalf("expect %s = %+v, actual:%+v", `s`, "patch a", s)
+	}
+
+	ctx := WithMock(context.Background(), "test", "", "Greet", func(ctx context.Context, name string) (string, error) {
+		return "ctx " + name, nil
+	})
+	s, _ = greet(ctx, "b")
+	if s != "ctx b" {
+		t.Fatalf("expect %s = %+v, actual:%+v", `s`, "ctx b", s)
+	}
+}
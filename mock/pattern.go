@@ -0,0 +1,214 @@
+package mock
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// DynamicCall is a generic view of a trapped call
+type DynamicCall struct {
+	Stub *StubInfo
+	Inst interface{}
+	// Args the arguments, ctx excluded
+	Args *Fields
+	// Results the results, error excluded
+	Results *Fields
+}
+
+// PatternHandler mocks all functions matching a pattern,
+// it sets Results and returns the error of the call.
+// Calling CallOld() in the handler makes the call
+// go to the original function.
+type PatternHandler func(ctx context.Context, call *DynamicCall) error
+
+// Pattern matches StubInfo, the format is `<package>::<owner>::<func>`,
+// each part is a glob where `*` matches any sequence of characters
+// including `/`, and `?` matches a single character.
+// Omitted trailing parts match anything, e.g. `github.com/acme/dao/*`.
+// Owner is the receiver type name without `*`, and is empty for plain functions.
+type Pattern struct {
+	pkg   string
+	owner string
+	name  string
+}
+
+// ParsePattern parses `<package>::<owner>::<func>`
+func ParsePattern(pattern string) (*Pattern, error) {
+	parts := strings.Split(pattern, "::")
+	if len(parts) > 3 {
+		return nil, fmt.Errorf("invalid pattern %q, expecting <package>::<owner>::<func>", pattern)
+	}
+	for len(parts) < 3 {
+		parts = append(parts, "*")
+	}
+	return &Pattern{pkg: parts[0], owner: parts[1], name: parts[2]}, nil
+}
+
+func MustParsePattern(pattern string) *Pattern {
+	p, err := ParsePattern(pattern)
+	if err != nil {
+		panic(err)
+	}
+	return p
+}
+
+// MatchPattern tests whether stubInfo matches pattern
+func MatchPattern(pattern string, stubInfo *StubInfo) bool {
+	return MustParsePattern(pattern).Match(stubInfo)
+}
+
+func (c *Pattern) Match(stubInfo *StubInfo) bool {
+	return matchGlob(c.pkg, stubInfo.PkgName) && matchGlob(c.owner, stubInfo.Owner) && matchGlob(c.name, stubInfo.Name)
+}
+
+func (c *Pattern) String() string {
+	return c.pkg + "::" + c.owner + "::" + c.name
+}
+
+// matchGlob matches s against glob with `*` and `?`
+func matchGlob(glob string, s string) bool {
+	// backtrack to the last star
+	gi, si := 0, 0
+	starGi, starSi := -1, 0
+	for si < len(s) {
+		if gi < len(glob) && (glob[gi] == '?' || glob[gi] == s[si]) {
+			gi++
+			si++
+		} else if gi < len(glob) && glob[gi] == '*' {
+			starGi, starSi = gi, si
+			gi++
+		} else if starGi >= 0 {
+			starSi++
+			gi, si = starGi+1, starSi
+		} else {
+			return false
+		}
+	}
+	for gi < len(glob) && glob[gi] == '*' {
+		gi++
+	}
+	return gi == len(glob)
+}
+
+type patternMock struct {
+	pattern *Pattern
+	handler PatternHandler
+}
+
+var patternMutex sync.RWMutex
+var globalPatternMocks []*patternMock
+
+// MockPattern registers handler for all functions matching pattern
+// in the whole process, until restore is called.
+// Later registered patterns take precedence.
+func MockPattern(pattern string, handler PatternHandler) (restore func()) {
+	m := newPatternMock(pattern, handler)
+	patternMutex.Lock()
+	// copy on write
+	globalPatternMocks = append(append([]*patternMock(nil), globalPatternMocks...), m)
+	patternMutex.Unlock()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			patternMutex.Lock()
+			defer patternMutex.Unlock()
+			list := make([]*patternMock, 0, len(globalPatternMocks))
+			for _, e := range globalPatternMocks {
+				if e != m {
+					list = append(list, e)
+				}
+			}
+			globalPatternMocks = list
+		})
+	}
+}
+
+type patternMockKeyType struct{}
+
+var patternMockKey patternMockKeyType
+
+type patternMockNode struct {
+	mock   *patternMock
+	parent *patternMockNode
+}
+
+// WithPatternMock registers handler for all functions matching
+// pattern, applied only to calls under the returned context.
+func WithPatternMock(ctx context.Context, pattern string, handler PatternHandler) context.Context {
+	m := newPatternMock(pattern, handler)
+	parent, _ := ctx.Value(patternMockKey).(*patternMockNode)
+	return context.WithValue(ctx, patternMockKey, &patternMockNode{mock: m, parent: parent})
+}
+
+func newPatternMock(pattern string, handler PatternHandler) *patternMock {
+	if handler == nil {
+		panic(fmt.Errorf("handler cannot be nil"))
+	}
+	return &patternMock{
+		pattern: MustParsePattern(pattern),
+		handler: handler,
+	}
+}
+
+// getCtxPatternMock applies pattern mocks from ctx
+func getCtxPatternMock(ctx context.Context, stubInfo *StubInfo, inst interface{}, req interface{}, resp interface{}) (mockResp bool, mockErr error) {
+	if ctx == nil {
+		return false, nil
+	}
+	node, _ := ctx.Value(patternMockKey).(*patternMockNode)
+	for ; node != nil; node = node.parent {
+		if mockResp, mockErr = node.mock.apply(ctx, stubInfo, inst, req, resp); mockResp {
+			return
+		}
+	}
+	return false, nil
+}
+
+// getGlobalPatternMock applies process-wide pattern mocks
+func getGlobalPatternMock(ctx context.Context, stubInfo *StubInfo, inst interface{}, req interface{}, resp interface{}) (mockResp bool, mockErr error) {
+	patternMutex.RLock()
+	list := globalPatternMocks
+	patternMutex.RUnlock()
+	for i := len(list) - 1; i >= 0; i-- {
+		if mockResp, mockErr = list[i].apply(ctx, stubInfo, inst, req, resp); mockResp {
+			return
+		}
+	}
+	return false, nil
+}
+
+func (c *patternMock) apply(ctx context.Context, stubInfo *StubInfo, inst interface{}, req interface{}, resp interface{}) (mockResp bool, mockErr error) {
+	if !c.pattern.Match(stubInfo) {
+		return false, nil
+	}
+	// TrapHandler callers may pass req and resp of other forms
+	if !isStructPtr(req) || !isStructPtr(resp) {
+		return false, nil
+	}
+	call := &DynamicCall{
+		Stub:    stubInfo,
+		Inst:    inst,
+		Args:    AsFields(req),
+		Results: AsFields(resp),
+	}
+	callOld := false
+	func() {
+		defer func() {
+			if e := recover(); e != nil {
+				if e == errCallOld {
+					callOld = true
+					return
+				}
+				panic(e)
+			}
+		}()
+		mockErr = c.handler(ctx, call)
+	}()
+	if callOld {
+		return false, nil
+	}
+	return true, mockErr
+}
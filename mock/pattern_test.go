@@ -0,0 +1,82 @@
+package mock
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+// go test -run TestMatchPattern -v ./mock
+func TestMatchPattern(t *testing.T) {
+	stub := &StubInfo{PkgName: "github.com/acme/dao/user", Owner: "UserDao", Name: "FindByID"}
+	testCases := []struct {
+		pattern string
+		expect  bool
+	}{
+		{"github.com/acme/dao/*::*::Find*", true},
+		{"github.com/acme/dao/*", true},
+		{"github.com/acme/*::User???::*", true},
+		{"github.com/acme/dao/*::*::Save*", false},
+		{"github.com/acme/dao::*::*", false},
+		{"*::::*", false},
+	}
+	for _, testCase := range testCases {
+		res := MatchPattern(testCase.pattern, stub)
+		if res != testCase.expect {
+			t.Fatalf("expect MatchPattern(%q) = %+v, actual:%+v", testCase.pattern, testCase.expect, res)
+		}
+	}
+	if _, err := ParsePattern("a::b::c::d"); err == nil {
+		t.Fatalf("expect invalid pattern")
+	}
+}
+
+// go test -run TestMockPattern -v ./mock
+func TestMockPattern(t *testing.T) {
+	restore := MockPattern("test::*::*", func(ctx context.Context, call *DynamicCall) error {
+		if call.Stub.Name != "Add" {
+			CallOld()
+		}
+		call.Results.Set("r", call.Args.Get("a").(int)*10)
+		return nil
+	})
+	r := add(1, 2)
+	if r != 10 {
+		t.Fatalf("expect %s = %+v, actual:%+v", `r`, 10, r)
+	}
+	s, _ := greet(context.Background(), "a")
+	if s != "hello a" {
+		t.Fatalf("expect %s = %+v, actual:%+v", `s`, "hello a", s)
+	}
+	restore()
+	if r := add(1, 2); r != 3 {
+		t.Fatalf("expect %s = %+v, actual:%+v", `r`, 3, r)
+	}
+
+	ctx := WithPatternMock(context.Background(), "test::::Gr*", func(ctx context.Context, call *DynamicCall) error {
+		return errors.New("mock err")
+	})
+	if _, err := greet(ctx, "a"); err == nil || err.Error() != "mock err" {
+		t.Fatalf("expect %s = %+v, actual:%+v", `err`, "mock err", err)
+	}
+}
+
+// go test -run TestMockPatternHandler -v ./mock
+func TestMockPatternHandler(t *testing.T) {
+	restore := MockPattern("*::*::*", func(ctx context.Context, call *DynamicCall) error {
+		return errors.New("mock err")
+	})
+	defer restore()
+
+	// handlers may pass req and resp not being struct pointers
+	handled := false
+	stub := &StubInfo{PkgName: "test/rpc", Name: "Handle"}
+	var resp *struct{}
+	err := TrapHandler(context.Background(), stub, nil, "req", resp, func(ctx context.Context) error {
+		handled = true
+		return nil
+	}, false, true, true)
+	if err != nil || !handled {
+		t.Fatalf("expect %s = %+v, actual:%+v", `handled,err`, "true,nil", []interface{}{handled, err})
+	}
+}
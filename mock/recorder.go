@@ -0,0 +1,211 @@
+package mock
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// Call is a captured invocation of a trapped function
+type Call struct {
+	Stub *StubInfo
+	Inst interface{}
+	// Req a deep copy of the request struct, taken before the call
+	Req interface{}
+	// Resp a deep copy of the response struct, taken after the call
+	Resp       interface{}
+	Err        error
+	IsPanic    bool
+	MockStatus MockStatus
+}
+
+// Recorder captures calls of trapped functions,
+// it can be attached to a context via WithRecorder,
+// or installed globally via InstallRecorder.
+// A Recorder is safe for concurrent use.
+type Recorder struct {
+	mutex sync.RWMutex
+	calls []*Call
+}
+
+func NewRecorder() *Recorder {
+	return &Recorder{}
+}
+
+type recorderKeyType struct{}
+
+var recorderKey recorderKeyType
+
+type recorderNode struct {
+	recorder *Recorder
+	parent   *recorderNode
+}
+
+// WithRecorder attach r to ctx, calls under the returned
+// context are recorded into r and any recorder already attached.
+func WithRecorder(ctx context.Context, r *Recorder) context.Context {
+	if r == nil {
+		panic(fmt.Errorf("recorder cannot be nil"))
+	}
+	parent, _ := ctx.Value(recorderKey).(*recorderNode)
+	return context.WithValue(ctx, recorderKey, &recorderNode{recorder: r, parent: parent})
+}
+
+var globalRecorderMutex sync.RWMutex
+var globalRecorders []*Recorder
+
+// InstallRecorder makes r record all calls in the process,
+// including those called without a context.
+func InstallRecorder(r *Recorder) (uninstall func()) {
+	if r == nil {
+		panic(fmt.Errorf("recorder cannot be nil"))
+	}
+	globalRecorderMutex.Lock()
+	// copy on write
+	globalRecorders = append(append([]*Recorder(nil), globalRecorders...), r)
+	globalRecorderMutex.Unlock()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			globalRecorderMutex.Lock()
+			defer globalRecorderMutex.Unlock()
+			list := make([]*Recorder, 0, len(globalRecorders))
+			for _, e := range globalRecorders {
+				if e != r {
+					list = append(list, e)
+				}
+			}
+			globalRecorders = list
+		})
+	}
+}
+
+func getRecorders(ctx context.Context) []*Recorder {
+	globalRecorderMutex.RLock()
+	recorders := globalRecorders
+	globalRecorderMutex.RUnlock()
+
+	if ctx == nil {
+		return recorders
+	}
+	node, _ := ctx.Value(recorderKey).(*recorderNode)
+	if node == nil {
+		return recorders
+	}
+	list := append([]*Recorder(nil), recorders...)
+	for ; node != nil; node = node.parent {
+		list = append(list, node.recorder)
+	}
+	return list
+}
+
+func (c *Recorder) record(call *Call) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.calls = append(c.calls, call)
+}
+
+// AllCalls returns all calls in the order they finished
+func (c *Recorder) AllCalls() []*Call {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return append([]*Call(nil), c.calls...)
+}
+
+// Calls returns calls of the given stub
+func (c *Recorder) Calls(stub *StubInfo) []*Call {
+	key := newStubKey(stub)
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	var calls []*Call
+	for _, call := range c.calls {
+		if newStubKey(call.Stub) == key {
+			calls = append(calls, call)
+		}
+	}
+	return calls
+}
+
+func (c *Recorder) CallCount(stub *StubInfo) int {
+	return len(c.Calls(stub))
+}
+
+// LastCall returns nil if stub is never called
+func (c *Recorder) LastCall(stub *StubInfo) *Call {
+	calls := c.Calls(stub)
+	if len(calls) == 0 {
+		return nil
+	}
+	return calls[len(calls)-1]
+}
+
+// CalledWith tests whether any call of stub satisfies matcher
+func (c *Recorder) CalledWith(stub *StubInfo, matcher func(call *Call) bool) bool {
+	for _, call := range c.Calls(stub) {
+		if matcher(call) {
+			return true
+		}
+	}
+	return false
+}
+
+// Reset clears all recorded calls
+func (c *Recorder) Reset() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.calls = nil
+}
+
+// callRecording holds the intermediate state of a call
+// until it finishes
+type callRecording struct {
+	recorders []*Recorder
+	call      *Call
+	resolved  bool // status set by the trap
+}
+
+func startRecording(recorders []*Recorder, stubInfo *StubInfo, inst interface{}, req interface{}) *callRecording {
+	return &callRecording{
+		recorders: recorders,
+		call: &Call{
+			Stub: stubInfo,
+			Inst: inst,
+			Req:  deepCopy(req),
+		},
+	}
+}
+
+func (c *callRecording) resolve(status MockStatus, isPanic bool) {
+	c.resolved = true
+	c.call.MockStatus = status
+	c.call.IsPanic = isPanic
+}
+
+func (c *callRecording) finish(resp interface{}, err error, panicErr interface{}) {
+	call := c.call
+	if !c.resolved {
+		// interceptors responded without reaching the trap
+		switch {
+		case panicErr != nil:
+			call.IsPanic = true
+			call.MockStatus = MockStatus_NormalError
+		case err != nil:
+			call.MockStatus = MockStatus_MockError
+		default:
+			call.MockStatus = MockStatus_MockResp
+		}
+	}
+	if panicErr != nil && err == nil {
+		if pe, ok := panicErr.(error); ok {
+			err = pe
+		} else {
+			err = fmt.Errorf("%v", panicErr)
+		}
+	}
+	call.Err = err
+	call.Resp = deepCopy(resp)
+	for _, r := range c.recorders {
+		r.record(call)
+	}
+}
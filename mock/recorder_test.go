@@ -0,0 +1,83 @@
+package mock
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+// go test -run TestRecorderCtx -v ./mock
+func TestRecorderCtx(t *testing.T) {
+	r := NewRecorder()
+	ctx := WithRecorder(context.Background(), r)
+	greet(ctx, "a")
+
+	ctx = WithMock(ctx, "test", "", "Greet", func(ctx context.Context, name string) (string, error) {
+		return "", errors.New("mock err")
+	})
+	greet(ctx, "b")
+
+	if n := r.CallCount(greetStub); n != 2 {
+		t.Fatalf("expect %s = %+v, actual:%+v", `n`, 2, n)
+	}
+	first := r.Calls(greetStub)[0]
+	if first.MockStatus != MockStatus_NormalResp {
+		t.Fatalf("expect %s = %+v, actual:%+v", `first.MockStatus`, MockStatus_NormalResp, first.MockStatus)
+	}
+	if s := first.Resp.(*struct {
+		S string `json:"s"`
+	}).S; s != "hello a" {
+		t.Fatalf("expect %s = %+v, actual:%+v", `s`, "hello a", s)
+	}
+	last := r.LastCall(greetStub)
+	if last.MockStatus != MockStatus_MockError || last.Err == nil {
+		t.Fatalf("expect mock error, actual:%+v %v", last.MockStatus, last.Err)
+	}
+	calledWithB := r.CalledWith(greetStub, func(call *Call) bool {
+		return call.Req.(*struct {
+			Name string `json:"name"`
+		}).Name == "b"
+	})
+	if !calledWithB {
+		t.Fatalf("expect called with b")
+	}
+
+	// not recorded without the recorder
+	greet(context.Background(), "c")
+	if n := len(r.AllCalls()); n != 2 {
+		t.Fatalf("expect %s = %+v, actual:%+v", `n`, 2, n)
+	}
+}
+
+// go test -run TestRecorderGlobal -v ./mock
+func TestRecorderGlobal(t *testing.T) {
+	r := NewRecorder()
+	uninstall := InstallRecorder(r)
+	add(1, 2)
+	uninstall()
+	add(1, 2)
+
+	if n := r.CallCount(addStub); n != 1 {
+		t.Fatalf("expect %s = %+v, actual:%+v", `n`, 1, n)
+	}
+	r.Reset()
+	if n := r.CallCount(addStub); n != 0 {
+		t.Fatalf("expect %s = %+v, actual:%+v", `n`, 0, n)
+	}
+}
+
+// go test -run TestDeepCopy -v ./mock
+func TestDeepCopy(t *testing.T) {
+	type S struct {
+		List []int
+		M    map[string]*int
+	}
+	n := 1
+	s := &S{List: []int{1}, M: map[string]*int{"a": &n}}
+	c := deepCopy(s).(*S)
+	s.List[0] = 2
+	n = 2
+	if c.List[0] != 1 || *c.M["a"] != 1 {
+		t.Fatalf("expect copy not affected, actual:%+v %+v", c.List, *c.M["a"])
+	}
+}
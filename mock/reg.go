@@ -33,6 +33,27 @@ func GetMockStubs() *MockStubRegistry {
 	defer mutext.Unlock()
 	return mockStubRegistry
 }
+
+// CopyMockStubs returns a snapshot of GetMockStubs, which can be
+// read while stubs, like instantiations of generic functions,
+// are being registered.
+func CopyMockStubs() *MockStubRegistry {
+	mutext.Lock()
+	defer mutext.Unlock()
+	reg := &MockStubRegistry{PkgMapping: make(map[string]*PkgRegistry, len(mockStubRegistry.PkgMapping))}
+	for pkg, preg := range mockStubRegistry.PkgMapping {
+		funcMapping := make(map[string]map[string]typeinfo.Func, len(preg.FuncMapping))
+		for owner, oreg := range preg.FuncMapping {
+			funcs := make(map[string]typeinfo.Func, len(oreg))
+			for name, fn := range oreg {
+				funcs[name] = fn
+			}
+			funcMapping[owner] = funcs
+		}
+		reg.PkgMapping[pkg] = &PkgRegistry{FuncMapping: funcMapping}
+	}
+	return reg
+}
 func GetMockTypes() typeinfo.Definitions {
 	mutext.Lock()
 	defer mutext.Unlock()
@@ -46,6 +67,18 @@ func SetBuildInfo(info *BuildInfo) {
 	buildInfo = info
 }
 
+// hasMockStub tells whether the function is registered
+func hasMockStub(pkg string, owner string, name string) bool {
+	mutext.Lock()
+	defer mutext.Unlock()
+	preg := mockStubRegistry.PkgMapping[pkg]
+	if preg == nil {
+		return false
+	}
+	_, ok := preg.FuncMapping[owner][name]
+	return ok
+}
+
 // RegisterMockStub
 // ownerType always passed as: (*X)(nil)
 func RegisterMockStub(pkg string, owner string, ownerType reflect.Type, name string, args []typeinfo.TypeInfo, results []typeinfo.TypeInfo, firstIsCtx bool, lastIsErr bool) {
@@ -0,0 +1,113 @@
+package sqlmock
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"strconv"
+	"sync"
+	"sync/atomic"
+)
+
+// *sql.Rows and *sql.Row can only be created by a driver, so
+// fixture results are served by querying an internal driver,
+// the query text is the id of a pending result.
+
+const driverName = "go-mock-sqlmock"
+
+func init() {
+	sql.Register(driverName, fixtureDriver{})
+}
+
+var resultDBOnce sync.Once
+var resultDB *sql.DB
+
+var resultSeq int64
+var pendingResults sync.Map // id -> *Query
+
+func getResultDB() *sql.DB {
+	resultDBOnce.Do(func() {
+		var err error
+		resultDB, err = sql.Open(driverName, "")
+		if err != nil {
+			panic(fmt.Errorf("open %s: %v", driverName, err))
+		}
+	})
+	return resultDB
+}
+
+// queryResult returns rows of q, or its error
+func queryResult(ctx context.Context, q *Query) (*sql.Rows, error) {
+	id := addPending(q)
+	defer pendingResults.Delete(id)
+	return getResultDB().QueryContext(ctx, id)
+}
+
+// queryRowResult returns the first row of q, or its error
+func queryRowResult(ctx context.Context, q *Query) *sql.Row {
+	id := addPending(q)
+	defer pendingResults.Delete(id)
+	return getResultDB().QueryRowContext(ctx, id)
+}
+
+func addPending(q *Query) string {
+	id := strconv.FormatInt(atomic.AddInt64(&resultSeq, 1), 10)
+	pendingResults.Store(id, q)
+	return id
+}
+
+type fixtureDriver struct{}
+
+func (fixtureDriver) Open(name string) (driver.Conn, error) {
+	return fixtureConn{}, nil
+}
+
+type fixtureConn struct{}
+
+func (fixtureConn) Prepare(query string) (driver.Stmt, error) {
+	return fixtureStmt{id: query}, nil
+}
+func (fixtureConn) Close() error { return nil }
+func (fixtureConn) Begin() (driver.Tx, error) {
+	return nil, fmt.Errorf("%s: transactions not supported", driverName)
+}
+
+type fixtureStmt struct {
+	id string
+}
+
+func (fixtureStmt) Close() error  { return nil }
+func (fixtureStmt) NumInput() int { return -1 }
+func (c fixtureStmt) Exec(args []driver.Value) (driver.Result, error) {
+	return nil, fmt.Errorf("%s: exec not supported", driverName)
+}
+func (c fixtureStmt) Query(args []driver.Value) (driver.Rows, error) {
+	v, ok := pendingResults.Load(c.id)
+	if !ok {
+		return nil, fmt.Errorf("%s: result not found: %s", driverName, c.id)
+	}
+	q := v.(*Query)
+	if q.err != nil {
+		return nil, q.err
+	}
+	return &fixtureRows{columns: q.Columns, rows: q.values}, nil
+}
+
+type fixtureRows struct {
+	columns []string
+	rows    [][]driver.Value
+	i       int
+}
+
+func (c *fixtureRows) Columns() []string { return c.columns }
+func (c *fixtureRows) Close() error      { return nil }
+func (c *fixtureRows) Next(dest []driver.Value) error {
+	if c.i >= len(c.rows) {
+		return io.EOF
+	}
+	copy(dest, c.rows[c.i])
+	c.i++
+	return nil
+}
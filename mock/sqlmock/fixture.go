@@ -0,0 +1,340 @@
+package sqlmock
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/xhd2015/go-mock/mock"
+)
+
+// ENV_FIXTURE_FILE comma separated fixture files serving all
+// queries of the process, see Config.
+const ENV_FIXTURE_FILE = "GO_MOCK_SQL_FIXTURE_FILE"
+
+// Config example:
+//
+//	{
+//	  "queries": [
+//	    {"sql": "SELECT id, name FROM users WHERE id = ?", "args": [1], "columns": ["id", "name"], "rows": [[1, "alice"]]},
+//	    {"sql": "SELECT id, name FROM users WHERE id = ?", "args": [2], "error": "sql: no rows in result set"},
+//	    {"regex": "(?i)^insert into users", "rows_affected": 1, "last_insert_id": 10}
+//	  ]
+//	}
+type Config struct {
+	Queries []*Query `json:"queries"`
+}
+
+// Query describes queries to be matched, and their result.
+// SQL is compared with the query after collapsing white spaces,
+// case-insensitively. Regex is matched against the query as is.
+// Args, if not null, must equal the args after converting to JSON.
+// Rows are served to QueryContext and QueryRowContext, RowsAffected
+// and LastInsertID to ExecContext. Error, if set, is returned instead,
+// errors of database/sql like sql.ErrNoRows are returned as is.
+// Args and Rows of configs built in code are converted to JSON by
+// New, so Go values like int match and serve like parsed numbers.
+type Query struct {
+	SQL   string        `json:"sql,omitempty"`
+	Regex string        `json:"regex,omitempty"`
+	Args  []interface{} `json:"args,omitempty"`
+
+	Columns      []string        `json:"columns,omitempty"`
+	Rows         [][]interface{} `json:"rows,omitempty"`
+	RowsAffected int64           `json:"rows_affected,omitempty"`
+	LastInsertID int64           `json:"last_insert_id,omitempty"`
+	Error        string          `json:"error,omitempty"`
+
+	sql    string
+	regex  *regexp.Regexp
+	args   interface{} // Args as if parsed by ParseConfig
+	values [][]driver.Value
+	err    error
+}
+
+// knownErrors are returned as is, so they can be compared
+var knownErrors = []error{sql.ErrNoRows, sql.ErrTxDone, sql.ErrConnDone}
+
+// Result is the sql.Result of ExecContext served by fixtures
+type Result struct {
+	InsertID int64 `json:"last_insert_id"`
+	Affected int64 `json:"rows_affected"`
+}
+
+var _ sql.Result = (*Result)(nil)
+
+func (c *Result) LastInsertId() (int64, error) { return c.InsertID, nil }
+func (c *Result) RowsAffected() (int64, error) { return c.Affected, nil }
+
+// ParseConfig parses config, numbers keep their precision
+func ParseConfig(data []byte) (*Config, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var config Config
+	err := dec.Decode(&config)
+	if err != nil {
+		return nil, err
+	}
+	return &config, nil
+}
+
+// LoadConfig loads config from files, queries of former
+// files take precedence.
+func LoadConfig(files ...string) (*Config, error) {
+	config := &Config{}
+	for _, file := range files {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		c, err := ParseConfig(data)
+		if err != nil {
+			return nil, fmt.Errorf("parse %s: %v", file, err)
+		}
+		config.Queries = append(config.Queries, c.Queries...)
+	}
+	return config, nil
+}
+
+// Fixtures serves queries by the first matching query of config
+type Fixtures struct {
+	queries []*Query
+}
+
+// New validates config and creates fixtures
+func New(config *Config) (*Fixtures, error) {
+	c := &Fixtures{}
+	for i, q := range config.Queries {
+		if (q.SQL == "") == (q.Regex == "") {
+			return nil, fmt.Errorf("queries[%d]: requires exactly one of sql and regex", i)
+		}
+		if q.Regex != "" {
+			var err error
+			q.regex, err = regexp.Compile(q.Regex)
+			if err != nil {
+				return nil, fmt.Errorf("queries[%d]: %v", i, err)
+			}
+		}
+		q.sql = normalizeSQL(q.SQL)
+		// configs built in code have Go values, like int
+		if q.Args != nil {
+			var err error
+			q.args, err = toJSONValue(q.Args)
+			if err != nil {
+				return nil, fmt.Errorf("queries[%d].args: %v", i, err)
+			}
+		}
+		if q.Error != "" {
+			q.err = toError(q.Error)
+		}
+		q.values = make([][]driver.Value, 0, len(q.Rows))
+		for j, row := range q.Rows {
+			if len(row) != len(q.Columns) {
+				return nil, fmt.Errorf("queries[%d].rows[%d]: expect %d columns, actual:%d", i, j, len(q.Columns), len(row))
+			}
+			values := make([]driver.Value, 0, len(row))
+			for _, v := range row {
+				v, err := toJSONValue(v)
+				if err != nil {
+					return nil, fmt.Errorf("queries[%d].rows[%d]: %v", i, j, err)
+				}
+				dv, err := toDriverValue(v)
+				if err != nil {
+					return nil, fmt.Errorf("queries[%d].rows[%d]: %v", i, j, err)
+				}
+				values = append(values, dv)
+			}
+			q.values = append(q.values, values)
+		}
+		c.queries = append(c.queries, q)
+	}
+	return c, nil
+}
+
+func normalizeSQL(s string) string {
+	s = strings.TrimSuffix(strings.TrimSpace(s), ";")
+	return strings.ToLower(strings.Join(strings.Fields(s), " "))
+}
+
+func toError(msg string) error {
+	for _, err := range knownErrors {
+		if err.Error() == msg {
+			return err
+		}
+	}
+	return errors.New(msg)
+}
+
+func toDriverValue(v interface{}) (driver.Value, error) {
+	switch v := v.(type) {
+	case nil, string, bool:
+		return v, nil
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i, nil
+		}
+		return v.Float64()
+	default:
+		// objects and arrays are served as JSON
+		return json.Marshal(v)
+	}
+}
+
+// Match returns the first query matching query and args, or nil
+func (c *Fixtures) Match(query string, args []interface{}) *Query {
+	var jsonArgs interface{}
+	argsConverted := false
+	nquery := ""
+	for _, q := range c.queries {
+		if q.regex != nil {
+			if !q.regex.MatchString(query) {
+				continue
+			}
+		} else {
+			if nquery == "" {
+				nquery = normalizeSQL(query)
+			}
+			if q.sql != nquery {
+				continue
+			}
+		}
+		if q.args != nil {
+			if !argsConverted {
+				jsonArgs = toJSONArgs(args)
+				argsConverted = true
+			}
+			if !mock.IsJSONSubset(q.args, jsonArgs) {
+				continue
+			}
+		}
+		return q
+	}
+	return nil
+}
+
+// toJSONArgs converts args as if parsed by ParseConfig,
+// nil if not convertible.
+func toJSONArgs(args []interface{}) interface{} {
+	values := make([]interface{}, 0, len(args))
+	for _, arg := range args {
+		if valuer, ok := arg.(driver.Valuer); ok {
+			v, err := valuer.Value()
+			if err != nil {
+				return nil
+			}
+			arg = v
+		}
+		values = append(values, arg)
+	}
+	v, err := toJSONValue(values)
+	if err != nil {
+		return nil
+	}
+	return v
+}
+
+// toJSONValue converts v to JSON and back, with numbers as json.Number
+func toJSONValue(v interface{}) (interface{}, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var res interface{}
+	err = dec.Decode(&res)
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// Patch serves queries of the whole process, until restore is called
+func (c *Fixtures) Patch() (restore func()) {
+	var restores []func()
+	for _, owner := range []string{"DB", "Tx"} {
+		restores = append(restores,
+			mock.Patch(NewStubInfo(owner, "QueryContext"), c.queryContext),
+			mock.Patch(NewStubInfo(owner, "QueryRowContext"), c.queryRowContext),
+			mock.Patch(NewStubInfo(owner, "ExecContext"), c.execContext),
+		)
+	}
+	return func() {
+		for _, restore := range restores {
+			restore()
+		}
+	}
+}
+
+// WithFixtures serves queries with ctx by fixtures
+func WithFixtures(ctx context.Context, fixtures *Fixtures) context.Context {
+	for _, owner := range []string{"DB", "Tx"} {
+		ctx = mock.WithMock(ctx, PKG, owner, "QueryContext", fixtures.queryContext)
+		ctx = mock.WithMock(ctx, PKG, owner, "QueryRowContext", fixtures.queryRowContext)
+		ctx = mock.WithMock(ctx, PKG, owner, "ExecContext", fixtures.execContext)
+	}
+	return ctx
+}
+
+// recv is *sql.DB or *sql.Tx, queries not matched are sent for real
+
+func (c *Fixtures) queryContext(recv interface{}, ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	q := c.Match(query, args)
+	if q == nil {
+		mock.CallOld()
+	}
+	return queryResult(contextOrBackground(ctx), q)
+}
+
+func (c *Fixtures) queryRowContext(recv interface{}, ctx context.Context, query string, args ...interface{}) *sql.Row {
+	q := c.Match(query, args)
+	if q == nil {
+		mock.CallOld()
+	}
+	return queryRowResult(contextOrBackground(ctx), q)
+}
+
+func (c *Fixtures) execContext(recv interface{}, ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	q := c.Match(query, args)
+	if q == nil {
+		mock.CallOld()
+	}
+	if q.err != nil {
+		return nil, q.err
+	}
+	return &Result{InsertID: q.LastInsertID, Affected: q.RowsAffected}, nil
+}
+
+func contextOrBackground(ctx context.Context) context.Context {
+	if ctx == nil {
+		return context.Background()
+	}
+	return ctx
+}
+
+// InstallFromEnv patches fixtures configured by GO_MOCK_SQL_FIXTURE_FILE,
+// it does nothing if not set.
+func InstallFromEnv() (installed bool, err error) {
+	files := strings.TrimSpace(os.Getenv(ENV_FIXTURE_FILE))
+	if files == "" {
+		return false, nil
+	}
+	config, err := LoadConfig(strings.Split(files, ",")...)
+	if err != nil {
+		return false, err
+	}
+	fixtures, err := New(config)
+	if err != nil {
+		return false, err
+	}
+	fixtures.Patch()
+	return true, nil
+}
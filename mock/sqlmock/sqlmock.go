@@ -0,0 +1,151 @@
+// Package sqlmock traps queries of database/sql, and serves them
+// from table-driven JSON fixtures.
+//
+// Code rewritten with the -mock-sql option calls the functions of this
+// package instead of QueryContext, QueryRowContext and ExecContext of
+// *sql.DB and *sql.Tx, or of interfaces with the same methods, like DBTX
+// of sqlc, whose dynamic type may be *sql.DB or *sql.Tx. They pass the call through mock.TrapFunc as the
+// method of owner DB or Tx in package database/sql, so interceptors,
+// traces and mocks of mock apply to them like to any rewritten function.
+// The database/sql package itself is not rewritten: std packages
+// cannot import packages outside std.
+package sqlmock
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/xhd2015/go-mock/mock"
+)
+
+const _SKIP_MOCK = true
+
+const PKG = "database/sql"
+
+// QueryReq is the req of trapped QueryContext, QueryRowContext
+// and ExecContext, as seen by interceptors
+type QueryReq struct {
+	Query string        `json:"query"`
+	Args  []interface{} `json:"args"`
+}
+
+// QueryResp is the resp of trapped QueryContext
+type QueryResp struct {
+	Rows *sql.Rows `json:"rows"`
+}
+
+// QueryRowResp is the resp of trapped QueryRowContext
+type QueryRowResp struct {
+	Row *sql.Row `json:"row"`
+}
+
+// ExecResp is the resp of trapped ExecContext
+type ExecResp struct {
+	Result sql.Result `json:"result"`
+}
+
+// NewStubInfo returns the stub of a trapped method, owner is DB or Tx,
+// to be used with mock.Patch. Mock functions have the same signature
+// as the method, with receiver as the first argument.
+func NewStubInfo(owner string, name string) *mock.StubInfo {
+	return &mock.StubInfo{PkgName: PKG, Owner: owner, OwnerPtr: true, Name: name}
+}
+
+// DBQueryContext replaces db.QueryContext in rewritten packages
+func DBQueryContext(db *sql.DB, ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	_mockreq := QueryReq{Query: query, Args: args}
+	var _mockresp QueryResp
+	err := mock.TrapFunc(ctx, NewStubInfo("DB", "QueryContext"), db, &_mockreq, &_mockresp, (*sql.DB).QueryContext, true, true, true)
+	return _mockresp.Rows, err
+}
+
+// DBQueryRowContext replaces db.QueryRowContext in rewritten packages
+func DBQueryRowContext(db *sql.DB, ctx context.Context, query string, args ...interface{}) *sql.Row {
+	_mockreq := QueryReq{Query: query, Args: args}
+	var _mockresp QueryRowResp
+	mock.TrapFunc(ctx, NewStubInfo("DB", "QueryRowContext"), db, &_mockreq, &_mockresp, (*sql.DB).QueryRowContext, true, true, false)
+	return _mockresp.Row
+}
+
+// DBExecContext replaces db.ExecContext in rewritten packages
+func DBExecContext(db *sql.DB, ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	_mockreq := QueryReq{Query: query, Args: args}
+	var _mockresp ExecResp
+	err := mock.TrapFunc(ctx, NewStubInfo("DB", "ExecContext"), db, &_mockreq, &_mockresp, (*sql.DB).ExecContext, true, true, true)
+	return _mockresp.Result, err
+}
+
+// TxQueryContext replaces tx.QueryContext in rewritten packages
+func TxQueryContext(tx *sql.Tx, ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	_mockreq := QueryReq{Query: query, Args: args}
+	var _mockresp QueryResp
+	err := mock.TrapFunc(ctx, NewStubInfo("Tx", "QueryContext"), tx, &_mockreq, &_mockresp, (*sql.Tx).QueryContext, true, true, true)
+	return _mockresp.Rows, err
+}
+
+// TxQueryRowContext replaces tx.QueryRowContext in rewritten packages
+func TxQueryRowContext(tx *sql.Tx, ctx context.Context, query string, args ...interface{}) *sql.Row {
+	_mockreq := QueryReq{Query: query, Args: args}
+	var _mockresp QueryRowResp
+	mock.TrapFunc(ctx, NewStubInfo("Tx", "QueryRowContext"), tx, &_mockreq, &_mockresp, (*sql.Tx).QueryRowContext, true, true, false)
+	return _mockresp.Row
+}
+
+// TxExecContext replaces tx.ExecContext in rewritten packages
+func TxExecContext(tx *sql.Tx, ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	_mockreq := QueryReq{Query: query, Args: args}
+	var _mockresp ExecResp
+	err := mock.TrapFunc(ctx, NewStubInfo("Tx", "ExecContext"), tx, &_mockreq, &_mockresp, (*sql.Tx).ExecContext, true, true, true)
+	return _mockresp.Result, err
+}
+
+// QueryerContext is an interface with QueryContext of *sql.DB and *sql.Tx
+type QueryerContext interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// RowQueryerContext is an interface with QueryRowContext of *sql.DB and *sql.Tx
+type RowQueryerContext interface {
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// ExecerContext is an interface with ExecContext of *sql.DB and *sql.Tx
+type ExecerContext interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+// QueryContext replaces q.QueryContext in rewritten packages when q is
+// an interface, it is trapped if the dynamic type of q is *sql.DB or *sql.Tx
+func QueryContext(q QueryerContext, ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	switch q := q.(type) {
+	case *sql.DB:
+		return DBQueryContext(q, ctx, query, args...)
+	case *sql.Tx:
+		return TxQueryContext(q, ctx, query, args...)
+	}
+	return q.QueryContext(ctx, query, args...)
+}
+
+// QueryRowContext replaces q.QueryRowContext in rewritten packages when q
+// is an interface, it is trapped if the dynamic type of q is *sql.DB or *sql.Tx
+func QueryRowContext(q RowQueryerContext, ctx context.Context, query string, args ...interface{}) *sql.Row {
+	switch q := q.(type) {
+	case *sql.DB:
+		return DBQueryRowContext(q, ctx, query, args...)
+	case *sql.Tx:
+		return TxQueryRowContext(q, ctx, query, args...)
+	}
+	return q.QueryRowContext(ctx, query, args...)
+}
+
+// ExecContext replaces e.ExecContext in rewritten packages when e is
+// an interface, it is trapped if the dynamic type of e is *sql.DB or *sql.Tx
+func ExecContext(e ExecerContext, ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	switch e := e.(type) {
+	case *sql.DB:
+		return DBExecContext(e, ctx, query, args...)
+	case *sql.Tx:
+		return TxExecContext(e, ctx, query, args...)
+	}
+	return e.ExecContext(ctx, query, args...)
+}
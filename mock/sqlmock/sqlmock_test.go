@@ -0,0 +1,141 @@
+package sqlmock
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	"github.com/xhd2015/go-mock/mock"
+)
+
+const testConfig = `{
+  "queries": [
+    {"sql": "SELECT id, name FROM users WHERE id = ?", "args": [1], "columns": ["id", "name"], "rows": [[1, "alice"]]},
+    {"sql": "select id, name from users where id = ?", "args": [2], "error": "sql: no rows in result set"},
+    {"regex": "(?i)^insert into users", "rows_affected": 1, "last_insert_id": 10}
+  ]
+}`
+
+// go test -run TestFixtures -v ./mock/sqlmock
+func TestFixtures(t *testing.T) {
+	config, err := ParseConfig([]byte(testConfig))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fixtures, err := New(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// queries not matched reach the internal driver, which fails
+	db, err := sql.Open(driverName, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec := mock.NewRecorder()
+	ctx := mock.WithRecorder(WithFixtures(context.Background(), fixtures), rec)
+
+	var id int64
+	var name string
+	err = DBQueryRowContext(db, ctx, "select id, name\n  from users where id = ?;", 1).Scan(&id, &name)
+	if err != nil || id != 1 || name != "alice" {
+		t.Fatalf("expect %s = %+v, actual:%+v", `id,name,err`, "1,alice,nil", []interface{}{id, name, err})
+	}
+
+	rows, err := DBQueryContext(db, ctx, "SELECT id, name FROM users WHERE id = ?", int64(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := 0
+	for rows.Next() {
+		n++
+	}
+	rows.Close()
+	if n != 1 {
+		t.Fatalf("expect %s = %+v, actual:%+v", `n`, 1, n)
+	}
+
+	err = DBQueryRowContext(db, ctx, "SELECT id, name FROM users WHERE id = ?", 2).Scan(&id, &name)
+	if err != sql.ErrNoRows {
+		t.Fatalf("expect %s = %+v, actual:%+v", `err`, sql.ErrNoRows, err)
+	}
+
+	res, err := DBExecContext(db, ctx, "INSERT INTO users(name) VALUES(?)", "bob")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lastID, _ := res.LastInsertId(); lastID != 10 {
+		t.Fatalf("expect %s = %+v, actual:%+v", `lastID`, 10, lastID)
+	}
+
+	// not matched, sent for real
+	_, err = DBQueryContext(db, ctx, "SELECT id, name FROM users WHERE id = ?", 3)
+	if err == nil {
+		t.Fatalf("expect err not nil")
+	}
+	calls := rec.Calls(NewStubInfo("DB", "QueryContext"))
+	if len(calls) != 2 || calls[0].MockStatus != mock.MockStatus_MockResp || calls[1].MockStatus != mock.MockStatus_NormalError {
+		t.Fatalf("expect %s = %+v, actual:%+v", `calls`, "mock_resp,normal_error", calls)
+	}
+}
+
+type dbtx interface {
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// go test -run TestInterfaceCall -v ./mock/sqlmock
+func TestInterfaceCall(t *testing.T) {
+	config, err := ParseConfig([]byte(testConfig))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fixtures, err := New(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := sql.Open(driverName, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec := mock.NewRecorder()
+	ctx := mock.WithRecorder(WithFixtures(context.Background(), fixtures), rec)
+
+	var q dbtx = db
+	var id int64
+	var name string
+	err = QueryRowContext(q, ctx, "SELECT id, name FROM users WHERE id = ?", 1).Scan(&id, &name)
+	if err != nil || id != 1 || name != "alice" {
+		t.Fatalf("expect %s = %+v, actual:%+v", `id,name,err`, "1,alice,nil", []interface{}{id, name, err})
+	}
+	calls := rec.Calls(NewStubInfo("DB", "QueryRowContext"))
+	if len(calls) != 1 {
+		t.Fatalf("expect %s = %+v, actual:%+v", `len(calls)`, 1, len(calls))
+	}
+}
+
+// go test -run TestConfigInCode -v ./mock/sqlmock
+func TestConfigInCode(t *testing.T) {
+	fixtures, err := New(&Config{Queries: []*Query{
+		{SQL: "SELECT id, name FROM users WHERE id = ?", Args: []interface{}{1}, Columns: []string{"id", "name"}, Rows: [][]interface{}{{1, "alice"}}},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := sql.Open(driverName, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := WithFixtures(context.Background(), fixtures)
+
+	var id int64
+	var name string
+	err = DBQueryRowContext(db, ctx, "SELECT id, name FROM users WHERE id = ?", 1).Scan(&id, &name)
+	if err != nil || id != 1 || name != "alice" {
+		t.Fatalf("expect %s = %+v, actual:%+v", `id,name,err`, "1,alice,nil", []interface{}{id, name, err})
+	}
+	// served as int64, not as JSON bytes
+	var v interface{}
+	err = DBQueryRowContext(db, ctx, "SELECT id, name FROM users WHERE id = ?", 1).Scan(&v, &name)
+	if _, ok := v.(int64); err != nil || !ok {
+		t.Fatalf("expect %s = %+v, actual:%+v", `id`, "int64", []interface{}{v, err})
+	}
+}
@@ -0,0 +1,225 @@
+package trace
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/xhd2015/go-mock/mock"
+)
+
+const (
+	// ENV_CALL_TREE the file to write call tree into, HTML if
+	// the file ends with .html, otherwise text.
+	// Each root span is appended after it ends.
+	ENV_CALL_TREE = "GO_MOCK_CALL_TREE"
+)
+
+// textValueLimit truncates long args and results in text output
+const textValueLimit = 200
+
+// RenderCallTreeText renders an indented call tree, example:
+//
+//	github.com/acme/biz.Run {"id":1} => {"name":"a"} 1.2ms
+//	├── github.com/acme/dao.*Dao.Find {"id":1} => {"name":"a"} 0.5ms [mock_resp]
+//	└── github.com/acme/rpc.Notify {} => error: timeout 0.6ms
+func RenderCallTreeText(w io.Writer, roots []*Span) error {
+	var b strings.Builder
+	for _, root := range roots {
+		writeTextSpan(&b, root, "", "")
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func writeTextSpan(b *strings.Builder, span *Span, prefix string, childPrefix string) {
+	b.WriteString(prefix)
+	b.WriteString(span.Name())
+	b.WriteString(" ")
+	b.WriteString(truncate(toJSON(span.Request), textValueLimit))
+	b.WriteString(" => ")
+	if span.Error != "" {
+		if span.IsPanic {
+			b.WriteString("panic: ")
+		} else {
+			b.WriteString("error: ")
+		}
+		b.WriteString(truncate(span.Error, textValueLimit))
+	} else if span.End.IsZero() {
+		b.WriteString("<running>")
+	} else {
+		b.WriteString(truncate(toJSON(span.Response), textValueLimit))
+	}
+	if !span.End.IsZero() {
+		b.WriteString(" ")
+		b.WriteString(formatDuration(span.Duration()))
+	}
+	if isMocked(span) {
+		b.WriteString(" [")
+		b.WriteString(string(span.MockStatus))
+		b.WriteString("]")
+	}
+	b.WriteString("\n")
+	for i, child := range span.Children {
+		if i == len(span.Children)-1 {
+			writeTextSpan(b, child, childPrefix+"└── ", childPrefix+"    ")
+		} else {
+			writeTextSpan(b, child, childPrefix+"├── ", childPrefix+"│   ")
+		}
+	}
+}
+
+type htmlNode struct {
+	Name     string
+	Request  string
+	Response string
+	Error    string
+	IsPanic  bool
+	Running  bool
+	Duration string
+	Mocked   bool
+	Status   string
+	Children []*htmlNode
+}
+
+func newHTMLNode(span *Span) *htmlNode {
+	node := &htmlNode{
+		Name:     span.Name(),
+		Request:  toIndentJSON(span.Request),
+		Error:    span.Error,
+		IsPanic:  span.IsPanic,
+		Running:  span.End.IsZero(),
+		Duration: formatDuration(span.Duration()),
+		Mocked:   isMocked(span),
+		Status:   string(span.MockStatus),
+	}
+	if span.Response != nil {
+		node.Response = toIndentJSON(span.Response)
+	}
+	for _, child := range span.Children {
+		node.Children = append(node.Children, newHTMLNode(child))
+	}
+	return node
+}
+
+// callTreeHTML has no script after the nodes, so that a page
+// is usable before the footer is written, see FileExporter.
+var callTreeHTML = template.Must(template.New("page").Funcs(template.FuncMap{
+	"child": func(n *htmlNode) *htmlNodeData { return &htmlNodeData{Node: n} },
+}).Parse(`{{define "header"}}<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Call Tree</title>
+<style>
+body { font-family: Menlo, Consolas, monospace; font-size: 13px; margin: 16px; }
+details { margin-left: 20px; }
+details.root { margin-left: 0; }
+summary { cursor: pointer; padding: 2px 0; }
+.dur { color: #888; }
+.mock { background: #fff3cd; border-radius: 3px; padding: 0 4px; }
+.err { color: #c00; }
+.running { color: #06c; }
+.kv { margin: 2px 0 4px 20px; }
+.kv pre { margin: 0 0 2px 0; padding: 4px; background: #f6f8fa; white-space: pre-wrap; }
+.label { color: #666; }
+</style>
+<script>
+function toggleAll(open){document.querySelectorAll("details").forEach(function(d){d.open=open})}
+</script>
+</head>
+<body>
+<div><a href="#" onclick="toggleAll(true);return false">expand all</a> | <a href="#" onclick="toggleAll(false);return false">collapse all</a></div>
+{{end}}{{define "footer"}}</body>
+</html>
+{{end}}{{define "node"}}<details open{{if .Root}} class="root"{{end}}>
+<summary>{{.Node.Name}}{{if .Node.Running}} <span class="running">running</span>{{else}} <span class="dur">{{.Node.Duration}}</span>{{end}}{{if .Node.Mocked}} <span class="mock">{{.Node.Status}}</span>{{end}}{{if .Node.Error}} <span class="err">{{if .Node.IsPanic}}panic{{else}}error{{end}}: {{.Node.Error}}</span>{{end}}</summary>
+<div class="kv">
+<div class="label">args</div><pre>{{.Node.Request}}</pre>
+{{if .Node.Response}}<div class="label">results</div><pre>{{.Node.Response}}</pre>{{end}}
+</div>
+{{range .Node.Children}}{{template "node" (child .)}}{{end}}
+</details>
+{{end}}`))
+
+type htmlNodeData struct {
+	Root bool
+	Node *htmlNode
+}
+
+// RenderCallTreeHTML renders a self-contained HTML page,
+// each call is a collapsible node with its args, results,
+// error, duration and mock status.
+func RenderCallTreeHTML(w io.Writer, roots []*Span) error {
+	err := callTreeHTML.ExecuteTemplate(w, "header", nil)
+	if err != nil {
+		return err
+	}
+	for _, root := range roots {
+		err = renderHTMLRoot(w, root)
+		if err != nil {
+			return err
+		}
+	}
+	return callTreeHTML.ExecuteTemplate(w, "footer", nil)
+}
+
+// renderHTMLRoot renders root as a node of the page,
+// which can be appended after the header.
+func renderHTMLRoot(w io.Writer, root *Span) error {
+	return callTreeHTML.ExecuteTemplate(w, "node", &htmlNodeData{Root: true, Node: newHTMLNode(root)})
+}
+
+// WriteCallTreeFile writes call tree of all spans of t into file,
+// HTML if the file ends with .html or .htm, otherwise text.
+func (t *Tracer) WriteCallTreeFile(file string) error {
+	roots := t.Roots()
+	return writeFileAtomic(file, func(w io.Writer) error {
+		if isHTMLFile(file) {
+			return RenderCallTreeHTML(w, roots)
+		}
+		return RenderCallTreeText(w, roots)
+	})
+}
+
+func isHTMLFile(file string) bool {
+	switch strings.ToLower(filepath.Ext(file)) {
+	case ".html", ".htm":
+		return true
+	}
+	return false
+}
+
+func isMocked(span *Span) bool {
+	return span.MockStatus == mock.MockStatus_MockResp || span.MockStatus == mock.MockStatus_MockError
+}
+
+func formatDuration(d time.Duration) string {
+	switch {
+	case d >= time.Second:
+		return fmt.Sprintf("%.2fs", d.Seconds())
+	case d >= time.Millisecond:
+		return fmt.Sprintf("%.2fms", float64(d)/float64(time.Millisecond))
+	default:
+		return fmt.Sprintf("%.2fµs", float64(d)/float64(time.Microsecond))
+	}
+}
+
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n] + "..."
+}
+
+func toIndentJSON(v interface{}) string {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return fmt.Sprintf("%v", v)
+	}
+	return string(data)
+}
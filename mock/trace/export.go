@@ -0,0 +1,283 @@
+package trace
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// ENV_TRACE_FILE the file to write traces into,
+	// each root span is appended after it ends.
+	ENV_TRACE_FILE = "GO_MOCK_TRACE_FILE"
+	// ENV_TRACE_FORMAT format of the trace file: chrome(default) or otlp
+	ENV_TRACE_FORMAT = "GO_MOCK_TRACE_FORMAT"
+)
+
+const (
+	FormatChrome = "chrome"
+	FormatOTLP   = "otlp"
+)
+
+type chromeTrace struct {
+	TraceEvents     []*chromeEvent `json:"traceEvents"`
+	DisplayTimeUnit string         `json:"displayTimeUnit"`
+}
+
+// see https://docs.google.com/document/d/1CvAClvFfyA5R-PhYUmn5OOQtYMH4h6I0nSsKchNAySU
+type chromeEvent struct {
+	Name string                 `json:"name"`
+	Cat  string                 `json:"cat"`
+	Ph   string                 `json:"ph"`
+	Ts   int64                  `json:"ts"`  // microseconds
+	Dur  int64                  `json:"dur"` // microseconds
+	Pid  int                    `json:"pid"`
+	Tid  int64                  `json:"tid"`
+	Args map[string]interface{} `json:"args,omitempty"`
+}
+
+// ExportChromeTrace writes spans as Chrome trace-event JSON,
+// which can be opened by chrome://tracing or Perfetto.
+// Unfinished spans are exported as if they end now.
+func (t *Tracer) ExportChromeTrace(w io.Writer) error {
+	trace := &chromeTrace{
+		TraceEvents:     chromeEvents(t.Roots(), time.Now()),
+		DisplayTimeUnit: "ms",
+	}
+	return json.NewEncoder(w).Encode(trace)
+}
+
+func chromeEvents(roots []*Span, now time.Time) []*chromeEvent {
+	events := []*chromeEvent{}
+	walkSpans(roots, func(span *Span) {
+		args := map[string]interface{}{
+			"req": span.Request,
+		}
+		if span.Response != nil {
+			args["resp"] = span.Response
+		}
+		if span.Error != "" {
+			args["error"] = span.Error
+		}
+		if span.IsPanic {
+			args["panic"] = true
+		}
+		if span.MockStatus != "" {
+			args["mock_status"] = span.MockStatus
+		}
+		events = append(events, &chromeEvent{
+			Name: span.Name(),
+			Cat:  "function",
+			Ph:   "X",
+			Ts:   span.Start.UnixNano() / int64(time.Microsecond),
+			Dur:  int64(spanEnd(span, now).Sub(span.Start) / time.Microsecond),
+			Pid:  1,
+			Tid:  span.GoroutineID,
+			Args: args,
+		})
+	})
+	return events
+}
+
+// see https://github.com/open-telemetry/opentelemetry-proto/blob/main/examples/trace.json
+type otlpTrace struct {
+	ResourceSpans []*otlpResourceSpans `json:"resourceSpans"`
+}
+type otlpResourceSpans struct {
+	Resource   otlpResource      `json:"resource"`
+	ScopeSpans []*otlpScopeSpans `json:"scopeSpans"`
+}
+type otlpResource struct {
+	Attributes []*otlpAttribute `json:"attributes"`
+}
+type otlpScopeSpans struct {
+	Scope otlpScope   `json:"scope"`
+	Spans []*otlpSpan `json:"spans"`
+}
+type otlpScope struct {
+	Name string `json:"name"`
+}
+type otlpSpan struct {
+	TraceID           string           `json:"traceId"`
+	SpanID            string           `json:"spanId"`
+	ParentSpanID      string           `json:"parentSpanId,omitempty"`
+	Name              string           `json:"name"`
+	Kind              int              `json:"kind"`
+	StartTimeUnixNano string           `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string           `json:"endTimeUnixNano"`
+	Attributes        []*otlpAttribute `json:"attributes,omitempty"`
+	Status            *otlpStatus      `json:"status,omitempty"`
+}
+type otlpAttribute struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+type otlpValue struct {
+	StringValue *string `json:"stringValue,omitempty"`
+	BoolValue   *bool   `json:"boolValue,omitempty"`
+	IntValue    *string `json:"intValue,omitempty"`
+}
+type otlpStatus struct {
+	Code    int    `json:"code"` // 1:OK 2:ERROR
+	Message string `json:"message,omitempty"`
+}
+
+const otlpSpanKindInternal = 1
+
+func stringAttr(key string, val string) *otlpAttribute {
+	return &otlpAttribute{Key: key, Value: otlpValue{StringValue: &val}}
+}
+func boolAttr(key string, val bool) *otlpAttribute {
+	return &otlpAttribute{Key: key, Value: otlpValue{BoolValue: &val}}
+}
+func intAttr(key string, val int64) *otlpAttribute {
+	s := strconv.FormatInt(val, 10)
+	return &otlpAttribute{Key: key, Value: otlpValue{IntValue: &s}}
+}
+
+// ExportOTLP writes spans as OTLP JSON, in the form of
+// an ExportTraceServiceRequest.
+// Each root span starts a new trace.
+func (t *Tracer) ExportOTLP(w io.Writer, serviceName string) error {
+	return json.NewEncoder(w).Encode(t.otlpTrace(t.Roots(), time.Now(), serviceName))
+}
+
+func (t *Tracer) otlpTrace(roots []*Span, now time.Time, serviceName string) *otlpTrace {
+	scope := &otlpScopeSpans{
+		Scope: otlpScope{Name: "github.com/xhd2015/go-mock"},
+		Spans: []*otlpSpan{},
+	}
+	for _, root := range roots {
+		traceID := fmt.Sprintf("%016x%016x", uint64(t.nonce), uint64(root.ID))
+		walkSpans([]*Span{root}, func(span *Span) {
+			attrs := []*otlpAttribute{
+				stringAttr("code.namespace", span.Stub.PkgName),
+				stringAttr("code.function", span.Stub.Name),
+				intAttr("thread.id", span.GoroutineID),
+			}
+			if span.Stub.Owner != "" {
+				attrs = append(attrs, stringAttr("code.owner", span.Stub.Owner))
+			}
+			if span.Request != nil {
+				attrs = append(attrs, stringAttr("go_mock.request", toJSON(span.Request)))
+			}
+			if span.Response != nil {
+				attrs = append(attrs, stringAttr("go_mock.response", toJSON(span.Response)))
+			}
+			if span.MockStatus != "" {
+				attrs = append(attrs, stringAttr("go_mock.mock_status", string(span.MockStatus)))
+			}
+			if span.IsPanic {
+				attrs = append(attrs, boolAttr("go_mock.panic", true))
+			}
+			s := &otlpSpan{
+				TraceID:           traceID,
+				SpanID:            fmt.Sprintf("%016x", uint64(span.ID)),
+				Name:              span.Name(),
+				Kind:              otlpSpanKindInternal,
+				StartTimeUnixNano: strconv.FormatInt(span.Start.UnixNano(), 10),
+				EndTimeUnixNano:   strconv.FormatInt(spanEnd(span, now).UnixNano(), 10),
+				Attributes:        attrs,
+			}
+			if span.ParentID != 0 {
+				s.ParentSpanID = fmt.Sprintf("%016x", uint64(span.ParentID))
+			}
+			if span.Error != "" {
+				s.Status = &otlpStatus{Code: 2, Message: span.Error}
+			}
+			scope.Spans = append(scope.Spans, s)
+		})
+	}
+	trace := &otlpTrace{
+		ResourceSpans: []*otlpResourceSpans{{
+			Resource: otlpResource{
+				Attributes: []*otlpAttribute{stringAttr("service.name", serviceName)},
+			},
+			ScopeSpans: []*otlpScopeSpans{scope},
+		}},
+	}
+	return trace
+}
+
+// ExportFile writes all spans of t into file in the given format
+func (t *Tracer) ExportFile(file string, format string) error {
+	return writeFileAtomic(file, func(w io.Writer) error {
+		switch format {
+		case "", FormatChrome:
+			return t.ExportChromeTrace(w)
+		case FormatOTLP:
+			return t.ExportOTLP(w, filepath.Base(os.Args[0]))
+		default:
+			return fmt.Errorf("unknown trace format: %s", format)
+		}
+	})
+}
+
+// InstallFromEnv installs a tracer writing traces to GO_MOCK_TRACE_FILE
+// in GO_MOCK_TRACE_FORMAT, and call tree to GO_MOCK_CALL_TREE, see
+// FileExporter. It does nothing if neither file is set.
+func InstallFromEnv() (tracer *Tracer, err error) {
+	traceFile := os.Getenv(ENV_TRACE_FILE)
+	callTreeFile := os.Getenv(ENV_CALL_TREE)
+	if traceFile == "" && callTreeFile == "" {
+		return nil, nil
+	}
+	format := strings.ToLower(os.Getenv(ENV_TRACE_FORMAT))
+	tracer = NewTracer()
+	exporter, err := NewFileExporter(tracer, traceFile, format, callTreeFile)
+	if err != nil {
+		return nil, err
+	}
+	envExporter = exporter
+	tracer.Install()
+	return tracer, nil
+}
+
+// writeFileAtomic writes into a temp file then renames it,
+// so readers never see a partial file.
+func writeFileAtomic(file string, write func(w io.Writer) error) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(file), filepath.Base(file)+".tmp")
+	if err != nil {
+		return err
+	}
+	err = tmp.Chmod(0644)
+	if err == nil {
+		err = write(tmp)
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), file)
+}
+
+func walkSpans(spans []*Span, fn func(span *Span)) {
+	for _, span := range spans {
+		fn(span)
+		walkSpans(span.Children, fn)
+	}
+}
+
+func spanEnd(span *Span, now time.Time) time.Time {
+	if span.End.IsZero() {
+		return now
+	}
+	return span.End
+}
+
+func toJSON(v interface{}) string {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprintf("%v", v)
+	}
+	return string(data)
+}
@@ -0,0 +1,207 @@
+package trace
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+)
+
+// exportQueueSize roots ended but not yet written, roots
+// ending when the queue is full are dropped.
+const exportQueueSize = 4096
+
+// mainGoroutineID is the id of the goroutine running main.main
+const mainGoroutineID = 1
+
+// envExporter is the exporter installed by InstallFromEnv
+var envExporter *FileExporter
+
+// FileExporter appends each root span of a tracer to a trace file and
+// a call tree file after the root ends. Roots are written by a background
+// goroutine, then dropped from the tracer, so callers do not wait on the
+// files, and memory does not grow with the number of roots.
+//
+// To be appendable, the trace file of format chrome uses the JSON array
+// format, whose closing ] is optional, and the trace file of format otlp
+// has one ExportTraceServiceRequest per line, like the file exporter of the
+// OpenTelemetry Collector. The HTML call tree has no footer.
+//
+// Roots ended on the main goroutine, and all roots of a test binary, are
+// written before OnRootEnd returns, so the files are complete when main
+// returns or tests finish. Other roots ending right before os.Exit may be
+// missed, unless Flush is called.
+type FileExporter struct {
+	tracer   *Tracer
+	format   string
+	trace    *os.File
+	callTree *os.File
+	htmlTree bool
+
+	queue   chan exportItem
+	dropped int64 // atomic
+
+	// owned by the background goroutine
+	traceEvents int
+}
+
+type exportItem struct {
+	root *Span
+	done chan struct{} // closed after roots before are written
+}
+
+// NewFileExporter creates traceFile and callTreeFile, either can be empty,
+// and sets OnRootEnd of tracer. The call tree is HTML if the file ends
+// with .html or .htm, otherwise text.
+func NewFileExporter(tracer *Tracer, traceFile string, format string, callTreeFile string) (*FileExporter, error) {
+	if format != "" && format != FormatChrome && format != FormatOTLP {
+		return nil, fmt.Errorf("unknown trace format: %s", format)
+	}
+	c := &FileExporter{
+		tracer:   tracer,
+		format:   format,
+		htmlTree: isHTMLFile(callTreeFile),
+		queue:    make(chan exportItem, exportQueueSize),
+	}
+	err := c.open(traceFile, callTreeFile)
+	if err != nil {
+		c.closeFiles()
+		return nil, err
+	}
+	tracer.OnRootEnd = c.onRootEnd
+	go c.run()
+	return c, nil
+}
+
+func (c *FileExporter) open(traceFile string, callTreeFile string) error {
+	var err error
+	if traceFile != "" {
+		c.trace, err = os.Create(traceFile)
+		if err != nil {
+			return err
+		}
+		if c.format != FormatOTLP {
+			_, err = io.WriteString(c.trace, "[\n")
+			if err != nil {
+				return err
+			}
+		}
+	}
+	if callTreeFile != "" {
+		c.callTree, err = os.Create(callTreeFile)
+		if err != nil {
+			return err
+		}
+		if c.htmlTree {
+			err = callTreeHTML.ExecuteTemplate(c.callTree, "header", nil)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (c *FileExporter) closeFiles() {
+	if c.trace != nil {
+		c.trace.Close()
+	}
+	if c.callTree != nil {
+		c.callTree.Close()
+	}
+}
+
+// Flush waits until roots ended before are written
+func (c *FileExporter) Flush() {
+	done := make(chan struct{})
+	c.queue <- exportItem{done: done}
+	<-done
+}
+
+// Flush flushes the exporter installed by InstallFromEnv, if any.
+// Call it before os.Exit to write roots just ended.
+func Flush() {
+	if envExporter != nil {
+		envExporter.Flush()
+	}
+}
+
+func (c *FileExporter) onRootEnd(root *Span) {
+	if root.GoroutineID == mainGoroutineID || isTestBinary() {
+		c.queue <- exportItem{root: root}
+		c.Flush()
+		return
+	}
+	select {
+	case c.queue <- exportItem{root: root}:
+	default:
+		atomic.AddInt64(&c.dropped, 1)
+		c.tracer.detach(root)
+	}
+}
+
+func (c *FileExporter) run() {
+	for item := range c.queue {
+		if item.root != nil {
+			c.write(c.tracer.detach(item.root))
+		}
+		if item.done != nil {
+			close(item.done)
+		}
+	}
+}
+
+func (c *FileExporter) write(root *Span) {
+	if n := atomic.SwapInt64(&c.dropped, 0); n > 0 {
+		fmt.Fprintf(os.Stderr, "go-mock: trace queue full, dropped %d root spans\n", n)
+	}
+	if c.trace != nil {
+		err := c.writeTrace(root)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "go-mock: write trace: %v\n", err)
+		}
+	}
+	if c.callTree != nil {
+		var err error
+		if c.htmlTree {
+			err = renderHTMLRoot(c.callTree, root)
+		} else {
+			err = RenderCallTreeText(c.callTree, []*Span{root})
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "go-mock: write call tree: %v\n", err)
+		}
+	}
+}
+
+func (c *FileExporter) writeTrace(root *Span) error {
+	now := time.Now()
+	if c.format == FormatOTLP {
+		return json.NewEncoder(c.trace).Encode(c.tracer.otlpTrace([]*Span{root}, now, filepath.Base(os.Args[0])))
+	}
+	var b bytes.Buffer
+	for _, event := range chromeEvents([]*Span{root}, now) {
+		data, err := json.Marshal(event)
+		if err != nil {
+			return err
+		}
+		if c.traceEvents > 0 {
+			b.WriteString(",\n")
+		}
+		b.Write(data)
+		c.traceEvents++
+	}
+	_, err := c.trace.Write(b.Bytes())
+	return err
+}
+
+// isTestBinary checks flags registered by testing, which
+// are registered after init, when tests start
+func isTestBinary() bool {
+	return flag.Lookup("test.v") != nil
+}
@@ -0,0 +1,279 @@
+// Package trace implements mock.WithTrace, it builds span trees
+// of trapped calls, which can be exported as Chrome trace-event JSON
+// or OTLP JSON.
+package trace
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math/rand"
+	"runtime"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/xhd2015/go-mock/inspect/serialize"
+	"github.com/xhd2015/go-mock/mock"
+)
+
+const _SKIP_MOCK = true
+
+// Span is a trapped call
+type Span struct {
+	ID          int64
+	ParentID    int64 // 0 if root
+	Stub        *mock.StubInfo
+	GoroutineID int64
+	Start       time.Time
+	End         time.Time // zero if not finished
+
+	// Request and Response are converted by serialize.JSONSerialize
+	// when set, so later modification of the original values
+	// does not affect them.
+	Request    interface{}
+	Response   interface{}
+	Error      string
+	IsPanic    bool
+	MockStatus mock.MockStatus
+
+	Children []*Span
+
+	tracer *Tracer
+	root   *Span
+	// detached is set on roots removed from tracer
+	detached bool
+}
+
+// Tracer collects spans, it is safe for concurrent use.
+type Tracer struct {
+	// OnRootEnd if set, is called after each root span ends,
+	// outside of the tracer's lock.
+	OnRootEnd func(root *Span)
+
+	nonce int64
+
+	mutex  sync.Mutex
+	nextID int64
+	roots  []*Span
+	// active spans of each goroutine, the last is the innermost
+	active map[int64][]*Span
+}
+
+func NewTracer() *Tracer {
+	return &Tracer{
+		nonce:  rand.New(rand.NewSource(time.Now().UnixNano())).Int63(),
+		active: make(map[int64][]*Span),
+	}
+}
+
+// Install sets mock.WithTrace to t, it should be called
+// before any trapped call, typically in init().
+func (t *Tracer) Install() (uninstall func()) {
+	old := mock.WithTrace
+	mock.WithTrace = t.WithTrace
+	return func() {
+		mock.WithTrace = old
+	}
+}
+
+type spanKeyType struct{}
+
+var spanKey spanKeyType
+
+// SpanFromContext returns the innermost span in ctx
+func SpanFromContext(ctx context.Context) *Span {
+	if ctx == nil {
+		return nil
+	}
+	span, _ := ctx.Value(spanKey).(*Span)
+	return span
+}
+
+// WithTrace implements mock.WithTrace.
+// The parent span is the innermost active span of the current goroutine,
+// or the span in ctx if the goroutine has none.
+func (t *Tracer) WithTrace(ctx context.Context, stubInfo *mock.StubInfo, inst interface{}, req interface{}, fn func(ctx context.Context, logger mock.Logger) error) error {
+	gid := goroutineID()
+	span := t.start(ctx, stubInfo, gid)
+	if ctx != nil {
+		ctx = context.WithValue(ctx, spanKey, span)
+	}
+	defer t.end(span, gid)
+	return fn(ctx, &spanLogger{span: span})
+}
+
+func (t *Tracer) start(ctx context.Context, stubInfo *mock.StubInfo, gid int64) *Span {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.nextID++
+	span := &Span{
+		ID:          t.nextID,
+		Stub:        stubInfo,
+		GoroutineID: gid,
+		Start:       time.Now(),
+		tracer:      t,
+	}
+	var parent *Span
+	if stack := t.active[gid]; len(stack) > 0 {
+		parent = stack[len(stack)-1]
+	} else if p := SpanFromContext(ctx); p != nil && p.tracer == t {
+		parent = p
+	}
+	// spans started by goroutines still holding ctx of a
+	// detached root start new roots, instead of being lost
+	if parent != nil && parent.root.detached {
+		parent = nil
+	}
+	if parent != nil {
+		span.ParentID = parent.ID
+		span.root = parent.root
+		parent.Children = append(parent.Children, span)
+	} else {
+		span.root = span
+		t.roots = append(t.roots, span)
+	}
+	t.active[gid] = append(t.active[gid], span)
+	return span
+}
+
+func (t *Tracer) end(span *Span, gid int64) {
+	t.mutex.Lock()
+	span.End = time.Now()
+	stack := t.active[gid]
+	for i := len(stack) - 1; i >= 0; i-- {
+		if stack[i] == span {
+			stack = append(stack[:i], stack[i+1:]...)
+			break
+		}
+	}
+	if len(stack) == 0 {
+		delete(t.active, gid)
+	} else {
+		t.active[gid] = stack
+	}
+	isRoot := span.root == span
+	t.mutex.Unlock()
+
+	if isRoot && t.OnRootEnd != nil {
+		t.OnRootEnd(span)
+	}
+}
+
+// Roots returns a snapshot of all root spans, finished or not
+func (t *Tracer) Roots() []*Span {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	roots := make([]*Span, 0, len(t.roots))
+	for _, root := range t.roots {
+		roots = append(roots, root.clone())
+	}
+	return roots
+}
+
+// detach removes root from t and returns a snapshot of it,
+// spans still running under root are no longer tracked by t,
+// spans started under them later become new roots.
+func (t *Tracer) detach(root *Span) *Span {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	root.detached = true
+	for i, r := range t.roots {
+		if r == root {
+			t.roots = append(t.roots[:i], t.roots[i+1:]...)
+			break
+		}
+	}
+	return root.clone()
+}
+
+// Reset clears all finished roots
+func (t *Tracer) Reset() {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	var roots []*Span
+	for _, root := range t.roots {
+		if root.End.IsZero() {
+			roots = append(roots, root)
+		}
+	}
+	t.roots = roots
+}
+
+// clone must be called with lock held
+func (c *Span) clone() *Span {
+	x := *c
+	x.Children = make([]*Span, 0, len(c.Children))
+	for _, child := range c.Children {
+		x.Children = append(x.Children, child.clone())
+	}
+	return &x
+}
+
+// Name returns Stub.String()
+func (c *Span) Name() string {
+	return c.Stub.String()
+}
+
+// Duration returns 0 if not finished
+func (c *Span) Duration() time.Duration {
+	if c.End.IsZero() {
+		return 0
+	}
+	return c.End.Sub(c.Start)
+}
+
+type spanLogger struct {
+	span *Span
+}
+
+var _ mock.Logger = (*spanLogger)(nil)
+
+func (c *spanLogger) set(fn func(span *Span)) {
+	t := c.span.tracer
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	fn(c.span)
+}
+
+func (c *spanLogger) SetMockStatus(mockStatus mock.MockStatus) {
+	c.set(func(span *Span) { span.MockStatus = mockStatus })
+}
+func (c *spanLogger) SetIsPanic(isPanic bool) {
+	c.set(func(span *Span) { span.IsPanic = isPanic })
+}
+func (c *spanLogger) SetError(err error) {
+	if err == nil {
+		return
+	}
+	c.set(func(span *Span) { span.Error = err.Error() })
+}
+func (c *spanLogger) SetRequest(req interface{}) {
+	v := jsonSerialize(req)
+	c.set(func(span *Span) { span.Request = v })
+}
+func (c *spanLogger) SetResp(resp interface{}) {
+	v := jsonSerialize(resp)
+	c.set(func(span *Span) { span.Response = v })
+}
+
+func jsonSerialize(v interface{}) (res interface{}) {
+	defer func() {
+		if e := recover(); e != nil {
+			res = fmt.Sprintf("<unserializable: %v>", e)
+		}
+	}()
+	return serialize.JSONSerialize(v)
+}
+
+// goroutineID parses the id from "goroutine 18 [running]:"
+func goroutineID() int64 {
+	var buf [64]byte
+	n := runtime.Stack(buf[:], false)
+	s := bytes.TrimPrefix(buf[:n], []byte("goroutine "))
+	if idx := bytes.IndexByte(s, ' '); idx >= 0 {
+		s = s[:idx]
+	}
+	id, _ := strconv.ParseInt(string(s), 10, 64)
+	return id
+}
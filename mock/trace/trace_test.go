@@ -0,0 +1,276 @@
+package trace
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/xhd2015/go-mock/mock"
+)
+
+var outerStub = &mock.StubInfo{PkgName: "test", Name: "Outer"}
+var innerStub = &mock.StubInfo{PkgName: "test", Name: "Inner"}
+
+// simulate the rewritten code
+func outer(ctx context.Context, n int) (err error) {
+	var _mockreq = struct {
+		N int `json:"n"`
+	}{N: n}
+	var _mockresp struct{}
+	return mock.TrapFunc(ctx, outerStub, nil, &_mockreq, &_mockresp, _mockouter, false, true, true)
+}
+func _mockouter(ctx context.Context, n int) (err error) {
+	inner(n)
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		// parent found via ctx
+		outerErr(ctx)
+	}()
+	wg.Wait()
+	return nil
+}
+
+func inner(n int) (r int) {
+	var _mockreq = struct {
+		N int `json:"n"`
+	}{N: n}
+	var _mockresp struct {
+		R int `json:"r"`
+	}
+	mock.TrapFunc(nil, innerStub, nil, &_mockreq, &_mockresp, _mockinner, false, false, false)
+	return _mockresp.R
+}
+func _mockinner(n int) (r int) {
+	return n * 2
+}
+
+var errStub = &mock.StubInfo{PkgName: "test", Name: "Err"}
+
+func outerErr(ctx context.Context) (err error) {
+	var _mockreq = struct{}{}
+	var _mockresp struct{}
+	return mock.TrapFunc(ctx, errStub, nil, &_mockreq, &_mockresp, func(ctx context.Context) error { return errors.New("fail") }, false, true, true)
+}
+
+// go test -run TestTracer -v ./mock/trace
+func TestTracer(t *testing.T) {
+	tracer := NewTracer()
+	var ended []*Span
+	tracer.OnRootEnd = func(root *Span) {
+		ended = append(ended, root)
+	}
+	defer tracer.Install()()
+
+	outer(context.Background(), 2)
+
+	roots := tracer.Roots()
+	if len(roots) != 1 || len(ended) != 1 {
+		t.Fatalf("expect 1 root, actual:%d %d", len(roots), len(ended))
+	}
+	root := roots[0]
+	if len(root.Children) != 2 {
+		t.Fatalf("expect %s = %+v, actual:%+v", `len(root.Children)`, 2, len(root.Children))
+	}
+	innerSpan, errSpan := root.Children[0], root.Children[1]
+	if innerSpan.Stub != innerStub || innerSpan.GoroutineID != root.GoroutineID || innerSpan.ParentID != root.ID {
+		t.Fatalf("expect inner span in the same goroutine, actual:%+v", innerSpan)
+	}
+	if toJSON(innerSpan.Response) != `{"r":4}` {
+		t.Fatalf("expect %s = %+v, actual:%+v", `resp`, `{"r":4}`, toJSON(innerSpan.Response))
+	}
+	if errSpan.Error != "fail" || errSpan.MockStatus != mock.MockStatus_NormalError || errSpan.GoroutineID == root.GoroutineID {
+		t.Fatalf("expect err span in another goroutine, actual:%+v", errSpan)
+	}
+
+	var buf bytes.Buffer
+	if err := tracer.ExportChromeTrace(&buf); err != nil {
+		t.Fatal(err)
+	}
+	var chrome chromeTrace
+	if err := json.Unmarshal(buf.Bytes(), &chrome); err != nil {
+		t.Fatal(err)
+	}
+	if len(chrome.TraceEvents) != 3 {
+		t.Fatalf("expect %s = %+v, actual:%+v", `len(chrome.TraceEvents)`, 3, len(chrome.TraceEvents))
+	}
+
+	buf.Reset()
+	if err := tracer.ExportOTLP(&buf, "test"); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), `"parentSpanId"`) {
+		t.Fatalf("expect parentSpanId in otlp, actual:%s", buf.String())
+	}
+}
+
+// go test -run TestDetachedRoot -v ./mock/trace
+func TestDetachedRoot(t *testing.T) {
+	tracer := NewTracer()
+	var ended []*Span
+	tracer.OnRootEnd = func(root *Span) {
+		ended = append(ended, tracer.detach(root))
+	}
+	defer tracer.Install()()
+
+	// a goroutine outlives the root, like an async task
+	ctxCh := make(chan context.Context, 1)
+	rootEnded := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		ctx := <-ctxCh
+		<-rootEnded
+		outerErr(ctx)
+		close(done)
+	}()
+	mock.TrapFunc(context.Background(), outerStub, nil, &struct{}{}, &struct{}{}, func(ctx context.Context) error {
+		ctxCh <- ctx
+		return nil
+	}, false, true, true)
+	close(rootEnded)
+	<-done
+
+	if len(ended) != 2 {
+		t.Fatalf("expect %s = %+v, actual:%+v", `len(ended)`, 2, len(ended))
+	}
+	if ended[0].Stub != outerStub || ended[1].Stub != errStub || ended[1].ParentID != 0 {
+		t.Fatalf("expect span after detach to be a new root, actual:%+v", ended[1])
+	}
+	if roots := tracer.Roots(); len(roots) != 0 {
+		t.Fatalf("expect %s = %+v, actual:%+v", `len(roots)`, 0, len(roots))
+	}
+}
+
+// go test -run TestCallTree -v ./mock/trace
+func TestCallTree(t *testing.T) {
+	tracer := NewTracer()
+	defer tracer.Install()()
+	outer(context.Background(), 2)
+
+	var buf bytes.Buffer
+	if err := RenderCallTreeText(&buf, tracer.Roots()); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("expect 3 lines, actual:%s", buf.String())
+	}
+	if !strings.HasPrefix(lines[0], `test.Outer {"n":2} => {}`) {
+		t.Fatalf("expect %s = %+v, actual:%+v", `lines[0]`, `test.Outer {"n":2} => {}`, lines[0])
+	}
+	if !strings.HasPrefix(lines[1], `├── test.Inner {"n":2} => {"r":4}`) {
+		t.Fatalf("expect %s = %+v, actual:%+v", `lines[1]`, `├── test.Inner {"n":2} => {"r":4}`, lines[1])
+	}
+	if !strings.HasPrefix(lines[2], `└── test.Err {} => error: fail`) {
+		t.Fatalf("expect %s = %+v, actual:%+v", `lines[2]`, `└── test.Err {} => error: fail`, lines[2])
+	}
+
+	buf.Reset()
+	if err := RenderCallTreeHTML(&buf, tracer.Roots()); err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(buf.String(), "<details"); n != 3 {
+		t.Fatalf("expect %s = %+v, actual:%+v", `details`, 3, n)
+	}
+}
+
+// go test -run TestFileExporter -v ./mock/trace
+func TestFileExporter(t *testing.T) {
+	dir, err := ioutil.TempDir("", "trace")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	traceFile := filepath.Join(dir, "trace.json")
+	callTreeFile := filepath.Join(dir, "tree.txt")
+
+	tracer := NewTracer()
+	exporter, err := NewFileExporter(tracer, traceFile, FormatChrome, callTreeFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tracer.Install()()
+
+	outer(context.Background(), 1)
+	outer(context.Background(), 2)
+	exporter.Flush()
+
+	if roots := tracer.Roots(); len(roots) != 0 {
+		t.Fatalf("expect exported roots dropped, actual:%d", len(roots))
+	}
+	data, err := ioutil.ReadFile(traceFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var events []*chromeEvent
+	if err := json.Unmarshal(append(data, ']'), &events); err != nil {
+		t.Fatalf("expect appendable chrome trace, actual:%s %v", data, err)
+	}
+	if len(events) != 6 {
+		t.Fatalf("expect %s = %+v, actual:%+v", `len(events)`, 6, len(events))
+	}
+	data, err = ioutil.ReadFile(callTreeFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 6 || !strings.HasPrefix(lines[3], `test.Outer {"n":2}`) {
+		t.Fatalf("expect 2 call trees, actual:%s", data)
+	}
+}
+
+// go test -run TestFileExporterOTLP -v ./mock/trace
+func TestFileExporterOTLP(t *testing.T) {
+	dir, err := ioutil.TempDir("", "trace")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	traceFile := filepath.Join(dir, "trace.json")
+	callTreeFile := filepath.Join(dir, "tree.html")
+
+	tracer := NewTracer()
+	exporter, err := NewFileExporter(tracer, traceFile, FormatOTLP, callTreeFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tracer.Install()()
+
+	outer(context.Background(), 1)
+	outer(context.Background(), 2)
+	exporter.Flush()
+
+	data, err := ioutil.ReadFile(traceFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expect one otlp request per root, actual:%s", data)
+	}
+	for _, line := range lines {
+		var req otlpTrace
+		if err := json.Unmarshal([]byte(line), &req); err != nil {
+			t.Fatal(err)
+		}
+		if n := len(req.ResourceSpans[0].ScopeSpans[0].Spans); n != 3 {
+			t.Fatalf("expect %s = %+v, actual:%+v", `spans`, 3, n)
+		}
+	}
+	data, err = ioutil.ReadFile(callTreeFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	page := string(data)
+	if n := strings.Count(page, `class="root"`); n != 2 || strings.Count(page, "<!DOCTYPE html>") != 1 {
+		t.Fatalf("expect one html page with 2 roots, actual:%s", page)
+	}
+}
@@ -9,12 +9,17 @@ import (
 	"log"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"regexp"
 	"strings"
 
 	"github.com/xhd2015/go-mock/cmdsupport"
+	"github.com/xhd2015/go-mock/generalmock"
 	"github.com/xhd2015/go-mock/inspect"
 	_ "github.com/xhd2015/go-mock/inspect/mock" // for generated code to include mock correctly
+	_ "github.com/xhd2015/go-mock/mock/autoload"
+	"github.com/xhd2015/go-mock/mock/admin"
+	"github.com/xhd2015/go-mock/mock/trace"
 )
 
 // example:
@@ -37,12 +42,22 @@ var mockModules = flag.String("mock-module", "", "a comma separated list:module1
 var allowMissing = flag.String("allow-missing", "", "missing packages: skip, warn,ignore")
 var onlyPkg = flag.String("only-pkg", "", "only rewrite pkg specified, ignore any packages introduced by other modules or packages")
 var force = flag.Bool("f", false, "force regenerate all files")
+var propagateGo = flag.Bool("propagate-go", false, "rewrite go statements, so that child goroutines inherit mocks set up by the parent without ctx")
+var virtualClock = flag.Bool("virtual-clock", false, "redirect time.Now,time.Since,time.Sleep,time.After and time.NewTimer in rewritten packages to the virtual clock of github.com/xhd2015/go-mock/mock/clock. Not covered, still on the real clock: calls in packages not rewritten(dependencies and std), time.AfterFunc,time.Tick,time.NewTicker, and deadlines of context.WithTimeout,context.WithDeadline")
+var mockSQL = flag.Bool("mock-sql", false, "redirect QueryContext,QueryRowContext and ExecContext of *sql.DB and *sql.Tx in rewritten packages to github.com/xhd2015/go-mock/mock/sqlmock, which traps them, calls through interfaces with the same methods(like sqlc DBTX) are trapped if the dynamic type is *sql.DB or *sql.Tx. Not covered: calls in packages not rewritten(dependencies like sqlx,gorm), calls of method values, and methods without ctx")
+var mockHTTP = flag.Bool("mock-http", false, "redirect Do,Get,Post,PostForm and Head of *http.Client in rewritten packages to github.com/xhd2015/go-mock/mock/httpmock, which traps them even if the client has its own Transport. Not covered: calls in packages not rewritten(dependencies and std), calls through interfaces or method values, and RoundTrip of transports called directly")
+var adminAddr = flag.String("admin-addr", "", "serve the admin API of mocks on the loopback address or unix:PATH when running, built binaries use env GO_MOCK_ADMIN_ADDR instead(available for: run,test)")
+var mockDataDir = flag.String("mock-data-dir", "", "load generalmock data from JSON or YAML files of the directory, reloaded on change, built binaries use env GO_MOCK_DATA_DIR instead(available for: run,test)")
 var printRewrite = flag.Bool("print-rewrite", true, "print rewrite content")
 var printMock = flag.Bool("print-mock", true, "print mock content")
 var buildFlags = flag.String("build-flags", "", "flags passed to underlying go command(go build,go run).\nNOTE: the flag is passed verbatim so you must quote it well to make is understood correctly by underlying shell.\nfor flags for go test can be passed after --, adding 'test.' prefix, for example: -- -test.v -args ...")
 var testMode = flag.Bool("test", false, "cause build,run to deal with test packages instead of regular packages.if test command is ran, -test is implied.")
 var mod = flag.String("mod", "", "load packages with -mod={given}")
 
+var callTree = flag.String("call-tree", "", "append the call tree of each trapped root call into the file when it ends, HTML if the file ends with .html, otherwise text(available for: run,test)")
+
+var stubsFormat = flag.String("format", "table", "output format: table, json or schema(available for: stubs)")
+
 var coverProfile = flag.String("coverprofile", "", "for test")
 var coverPkg = flag.String("coverpkg", "", "for test")
 
@@ -53,6 +68,7 @@ var commands = map[string]func(comm string, args []string, extraArgs []string){
 	"build":   build,
 	"run":     run,
 	"test":    test,
+	"stubs":   stubs,
 }
 
 func Main() {
@@ -209,7 +225,11 @@ func getRewriteOptions() *cmdsupport.GenRewriteOptions {
 		ForTest:        *testMode,
 		LoadArgs:       loadArgs,
 		RewriteOptions: &inspect.RewriteOptions{
-			Filter: filterFn,
+			Filter:       filterFn,
+			PropagateGo:  *propagateGo,
+			VirtualClock: *virtualClock,
+			MockSQL:      *mockSQL,
+			MockHTTP:     *mockHTTP,
 		},
 	}
 }
@@ -226,10 +246,23 @@ func print(commd string, args []string, extraArgs []string) {
 
 	filterFn := createFilter(*filter)
 	cmdsupport.PrintRewrite(args[0], *printRewrite, *printMock, &inspect.RewriteOptions{
-		Filter: filterFn,
+		Filter:       filterFn,
+		PropagateGo:  *propagateGo,
+		VirtualClock: *virtualClock,
+		MockSQL:      *mockSQL,
+		MockHTTP:     *mockHTTP,
 	})
 }
 
+func stubs(commd string, args []string, extraArgs []string) {
+	list := cmdsupport.ListStubs(args, getRewriteOptions())
+	err := cmdsupport.PrintStubs(os.Stdout, list, *stubsFormat)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
+}
+
 func getBuildOptions() *cmdsupport.BuildOptions {
 	goFlags := *buildFlags
 	if *coverProfile != "" {
@@ -270,6 +303,7 @@ func run(commd string, args []string, extraArgs []string) {
 	}
 	execCmd := exec.Command("bash", "-c", bashCmd)
 
+	execCmd.Env = getExecEnv()
 	execCmd.Stderr = os.Stderr
 	execCmd.Stdout = os.Stdout
 	err := execCmd.Run()
@@ -297,6 +331,7 @@ func test(commd string, args []string, extraArgs []string) {
 	}
 	execCmd := exec.Command("bash", "-c", bashCmd)
 
+	execCmd.Env = getExecEnv()
 	execCmd.Stderr = os.Stderr
 	execCmd.Stdout = os.Stdout
 	err := execCmd.Run()
@@ -305,9 +340,32 @@ func test(commd string, args []string, extraArgs []string) {
 	}
 }
 
+// getExecEnv returns env for the executable run by run,test
+func getExecEnv() []string {
+	env := os.Environ()
+	if *callTree != "" {
+		file, err := filepath.Abs(*callTree)
+		if err != nil {
+			log.Fatalf("call tree file: %v", err)
+		}
+		env = append(env, trace.ENV_CALL_TREE+"="+file)
+	}
+	if *adminAddr != "" {
+		env = append(env, admin.ENV_ADDR+"="+*adminAddr)
+	}
+	if *mockDataDir != "" {
+		dir, err := filepath.Abs(*mockDataDir)
+		if err != nil {
+			log.Fatalf("mock data dir: %v", err)
+		}
+		env = append(env, generalmock.ENV_DATA_DIR+"="+dir)
+	}
+	return env
+}
+
 func defaultCommand(commd string, args []string, extraArgs []string) {
 	if commd == "" {
-		fmt.Printf("requries cmd: build,run,test,rewrite,show,help\n")
+		fmt.Printf("requries cmd: build,run,test,rewrite,stubs,show,help\n")
 	} else {
 		fmt.Printf("unknown cmd:%s\n", commd)
 	}
@@ -317,7 +375,7 @@ func defaultCommand(commd string, args []string, extraArgs []string) {
 
 func usage(defaultUsage func()) func() {
 	return func() {
-		fmt.Printf("supported commands: build,run,test,rewrite,help\n")
+		fmt.Printf("supported commands: build,run,test,rewrite,stubs,help\n")
 		fmt.Printf("    build ARGS\n")
 		fmt.Printf("        build the package with generated mock stubs,default output is exec.bin or debug.bin if -debug\n")
 		fmt.Printf("    run ARGS [--] [EXEC_ARGS]\n")
@@ -328,6 +386,8 @@ func usage(defaultUsage func()) func() {
 		fmt.Printf("        rewrite the package with generated mock stubs into a temp directory,show the directory if -v\n")
 		fmt.Printf("    print FILE\n")
 		fmt.Printf("        print rewritten content of a file, can use -print-rewrite=true(default)|false,-print-mock=true(default)|false to toggle display\n")
+		fmt.Printf("    stubs ARGS\n")
+		fmt.Printf("        list functions that would be mocked, and their stubs, without building. use -format=table(default)|json|schema to choose output\n")
 		fmt.Printf("    help\n")
 		fmt.Printf("        show help message\n")
 		defaultUsage()
@@ -344,6 +404,12 @@ func usage(defaultUsage func()) func() {
 		fmt.Printf("    # test:\n")
 		fmt.Printf("    $  go test -mod=readonly github.com/xhd2015/go-mock test ./test/main_test.go -- -config config_dir\n")
 		fmt.Printf("\n")
+		fmt.Printf("    # run, write call tree into out.html:\n")
+		fmt.Printf("    $  go run -mod=readonly github.com/xhd2015/go-mock run -call-tree out.html ./src/main.go\n")
+		fmt.Printf("\n")
+		fmt.Printf("    # list mockable functions with JSON Schema of their req and resp:\n")
+		fmt.Printf("    $  go run -mod=readonly github.com/xhd2015/go-mock stubs -format schema ./src/main.go\n")
+		fmt.Printf("\n")
 		fmt.Printf("    # test with coverage:\n")
 		fmt.Printf("    $  go run -mod=readonly github.com/xhd2015/go-mock test -build-flags='-coverprofile=cover.out -coverpkg ./...' -v ./verify_test_cmd/\n")
 	}